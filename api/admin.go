@@ -0,0 +1,334 @@
+package api
+
+import (
+	"errors"
+	"gin-gorm-api/middleware"
+	"gin-gorm-api/model"
+	"gin-gorm-api/provider"
+	"gin-gorm-api/schema"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AdminHandler exposes endpoints to manage roles and other users.
+type AdminHandler struct {
+	db      *gorm.DB
+	manager provider.UserAuthManager
+	authMW  gin.HandlerFunc
+}
+
+// NewAdminHandler returns a new AdminHandler.
+func NewAdminHandler(
+	db *gorm.DB,
+	manager provider.UserAuthManager,
+	authMW gin.HandlerFunc,
+) AdminHandler {
+	return AdminHandler{db: db, manager: manager, authMW: authMW}
+}
+
+// GetRoles godoc
+// @Summary      Get all roles
+// @Schemes
+// @Description  Get all roles and their permissions
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Success      200      {object}  []schema.RoleOut
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /admin/roles [get]
+// .
+func (h AdminHandler) getRoles(c *gin.Context) {
+	var roles []model.Role
+	if r := h.db.WithContext(c.Request.Context()).Preload(
+		"Permissions",
+	).Find(&roles); r.Error != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, r.Error)
+		return
+	}
+	out := make([]schema.RoleOut, len(roles))
+	for i, role := range roles {
+		out[i] = roleOut(role)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// CreateRole godoc
+// @Summary      Create role
+// @Schemes
+// @Description  Create a new role with the given permissions
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.RoleForm true "Role form"
+// @Success      201      {object}  schema.RoleOut
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      409      {string}  string        "Duplicate role"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /admin/roles [post]
+// .
+func (h AdminHandler) createRole(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.RoleForm)
+	db := h.db.WithContext(c.Request.Context())
+	role := model.Role{Name: form.Name}
+	if len(form.Permissions) > 0 {
+		if r := db.Where("name IN ?", form.Permissions).Find(
+			&role.Permissions,
+		); r.Error != nil {
+			_ = c.AbortWithError(http.StatusFailedDependency, r.Error)
+			return
+		}
+	}
+	if r := db.Create(&role); r.Error != nil {
+		if errors.Is(r.Error, gorm.ErrDuplicatedKey) {
+			c.Status(http.StatusConflict)
+			return
+		}
+		_ = c.AbortWithError(http.StatusFailedDependency, r.Error)
+		return
+	}
+	c.JSON(http.StatusCreated, roleOut(role))
+}
+
+// GetUserRoles godoc
+// @Summary      Get user roles
+// @Schemes
+// @Description  Get the names of the roles assigned to a user
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        user_id  path      int true "User id"
+// @Success      200      {object}  []string
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      404      {string}  string        "User not found"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /admin/users/{user_id}/roles [get]
+// .
+func (h AdminHandler) getUserRoles(c *gin.Context) {
+	user, ok := h.paramUser(c)
+	if !ok {
+		return
+	}
+	names := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		names[i] = role.Name
+	}
+	c.JSON(http.StatusOK, names)
+}
+
+// AssignRole godoc
+// @Summary      Assign role
+// @Schemes
+// @Description  Assign a role to a user
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        user_id  path      int true "User id"
+// @Param        form     body      schema.RoleAssignmentForm true "Role assignment form"
+// @Success      204
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      403      {object}  schema.Errors "Reauthentication required"
+// @Failure      404      {string}  string        "User or role not found"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /admin/users/{user_id}/roles [post]
+// .
+func (h AdminHandler) assignRole(c *gin.Context) {
+	user, ok := h.paramUser(c)
+	if !ok {
+		return
+	}
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.RoleAssignmentForm)
+	db := h.db.WithContext(c.Request.Context())
+	var role model.Role
+	if r := db.First(&role, "name = ?", form.Role); r.Error != nil {
+		handleNotFound(r.Error, c)
+		return
+	}
+	if err := db.Model(&user).Association("Roles").Append(
+		&role,
+	); err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// UnassignRole godoc
+// @Summary      Unassign role
+// @Schemes
+// @Description  Remove a role from a user
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        user_id  path      int true "User id"
+// @Param        role     path      string true "Role name"
+// @Success      204
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      403      {object}  schema.Errors "Reauthentication required"
+// @Failure      404      {string}  string        "User or role not found"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /admin/users/{user_id}/roles/{role} [delete]
+// .
+func (h AdminHandler) unassignRole(c *gin.Context) {
+	user, ok := h.paramUser(c)
+	if !ok {
+		return
+	}
+	db := h.db.WithContext(c.Request.Context())
+	var role model.Role
+	if r := db.First(&role, "name = ?", c.Param("role")); r.Error != nil {
+		handleNotFound(r.Error, c)
+		return
+	}
+	if err := db.Model(&user).Association("Roles").Delete(
+		&role,
+	); err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeUserSessions godoc
+// @Summary      Revoke user sessions
+// @Schemes
+// @Description  Revoke every session of a user
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        user_id  path      int true "User id"
+// @Success      204
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      404      {string}  string        "User not found"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /admin/users/{user_id}/sessions [delete]
+// .
+func (h AdminHandler) revokeUserSessions(c *gin.Context) {
+	user, ok := h.paramUser(c)
+	if !ok {
+		return
+	}
+	if err := h.manager.RevokeUserSessions(user, c); err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// UnlockUser godoc
+// @Summary      Unlock user
+// @Schemes
+// @Description  Forget the failed login attempts of a user, lifting its lockout
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        user_id  path      int true "User id"
+// @Success      204
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      404      {string}  string        "User not found"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /admin/users/{user_id}/lockout [delete]
+// .
+func (h AdminHandler) unlockUser(c *gin.Context) {
+	user, ok := h.paramUser(c)
+	if !ok {
+		return
+	}
+	if err := h.manager.UnlockUser(user, c); err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// paramUser returns the user, with its roles, whose id is in the path of the
+// request. If it can not be found an error response is written and false is
+// returned.
+func (h AdminHandler) paramUser(c *gin.Context) (model.User, bool) {
+	var user model.User
+	userID, err := getParamID("userid", c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schema.Errors{"user_id": err.Error()})
+		return user, false
+	}
+	if r := h.db.WithContext(c.Request.Context()).Preload("Roles").First(
+		&user,
+		userID,
+	); r.Error != nil {
+		handleNotFound(r.Error, c)
+		return user, false
+	}
+	return user, true
+}
+
+func handleNotFound(err error, c *gin.Context) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	_ = c.AbortWithError(http.StatusFailedDependency, err)
+}
+
+func roleOut(role model.Role) schema.RoleOut {
+	perms := make([]string, len(role.Permissions))
+	for i, perm := range role.Permissions {
+		perms[i] = perm.Name
+	}
+	return schema.RoleOut{ID: role.ID, Name: role.Name, Permissions: perms}
+}
+
+// AddRoutes add a group of routes to r under the path "/admin". Every route
+// requires the provider.ScopeAdmin scope.
+func (h AdminHandler) AddRoutes(r *gin.Engine) {
+	g := r.Group("/admin")
+	g.Use(h.authMW, middleware.RequireScopes(provider.ScopeAdmin))
+	g.GET(
+		"/roles",
+		middleware.RequirePermission(model.PermRoleManage),
+		h.getRoles,
+	)
+	g.POST(
+		"/roles",
+		middleware.RequirePermission(model.PermRoleManage),
+		middleware.FormValidation[schema.RoleForm](),
+		h.createRole,
+	)
+	g.GET(
+		"/users/:userid/roles",
+		middleware.RequirePermission(model.PermRoleManage),
+		h.getUserRoles,
+	)
+	g.POST(
+		"/users/:userid/roles",
+		middleware.RequirePermission(model.PermRoleManage),
+		middleware.RequireReauthentication(h.manager),
+		middleware.FormValidation[schema.RoleAssignmentForm](),
+		h.assignRole,
+	)
+	g.DELETE(
+		"/users/:userid/roles/:role",
+		middleware.RequirePermission(model.PermRoleManage),
+		middleware.RequireReauthentication(h.manager),
+		h.unassignRole,
+	)
+	g.DELETE(
+		"/users/:userid/sessions",
+		middleware.RequirePermission(model.PermSessionRevoke),
+		h.revokeUserSessions,
+	)
+	g.DELETE(
+		"/users/:userid/lockout",
+		middleware.RequirePermission(model.PermUserUnlock),
+		h.unlockUser,
+	)
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"errors"
+	"gin-gorm-api/middleware"
+	"gin-gorm-api/model"
+	"gin-gorm-api/provider"
+	"gin-gorm-api/schema"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKey godoc
+// @Summary      Create API key
+// @Schemes
+// @Description  Create an API key for the current user. Its secret is only shown once.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.APIKeyForm true "API key form"
+// @Success      201      {object}  schema.NewAPIKeyOut
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Scope not granted"
+// @Failure      403      {object}  schema.Errors "Reauthentication required"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/api_keys [post]
+// .
+func (h AuthHandler) createAPIKey(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	credData, _ := c.Get(middleware.CredentialKey)
+	cred, _ := credData.(provider.Credential)
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.APIKeyForm)
+	key, secret, err := h.manager.CreateAPIKey(user, cred, form, c)
+	if err != nil {
+		switch {
+		case errors.Is(err, provider.ErrUnknownScope):
+			c.JSON(http.StatusBadRequest, schema.Errors{"scopes": err.Error()})
+		case errors.Is(err, provider.ErrScopeNotGranted):
+			c.JSON(http.StatusForbidden, schema.SimpleError(err))
+		default:
+			_ = c.AbortWithError(http.StatusFailedDependency, err)
+		}
+		return
+	}
+	c.JSON(
+		http.StatusCreated,
+		schema.NewAPIKeyOut{APIKeyOut: apiKeyOut(key), Key: secret},
+	)
+}
+
+// ListAPIKeys godoc
+// @Summary      List API keys
+// @Schemes
+// @Description  List the API keys of the current user
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Success      200      {object}  []schema.APIKeyOut
+// @Failure      403      {string}  string  "Forbidden"
+// @Failure      default  {string}  string  "Unexpected error"
+// @Router       /auth/api_keys [get]
+// .
+func (h AuthHandler) listAPIKeys(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	keys, err := h.manager.ListAPIKeys(user, c)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	out := make([]schema.APIKeyOut, len(keys))
+	for i, key := range keys {
+		out[i] = apiKeyOut(key)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// UpdateAPIKey godoc
+// @Summary      Update API key
+// @Schemes
+// @Description  Rename an API key or change its expiration
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        keyid    path      int true "API key id"
+// @Param        form     body      schema.APIKeyUpdateForm true "API key update form"
+// @Success      200      {object}  schema.APIKeyOut
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Reauthentication required"
+// @Failure      404      {string}  string        "API key not found"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/api_keys/{keyid} [patch]
+// .
+func (h AuthHandler) updateAPIKey(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	keyID, err := getParamID("keyid", c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schema.Errors{"key_id": err.Error()})
+		return
+	}
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.APIKeyUpdateForm)
+	key, err := h.manager.UpdateAPIKey(user, uint(keyID), form, c)
+	if err != nil {
+		if errors.Is(err, provider.ErrAPIKeyNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiKeyOut(key))
+}
+
+// RevokeAPIKey godoc
+// @Summary      Revoke API key
+// @Schemes
+// @Description  Revoke an API key of the current user
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        keyid    path      int true "API key id"
+// @Success      204
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      404      {string}  string        "API key not found"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/api_keys/{keyid} [delete]
+// .
+func (h AuthHandler) revokeAPIKey(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	keyID, err := getParamID("keyid", c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schema.Errors{"key_id": err.Error()})
+		return
+	}
+	if err = h.manager.RevokeAPIKey(user, uint(keyID), c); err != nil {
+		if errors.Is(err, provider.ErrAPIKeyNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func apiKeyOut(key model.APIKey) schema.APIKeyOut {
+	return schema.APIKeyOut{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     strings.Fields(key.Scopes),
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
@@ -6,10 +6,11 @@ import (
 	"gin-gorm-api/model"
 	"gin-gorm-api/provider"
 	"gin-gorm-api/schema"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // AuthHandler exposes its manager's methods as endpoints.
@@ -35,8 +36,13 @@ func NewAuthHandler(
 // @Produce      json
 // @Param        form     body      schema.LoginForm true "Login form"
 // @Success      200      {object}  schema.UserOut
+// @Success      202      {object}  schema.MFARequiredOut "Second factor required"
 // @Failure      400      {object}  schema.Errors "Bad request"
 // @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Email not verified"
+// @Failure      403      {object}  schema.Errors "Cross origin request"
+// @Failure      409      {object}  schema.Errors "Directory email in use"
+// @Failure      429      {object}  schema.Errors "Too many attempts"
 // @Failure      default  {string}  string        "Unexpected error"
 // @Router       /auth    [post]
 // .
@@ -45,13 +51,136 @@ func (h AuthHandler) login(c *gin.Context) {
 	form, _ := formData.(schema.LoginForm)
 	user, err := h.manager.Authenticate(form, c)
 	if err != nil {
-		c.Status(http.StatusForbidden)
+		handleLoginErrors(err, c)
+		return
+	}
+	if user.MFAEnabled() {
+		h.requireMFA(user, c)
+		return
+	}
+	h.startSession(user, c)
+}
+
+// startSession registers a session for user and responds with its
+// information.
+func (h AuthHandler) startSession(user model.User, c *gin.Context) {
+	if err := h.manager.RegisterSession(user, c); err != nil {
+		if errors.Is(err, provider.ErrTransportDisabled) {
+			c.JSON(http.StatusForbidden, schema.SimpleError(err))
+			return
+		}
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
 		return
 	}
-	if err = h.manager.RegisterSession(user, c); err != nil {
+	c.JSON(
+		http.StatusOK,
+		schema.UserOut{ID: user.ID, Username: user.Username, Email: user.Email},
+	)
+}
+
+// LoginToken godoc
+// @Summary      Login with bearer token
+// @Schemes
+// @Description  Start session and return its tokens instead of setting cookies
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.LoginForm true "Login form"
+// @Success      200      {object}  schema.TokenOut
+// @Success      202      {object}  schema.MFARequiredOut "Second factor required"
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Email not verified"
+// @Failure      409      {object}  schema.Errors "Directory email in use"
+// @Failure      429      {object}  schema.Errors "Too many attempts"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/token [post]
+// .
+func (h AuthHandler) loginToken(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.LoginForm)
+	user, err := h.manager.Authenticate(form, c)
+	if err != nil {
+		handleLoginErrors(err, c)
+		return
+	}
+	if user.MFAEnabled() {
+		h.requireMFA(user, c)
+		return
+	}
+	h.startBearerSession(user, c)
+}
+
+// startBearerSession registers a session for user and responds with its
+// tokens.
+func (h AuthHandler) startBearerSession(user model.User, c *gin.Context) {
+	tokens, err := h.manager.RegisterBearerSession(user, c)
+	if err != nil {
+		if errors.Is(err, provider.ErrTransportDisabled) {
+			c.JSON(http.StatusForbidden, schema.SimpleError(err))
+			return
+		}
 		_ = c.AbortWithError(http.StatusFailedDependency, err)
 		return
 	}
+	c.JSON(http.StatusOK, tokenOut(tokens))
+}
+
+// RefreshToken godoc
+// @Summary      Refresh bearer token
+// @Schemes
+// @Description  Renew session tokens using a refresh token
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.RefreshForm true "Refresh form"
+// @Success      200      {object}  schema.TokenOut
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/token/refresh [post]
+// .
+func (h AuthHandler) refreshToken(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.RefreshForm)
+	tokens, err := h.manager.RefreshBearerSession(form, c)
+	if err != nil {
+		handleTokenErrors(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, tokenOut(tokens))
+}
+
+func tokenOut(tokens provider.SessionTokens) schema.TokenOut {
+	return schema.TokenOut{
+		AccessToken:  tokens.Access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.Refresh,
+	}
+}
+
+// RefreshSession godoc
+// @Summary      Refresh session
+// @Schemes
+// @Description  Renew session tokens using the refresh token cookie
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Success      200      {object}  schema.UserOut
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      403      {object}  schema.Errors "Cross origin request"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/refresh [post]
+// .
+func (h AuthHandler) refresh(c *gin.Context) {
+	user, err := h.manager.RefreshSession(c)
+	if err != nil {
+		handleTokenErrors(err, c)
+		return
+	}
 	c.JSON(
 		http.StatusOK,
 		schema.UserOut{ID: user.ID, Username: user.Username, Email: user.Email},
@@ -71,7 +200,16 @@ func (h AuthHandler) login(c *gin.Context) {
 // @Router       /auth    [delete]
 // .
 func (h AuthHandler) logout(c *gin.Context) {
-	h.manager.RemoveSession(c)
+	credData, _ := c.Get(middleware.CredentialKey)
+	cred, ok := credData.(provider.Credential)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	if err := h.manager.RemoveSession(cred, c); err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
 	c.Status(http.StatusNoContent)
 }
 
@@ -100,17 +238,42 @@ func (h AuthHandler) me(c *gin.Context) {
 	)
 }
 
+// CSRFToken godoc
+// @Summary      Get CSRF token
+// @Schemes
+// @Description  Get the CSRF token that cookie authenticated requests that change state must send in the X-CSRF-Token header
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Success      200      {object}  schema.CSRFTokenOut
+// @Failure      403      {string}  string  "forbidden"
+// @Failure      default  {string}  string  "unexpected error"
+// @Router       /auth/csrf [get]
+// .
+func (h AuthHandler) csrfToken(c *gin.Context) {
+	credData, _ := c.Get(middleware.CredentialKey)
+	cred, ok := credData.(provider.Credential)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	token := h.manager.CSRFToken(cred.SessionID)
+	c.Header(provider.CSRFHeader, token)
+	c.JSON(http.StatusOK, schema.CSRFTokenOut{CSRFToken: token})
+}
+
 // RequestPasswordReset godoc
 // @Summary      Request password reset
 // @Schemes
-// @Description  Request a password reset message
+// @Description  Request a password reset message. Unknown emails are not reported
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
 // @Param        form     body      schema.PasswordResetRequestForm true "Password reset request form"
 // @Success      200
 // @Failure      400      {object}  schema.Errors "Bad request"
-// @Failure      404      {string}  string        "Email not found"
+// @Failure      403      {object}  schema.Errors "Managed by a directory"
+// @Failure      429      {object}  schema.Errors "Too many requests"
 // @Failure      default  {string}  string        "Unexpected error"
 // @Router       /auth/request_password_reset [post]
 // .
@@ -118,8 +281,14 @@ func (h AuthHandler) requestPasswordReset(c *gin.Context) {
 	formData, _ := c.Get("form")
 	form, _ := formData.(schema.PasswordResetRequestForm)
 	if err := h.manager.RequestPasswordReset(form, c); err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.Status(http.StatusNotFound)
+		if handleThrottle(err, c) {
+			return
+		}
+		if errors.Is(err, provider.ErrManagedUser) {
+			c.JSON(
+				http.StatusForbidden,
+				schema.SimpleError(provider.ErrManagedUser),
+			)
 			return
 		}
 		_ = c.AbortWithError(http.StatusFailedDependency, err)
@@ -154,9 +323,58 @@ func (h AuthHandler) resetPassword(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+// handleLoginErrors responds to the errors of a failed login. Whether the
+// credentials were wrong or unknown is not disclosed.
+func handleLoginErrors(err error, c *gin.Context) {
+	if handleThrottle(err, c) {
+		return
+	}
+	switch {
+	case errors.Is(err, provider.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, schema.SimpleError(err))
+	case errors.Is(err, provider.ErrDuplicateUser):
+		c.JSON(
+			http.StatusConflict,
+			schema.SimpleError(provider.ErrDuplicateUser),
+		)
+	case errors.Is(err, provider.ErrDirectory):
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+	default:
+		c.Status(http.StatusForbidden)
+	}
+}
+
+// handleThrottle responds with the time to wait before retrying if err is a
+// provider.ThrottleError and returns true if and only if it did so.
+func handleThrottle(err error, c *gin.Context) bool {
+	var throttleErr provider.ThrottleError
+	if !errors.As(err, &throttleErr) {
+		return false
+	}
+	setRetryAfter(throttleErr, c)
+	c.JSON(
+		http.StatusTooManyRequests,
+		schema.SimpleError(provider.ErrThrottled),
+	)
+	return true
+}
+
+// setRetryAfter tells the client how long to wait before retrying after
+// being throttled as described by err.
+func setRetryAfter(err provider.ThrottleError, c *gin.Context) {
+	seconds := int(math.Ceil(err.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+}
+
 func handleTokenErrors(err error, c *gin.Context) {
 	invalidToken := errors.Is(err, provider.ErrTokenExpired) ||
-		errors.Is(err, provider.ErrInvalidToken)
+		errors.Is(err, provider.ErrInvalidToken) ||
+		errors.Is(err, provider.ErrWrongTokenType) ||
+		errors.Is(err, provider.ErrWrongIssuer) ||
+		errors.Is(err, provider.ErrWrongAudience) ||
+		errors.Is(err, provider.ErrWrongClient) ||
+		errors.Is(err, provider.ErrTokenReused) ||
+		errors.Is(err, provider.ErrSessionRevoked)
 	if invalidToken {
 		c.JSON(http.StatusForbidden, schema.SimpleError(err))
 		return
@@ -175,6 +393,8 @@ func handleTokenErrors(err error, c *gin.Context) {
 // @Success      200
 // @Failure      400      {object}  schema.Errors "Bad request"
 // @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Managed by a directory"
+// @Failure      429      {object}  schema.Errors "Too many attempts"
 // @Failure      default  {string}  string        "Unexpected error"
 // @Router       /auth/change_password [post]
 // .
@@ -187,19 +407,350 @@ func (h AuthHandler) changePassword(c *gin.Context) {
 	}
 	formData, _ := c.Get("form")
 	form, _ := formData.(schema.PasswordChangeForm)
-	if err := h.manager.SetPassword(session, form, c); err != nil {
+	err := h.manager.SetPassword(session, form, c)
+	if err != nil && handleThrottle(err, c) {
+		return
+	}
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case errors.Is(err, provider.ErrInvalidCredentials):
+		c.Status(http.StatusForbidden)
+	case errors.Is(err, provider.ErrManagedUser):
+		c.JSON(
+			http.StatusForbidden,
+			schema.SimpleError(provider.ErrManagedUser),
+		)
+	default:
 		_ = c.AbortWithError(http.StatusFailedDependency, err)
+	}
+}
+
+// Reauthenticate godoc
+// @Summary      Reauthenticate
+// @Schemes
+// @Description  Prove the identity of the user of the current session again, as required before sensitive actions. Users with a second factor must also provide a TOTP or recovery code
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.ReauthenticationForm true "Reauthentication form"
+// @Success      200
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      429      {object}  schema.Errors "Too many attempts"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/reauthenticate [post]
+// .
+func (h AuthHandler) reauthenticate(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	session, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
 		return
 	}
-	c.Status(http.StatusOK)
+	credData, _ := c.Get(middleware.CredentialKey)
+	cred, ok := credData.(provider.Credential)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.ReauthenticationForm)
+	err := h.manager.Reauthenticate(session, cred, form, c)
+	if err != nil && handleThrottle(err, c) {
+		return
+	}
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case errors.Is(err, provider.ErrInvalidCredentials),
+		errors.Is(err, provider.ErrSessionRevoked):
+		c.Status(http.StatusForbidden)
+	default:
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+	}
 }
 
-// AddRoutes add a group of routes to r under the path "/auth".
+// ListSessions godoc
+// @Summary      List sessions
+// @Schemes
+// @Description  List the active sessions of the current user
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Success      200      {object}  []schema.SessionOut
+// @Failure      403      {string}  string  "Forbidden"
+// @Failure      default  {string}  string  "Unexpected error"
+// @Router       /auth/sessions [get]
+// .
+func (h AuthHandler) listSessions(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	credData, _ := c.Get(middleware.CredentialKey)
+	cred, _ := credData.(provider.Credential)
+	sessions, err := h.manager.ListSessions(user, c)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	out := make([]schema.SessionOut, len(sessions))
+	for i, s := range sessions {
+		out[i] = schema.SessionOut{
+			ID:         s.ID,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			ClientID:   s.ClientID,
+			Current:    s.ID == cred.SessionID,
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// RevokeSession godoc
+// @Summary      Revoke session
+// @Schemes
+// @Description  Revoke one of the current user's sessions
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        sessionid   path      string true "Session id"
+// @Success      204
+// @Failure      403         {string}  string  "Forbidden"
+// @Failure      404         {string}  string  "Session not found"
+// @Failure      default     {string}  string  "Unexpected error"
+// @Router       /auth/sessions/{sessionid} [delete]
+// .
+func (h AuthHandler) revokeSession(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	err := h.manager.RevokeSession(user, c.Param("sessionid"), c)
+	if err != nil {
+		if errors.Is(err, provider.ErrSessionNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeAllSessions godoc
+// @Summary      Logout everywhere
+// @Schemes
+// @Description  Revoke every session of the current user
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Success      204
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Reauthentication required"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/sessions [delete]
+// .
+func (h AuthHandler) revokeAllSessions(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	credData, _ := c.Get(middleware.CredentialKey)
+	cred, _ := credData.(provider.Credential)
+	if err := h.manager.RevokeUserSessions(user, c); err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	if err := h.manager.RemoveSession(cred, c); err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// JWKS godoc
+// @Summary      JSON Web Key Set
+// @Schemes
+// @Description  Public keys that verify issued JSON Web Tokens
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Success      200      {object}  schema.JWKSOut
+// @Failure      404      {string}  string  "Tokens are not signed with public keys"
+// @Router       /.well-known/jwks.json [get]
+// .
+func (h AuthHandler) jwks(c *gin.Context) {
+	jwks := h.manager.JWKS()
+	if len(jwks) == 0 {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	out := schema.JWKSOut{Keys: make([]schema.JWKOut, len(jwks))}
+	for i, jwk := range jwks {
+		out.Keys[i] = schema.JWKOut{
+			KeyType:   jwk.KeyType,
+			KeyID:     jwk.KeyID,
+			Algorithm: jwk.Algorithm,
+			Use:       "sig",
+			Curve:     jwk.Curve,
+			X:         jwk.X,
+			Y:         jwk.Y,
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// AddRoutes add a group of routes to r under the path "/auth" along with the
+// "/.well-known/jwks.json" route.
 func (h AuthHandler) AddRoutes(r *gin.Engine) {
+	r.GET("/.well-known/jwks.json", h.jwks)
 	g := r.Group("/auth")
-	g.POST("/", middleware.FormValidation[schema.LoginForm](), h.login)
+	g.POST(
+		"/",
+		middleware.SameOrigin(),
+		middleware.FormValidation[schema.LoginForm](),
+		h.login,
+	)
+	g.POST("/token", middleware.FormValidation[schema.LoginForm](), h.loginToken)
+	g.POST(
+		"/token/refresh",
+		middleware.FormValidation[schema.RefreshForm](),
+		h.refreshToken,
+	)
+	g.POST(
+		"/token/mfa",
+		middleware.FormValidation[schema.MFAForm](),
+		h.completeMFAToken,
+	)
+	g.POST(
+		"/mfa",
+		middleware.SameOrigin(),
+		middleware.FormValidation[schema.MFAForm](),
+		h.completeMFA,
+	)
+	g.POST("/refresh", middleware.SameOrigin(), h.refresh)
 	g.DELETE("/", h.authMW, h.logout)
-	g.GET("/me", h.authMW, h.me)
+	g.GET("/csrf", h.authMW, h.csrfToken)
+	g.GET(
+		"/me",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserRead),
+		h.me,
+	)
+	g.GET(
+		"/sessions",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeSessionRead),
+		h.listSessions,
+	)
+	g.DELETE(
+		"/sessions",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeSessionWrite),
+		middleware.RequireReauthentication(h.manager),
+		h.revokeAllSessions,
+	)
+	g.DELETE(
+		"/sessions/:sessionid",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeSessionWrite),
+		h.revokeSession,
+	)
+	g.POST(
+		"/api_keys",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeAPIKeyWrite),
+		middleware.RequireReauthentication(h.manager),
+		middleware.FormValidation[schema.APIKeyForm](),
+		h.createAPIKey,
+	)
+	g.GET(
+		"/api_keys",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeAPIKeyRead),
+		h.listAPIKeys,
+	)
+	g.PATCH(
+		"/api_keys/:keyid",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeAPIKeyWrite),
+		middleware.RequireReauthentication(h.manager),
+		middleware.FormValidation[schema.APIKeyUpdateForm](),
+		h.updateAPIKey,
+	)
+	g.DELETE(
+		"/api_keys/:keyid",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeAPIKeyWrite),
+		h.revokeAPIKey,
+	)
+	g.POST(
+		"/totp",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserWrite),
+		middleware.RequireReauthentication(h.manager),
+		h.enrollTOTP,
+	)
+	g.POST(
+		"/totp/confirm",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserWrite),
+		middleware.FormValidation[schema.TOTPCodeForm](),
+		h.confirmTOTP,
+	)
+	g.POST(
+		"/totp/disable",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserWrite),
+		middleware.RequireReauthentication(h.manager),
+		middleware.FormValidation[schema.TOTPCodeForm](),
+		h.disableTOTP,
+	)
+	g.POST(
+		"/webauthn/register",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserWrite),
+		middleware.RequireReauthentication(h.manager),
+		h.beginWebAuthnRegistration,
+	)
+	g.POST(
+		"/webauthn/register/complete",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserWrite),
+		middleware.FormValidation[schema.WebAuthnRegistrationForm](),
+		h.completeWebAuthnRegistration,
+	)
+	g.GET(
+		"/webauthn/credentials",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserRead),
+		h.listWebAuthnCredentials,
+	)
+	g.DELETE(
+		"/webauthn/credentials/:credentialid",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserWrite),
+		middleware.RequireReauthentication(h.manager),
+		h.deleteWebAuthnCredential,
+	)
+	g.POST("/webauthn/login", h.beginWebAuthnLogin)
+	g.POST(
+		"/webauthn/login/complete",
+		middleware.SameOrigin(),
+		middleware.FormValidation[schema.WebAuthnLoginForm](),
+		h.completeWebAuthnLogin,
+	)
 	g.POST(
 		"/request_password_reset",
 		middleware.FormValidation[schema.PasswordResetRequestForm](),
@@ -210,10 +761,58 @@ func (h AuthHandler) AddRoutes(r *gin.Engine) {
 		middleware.FormValidation[schema.PasswordResetForm](),
 		h.resetPassword,
 	)
+	g.POST(
+		"/magic_link",
+		middleware.FormValidation[schema.MagicLinkRequestForm](),
+		h.requestMagicLink,
+	)
+	g.POST(
+		"/magic_link/consume",
+		middleware.SameOrigin(),
+		middleware.FormValidation[schema.MagicLinkForm](),
+		h.consumeMagicLink,
+	)
+	g.GET("/oidc", h.listOIDCProviders)
+	g.GET("/oidc/callback", h.completeOIDC)
+	g.GET("/oidc/:provider", h.startOIDC)
+	g.POST(
+		"/verify_email",
+		middleware.FormValidation[schema.EmailVerificationForm](),
+		h.verifyEmail,
+	)
+	g.POST(
+		"/resend_email_verification",
+		middleware.FormValidation[schema.EmailVerificationRequestForm](),
+		h.resendEmailVerification,
+	)
 	g.POST(
 		"/change_password",
 		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserWrite),
 		middleware.FormValidation[schema.PasswordChangeForm](),
 		h.changePassword,
 	)
+	g.POST(
+		"/reauthenticate",
+		h.authMW,
+		middleware.FormValidation[schema.ReauthenticationForm](),
+		h.reauthenticate,
+	)
+	g.POST(
+		"/change_email",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserWrite),
+		middleware.FormValidation[schema.EmailChangeForm](),
+		h.changeEmail,
+	)
+	g.POST(
+		"/confirm_email_change",
+		middleware.FormValidation[schema.EmailChangeTokenForm](),
+		h.confirmEmailChange,
+	)
+	g.POST(
+		"/revert_email_change",
+		middleware.FormValidation[schema.EmailChangeTokenForm](),
+		h.revertEmailChange,
+	)
 }
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"errors"
+	"gin-gorm-api/model"
+	"gin-gorm-api/provider"
+	"gin-gorm-api/schema"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// VerifyEmail godoc
+// @Summary      Verify email
+// @Schemes
+// @Description  Verify the email address of a user with the token sent to it
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.EmailVerificationForm true "Email verification form"
+// @Success      200
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/verify_email [post]
+// .
+func (h AuthHandler) verifyEmail(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.EmailVerificationForm)
+	if err := h.manager.VerifyEmail(form, c); err != nil {
+		handleTokenErrors(err, c)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// ResendEmailVerification godoc
+// @Summary      Resend email verification
+// @Schemes
+// @Description  Send a new email verification message. If users are hidden unknown and verified emails are not reported
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.EmailVerificationRequestForm true "Email verification request form"
+// @Success      200
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      404      {string}  string        "Email not found"
+// @Failure      409      {object}  schema.Errors "Already verified"
+// @Failure      429      {object}  schema.Errors "Too many requests"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/resend_email_verification [post]
+// .
+func (h AuthHandler) resendEmailVerification(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.EmailVerificationRequestForm)
+	err := h.manager.ResendEmailVerification(form, c)
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case handleThrottle(err, c):
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, provider.ErrEmailVerified):
+		c.JSON(http.StatusConflict, schema.SimpleError(err))
+	default:
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+	}
+}
+
+// ChangeEmail godoc
+// @Summary      Change email
+// @Schemes
+// @Description  Request a change of email address. A confirmation code is sent to the new address and a notice with a link to undo the change to the current one. If users are hidden an address in use is not reported
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.EmailChangeForm true "Email change form"
+// @Success      202
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Managed by a directory"
+// @Failure      409      {object}  schema.Errors "Email in use"
+// @Failure      429      {object}  schema.Errors "Too many attempts"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/change_email [post]
+// .
+func (h AuthHandler) changeEmail(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	session, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.EmailChangeForm)
+	err := h.manager.RequestEmailChange(session, form, c)
+	if err != nil && handleThrottle(err, c) {
+		return
+	}
+	switch {
+	case err == nil:
+		c.Status(http.StatusAccepted)
+	case errors.Is(err, provider.ErrInvalidCredentials):
+		c.Status(http.StatusForbidden)
+	case errors.Is(err, provider.ErrManagedUser):
+		c.JSON(
+			http.StatusForbidden,
+			schema.SimpleError(provider.ErrManagedUser),
+		)
+	case errors.Is(err, provider.ErrDuplicateUser):
+		c.JSON(
+			http.StatusConflict,
+			schema.SimpleError(provider.ErrDuplicateUser),
+		)
+	default:
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+	}
+}
+
+// ConfirmEmailChange godoc
+// @Summary      Confirm email change
+// @Schemes
+// @Description  Change the email address of a user to the one the code was sent to
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.EmailChangeTokenForm true "Email change token form"
+// @Success      200
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      409      {object}  schema.Errors "Email in use"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/confirm_email_change [post]
+// .
+func (h AuthHandler) confirmEmailChange(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.EmailChangeTokenForm)
+	handleEmailChangeErrors(h.manager.ConfirmEmailChange(form, c), c)
+}
+
+// RevertEmailChange godoc
+// @Summary      Revert email change
+// @Schemes
+// @Description  Restore the email address of a user to the one the link was sent to, logging out every session
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.EmailChangeTokenForm true "Email change token form"
+// @Success      200
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      409      {object}  schema.Errors "Email in use"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/revert_email_change [post]
+// .
+func (h AuthHandler) revertEmailChange(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.EmailChangeTokenForm)
+	handleEmailChangeErrors(h.manager.RevertEmailChange(form, c), c)
+}
+
+func handleEmailChangeErrors(err error, c *gin.Context) {
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case errors.Is(err, provider.ErrDuplicateUser):
+		c.JSON(
+			http.StatusConflict,
+			schema.SimpleError(provider.ErrDuplicateUser),
+		)
+	default:
+		handleTokenErrors(err, c)
+	}
+}
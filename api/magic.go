@@ -0,0 +1,66 @@
+package api
+
+import (
+	"gin-gorm-api/schema"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMagicLink godoc
+// @Summary      Request magic link
+// @Schemes
+// @Description  Send a single use login link to an email address if it belongs to a user
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.MagicLinkRequestForm true "Magic link request form"
+// @Success      200
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      429      {object}  schema.Errors "Too many requests"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/magic_link [post]
+// .
+func (h AuthHandler) requestMagicLink(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.MagicLinkRequestForm)
+	if err := h.manager.RequestMagicLink(form, c); err != nil {
+		if !handleThrottle(err, c) {
+			_ = c.AbortWithError(http.StatusFailedDependency, err)
+		}
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// ConsumeMagicLink godoc
+// @Summary      Consume magic link
+// @Schemes
+// @Description  Start session with the token of a magic link
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.MagicLinkForm true "Magic link form"
+// @Success      200      {object}  schema.UserOut
+// @Success      202      {object}  schema.MFARequiredOut "Second factor required"
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      403      {object}  schema.Errors "Cross origin request"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/magic_link/consume [post]
+// .
+func (h AuthHandler) consumeMagicLink(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.MagicLinkForm)
+	user, err := h.manager.ConsumeMagicLink(form, c)
+	if err != nil {
+		handleTokenErrors(err, c)
+		return
+	}
+	if user.MFAEnabled() {
+		h.requireMFA(user, c)
+		return
+	}
+	h.startSession(user, c)
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"errors"
+	"gin-gorm-api/model"
+	"gin-gorm-api/provider"
+	"gin-gorm-api/schema"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireMFA responds with the token user needs to complete its login with a
+// second factor.
+func (h AuthHandler) requireMFA(user model.User, c *gin.Context) {
+	token, err := h.manager.RequestMFA(user)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, schema.MFARequiredOut{MFAToken: token})
+}
+
+// CompleteMFA godoc
+// @Summary      Complete login
+// @Schemes
+// @Description  Start session by providing the second factor of a login
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.MFAForm true "MFA form"
+// @Success      200      {object}  schema.UserOut
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      403      {object}  schema.Errors "Cross origin request"
+// @Failure      429      {object}  schema.Errors "Too many attempts"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/mfa [post]
+// .
+func (h AuthHandler) completeMFA(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.MFAForm)
+	user, err := h.manager.CompleteMFA(form, c)
+	if err != nil {
+		if !handleThrottle(err, c) {
+			handleTokenErrors(err, c)
+		}
+		return
+	}
+	h.startSession(user, c)
+}
+
+// CompleteMFAToken godoc
+// @Summary      Complete login with bearer token
+// @Schemes
+// @Description  Start session by providing the second factor of a login and return its tokens
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.MFAForm true "MFA form"
+// @Success      200      {object}  schema.TokenOut
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      429      {object}  schema.Errors "Too many attempts"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/token/mfa [post]
+// .
+func (h AuthHandler) completeMFAToken(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.MFAForm)
+	user, err := h.manager.CompleteMFA(form, c)
+	if err != nil {
+		if !handleThrottle(err, c) {
+			handleTokenErrors(err, c)
+		}
+		return
+	}
+	h.startBearerSession(user, c)
+}
+
+// EnrollTOTP godoc
+// @Summary      Enroll TOTP
+// @Schemes
+// @Description  Generate a TOTP secret that must be confirmed before use
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Success      200      {object}  schema.TOTPEnrollmentOut
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Reauthentication required"
+// @Failure      409      {object}  schema.Errors "Already enabled"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/totp [post]
+// .
+func (h AuthHandler) enrollTOTP(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	enrollment, err := h.manager.EnrollTOTP(user, c)
+	if err != nil {
+		handleMFAErrors(err, c)
+		return
+	}
+	c.JSON(
+		http.StatusOK,
+		schema.TOTPEnrollmentOut{
+			Secret: enrollment.Secret,
+			URI:    enrollment.URI,
+		},
+	)
+}
+
+// ConfirmTOTP godoc
+// @Summary      Confirm TOTP
+// @Schemes
+// @Description  Enable the enrolled TOTP secret and get recovery codes
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.TOTPCodeForm true "TOTP code form"
+// @Success      200      {object}  schema.RecoveryCodesOut
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      409      {object}  schema.Errors "Not enrolled or already enabled"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/totp/confirm [post]
+// .
+func (h AuthHandler) confirmTOTP(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.TOTPCodeForm)
+	codes, err := h.manager.ConfirmTOTP(user, form, c)
+	if err != nil {
+		handleMFAErrors(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, schema.RecoveryCodesOut{RecoveryCodes: codes})
+}
+
+// DisableTOTP godoc
+// @Summary      Disable TOTP
+// @Schemes
+// @Description  Disable TOTP using a valid TOTP or recovery code
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.TOTPCodeForm true "TOTP code form"
+// @Success      204
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Reauthentication required"
+// @Failure      409      {object}  schema.Errors "Not enabled"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/totp/disable [post]
+// .
+func (h AuthHandler) disableTOTP(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.TOTPCodeForm)
+	if err := h.manager.DisableTOTP(user, form, c); err != nil {
+		handleMFAErrors(err, c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func handleMFAErrors(err error, c *gin.Context) {
+	switch {
+	case errors.Is(err, provider.ErrMFAEnabled),
+		errors.Is(err, provider.ErrMFANotEnrolled):
+		c.JSON(http.StatusConflict, schema.SimpleError(err))
+	case errors.Is(err, provider.ErrInvalidCredentials):
+		c.Status(http.StatusForbidden)
+	default:
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+	}
+}
@@ -0,0 +1,510 @@
+package api
+
+import (
+	"errors"
+	"gin-gorm-api/middleware"
+	"gin-gorm-api/model"
+	"gin-gorm-api/provider"
+	"gin-gorm-api/schema"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// OAuthHandler exposes the endpoints of the OAuth2 authorization server.
+type OAuthHandler struct {
+	manager provider.UserAuthManager
+	authMW  gin.HandlerFunc
+}
+
+// NewOAuthHandler returns a new OAuthHandler.
+func NewOAuthHandler(
+	manager provider.UserAuthManager,
+	authMW gin.HandlerFunc,
+) OAuthHandler {
+	return OAuthHandler{manager, authMW}
+}
+
+// RegisterOAuthClient godoc
+// @Summary      Register OAuth client
+// @Schemes
+// @Description  Register an OAuth client owned by the current user. Confidential clients are given a secret that is only shown once
+// @Tags         OAuth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.OAuthClientForm true "OAuth client form"
+// @Success      201      {object}  schema.NewOAuthClientOut
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Scope not granted"
+// @Failure      403      {object}  schema.Errors "Reauthentication required"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /oauth/clients [post]
+// .
+func (h OAuthHandler) registerClient(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	credData, _ := c.Get(middleware.CredentialKey)
+	cred, _ := credData.(provider.Credential)
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.OAuthClientForm)
+	client, secret, err := h.manager.RegisterOAuthClient(user, cred, form, c)
+	if err != nil {
+		switch {
+		case errors.Is(err, provider.ErrUnknownScope):
+			c.JSON(http.StatusBadRequest, schema.Errors{"scopes": err.Error()})
+		case errors.Is(err, provider.ErrInvalidRedirectURI):
+			c.JSON(
+				http.StatusBadRequest,
+				schema.Errors{"redirect_uris": err.Error()},
+			)
+		case errors.Is(err, provider.ErrScopeNotGranted):
+			c.JSON(http.StatusForbidden, schema.SimpleError(err))
+		default:
+			_ = c.AbortWithError(http.StatusFailedDependency, err)
+		}
+		return
+	}
+	c.JSON(
+		http.StatusCreated,
+		schema.NewOAuthClientOut{
+			OAuthClientOut: oauthClientOut(client),
+			ClientSecret:   secret,
+		},
+	)
+}
+
+// ListOAuthClients godoc
+// @Summary      List OAuth clients
+// @Schemes
+// @Description  List the OAuth clients owned by the current user
+// @Tags         OAuth
+// @Produce      json
+// @Success      200      {object}  []schema.OAuthClientOut
+// @Failure      403      {string}  string  "Forbidden"
+// @Failure      default  {string}  string  "Unexpected error"
+// @Router       /oauth/clients [get]
+// .
+func (h OAuthHandler) listClients(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	clients, err := h.manager.ListOAuthClients(user, c)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	out := make([]schema.OAuthClientOut, len(clients))
+	for i, client := range clients {
+		out[i] = oauthClientOut(client)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// RevokeOAuthClient godoc
+// @Summary      Revoke OAuth client
+// @Schemes
+// @Description  Revoke an OAuth client owned by the current user along with every token granted to it
+// @Tags         OAuth
+// @Produce      json
+// @Param        clientid path      string true "Client id"
+// @Success      204
+// @Failure      403      {string}  string  "Forbidden"
+// @Failure      404      {string}  string  "OAuth client not found"
+// @Failure      default  {string}  string  "Unexpected error"
+// @Router       /oauth/clients/{clientid} [delete]
+// .
+func (h OAuthHandler) revokeClient(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	err := h.manager.RevokeOAuthClient(user, c.Param("clientid"), c)
+	if err != nil {
+		if errors.Is(err, provider.ErrOAuthClientNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func oauthClientOut(client model.OAuthClient) schema.OAuthClientOut {
+	return schema.OAuthClientOut{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: strings.Fields(client.RedirectURIs),
+		Scopes:       strings.Fields(client.Scopes),
+		Confidential: client.Confidential(),
+		CreatedAt:    client.CreatedAt,
+		RevokedAt:    client.RevokedAt,
+	}
+}
+
+// GetAuthorization godoc
+// @Summary      Get authorization request
+// @Schemes
+// @Description  Validate an authorization request, as described by RFC 6749 section 4.1.1, and describe what the current user is asked to consent to. If the request is invalid but the client can be told, redirect_to holds where to send the user back to
+// @Tags         OAuth
+// @Produce      json
+// @Param        response_type         query  string true  "Must be code"
+// @Param        client_id             query  string true  "Client id"
+// @Param        redirect_uri          query  string false "Redirect URI"
+// @Param        scope                 query  string false "Space separated scopes"
+// @Param        state                 query  string false "State"
+// @Param        code_challenge        query  string false "PKCE challenge"
+// @Param        code_challenge_method query  string false "Must be S256"
+// @Success      200      {object}  schema.OAuthConsentOut
+// @Failure      400      {object}  schema.OAuthErrorOut "Invalid request"
+// @Failure      403      {object}  schema.Errors        "Forbidden"
+// @Failure      default  {string}  string               "Unexpected error"
+// @Router       /oauth/authorize [get]
+// .
+func (h OAuthHandler) getAuthorization(c *gin.Context) {
+	credData, _ := c.Get(middleware.CredentialKey)
+	cred, _ := credData.(provider.Credential)
+	var form schema.OAuthAuthorizeForm
+	if err := c.ShouldBindQuery(&form); err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			schema.OAuthErrorOut{Error: "invalid_request"},
+		)
+		return
+	}
+	valErrs, err := form.Validate()
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if valErrs != nil {
+		c.JSON(http.StatusBadRequest, valErrs)
+		return
+	}
+	auth, err := h.manager.AuthorizationRequest(cred, form, c)
+	if err != nil {
+		handleAuthorizationErrors(auth, err, c)
+		return
+	}
+	c.JSON(http.StatusOK, schema.OAuthConsentOut{
+		ClientID:    auth.Client.ID,
+		ClientName:  auth.Client.Name,
+		RedirectURI: auth.RedirectURI,
+		Scopes:      auth.Scopes,
+	})
+}
+
+// Authorize godoc
+// @Summary      Decide authorization request
+// @Schemes
+// @Description  Approve or deny an authorization request on behalf of the current user and get where to send the user back to, with an authorization code if approved
+// @Tags         OAuth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.OAuthConsentForm true "Consent form"
+// @Success      200      {object}  schema.OAuthRedirectOut
+// @Failure      400      {object}  schema.OAuthErrorOut "Invalid request"
+// @Failure      403      {object}  schema.Errors        "Forbidden"
+// @Failure      default  {string}  string               "Unexpected error"
+// @Router       /oauth/authorize [post]
+// .
+func (h OAuthHandler) authorize(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	credData, _ := c.Get(middleware.CredentialKey)
+	cred, _ := credData.(provider.Credential)
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.OAuthConsentForm)
+	auth, err := h.manager.AuthorizationRequest(
+		cred,
+		form.OAuthAuthorizeForm,
+		c,
+	)
+	if err != nil {
+		handleAuthorizationErrors(auth, err, c)
+		return
+	}
+	if !form.Approve {
+		c.JSON(http.StatusOK, schema.OAuthRedirectOut{
+			RedirectTo: auth.ErrorRedirect("access_denied", ""),
+		})
+		return
+	}
+	link, err := h.manager.ApproveAuthorization(user, auth, c)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.JSON(http.StatusOK, schema.OAuthRedirectOut{RedirectTo: link})
+}
+
+// handleAuthorizationErrors responds to an invalid authorization request.
+// Once its redirect URI is known to be registered the error is also encoded
+// in where to send the user back to, as described by RFC 6749 section
+// 4.1.2.1.
+func handleAuthorizationErrors(
+	auth provider.OAuthAuthorization,
+	err error,
+	c *gin.Context,
+) {
+	if errors.Is(err, provider.ErrFirstPartyOnly) {
+		c.JSON(http.StatusForbidden, schema.SimpleError(err))
+		return
+	}
+	code, _ := oauthErrorCode(err)
+	if code == "" {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	out := schema.OAuthErrorOut{Error: code, ErrorDescription: err.Error()}
+	if auth.RedirectURI != "" {
+		out.RedirectTo = auth.ErrorRedirect(code, "")
+	}
+	c.JSON(http.StatusBadRequest, out)
+}
+
+// OAuthToken godoc
+// @Summary      Issue OAuth tokens
+// @Schemes
+// @Description  Exchange an authorization code, a refresh token or the client's own credentials for tokens as described by RFC 6749. Clients authenticate with HTTP basic authentication or the client_id and client_secret parameters
+// @Tags         OAuth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        grant_type     formData  string true  "authorization_code, refresh_token or client_credentials"
+// @Param        code           formData  string false "Authorization code"
+// @Param        redirect_uri   formData  string false "Redirect URI of the authorization request"
+// @Param        code_verifier  formData  string false "PKCE verifier"
+// @Param        refresh_token  formData  string false "Refresh token"
+// @Param        scope          formData  string false "Space separated scopes"
+// @Param        client_id      formData  string false "Client id"
+// @Param        client_secret  formData  string false "Client secret"
+// @Success      200      {object}  schema.OAuthTokenOut
+// @Failure      400      {object}  schema.OAuthErrorOut "Invalid request"
+// @Failure      401      {object}  schema.OAuthErrorOut "Invalid client"
+// @Failure      429      {object}  schema.OAuthErrorOut "Owner locked out"
+// @Failure      default  {string}  string               "Unexpected error"
+// @Router       /oauth/token [post]
+// .
+func (h OAuthHandler) token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	var form schema.OAuthTokenForm
+	if err := c.ShouldBindWith(&form, binding.FormPost); err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			schema.OAuthErrorOut{Error: "invalid_request"},
+		)
+		return
+	}
+	id, secret := clientCredentials(c)
+	tokens, err := h.manager.OAuthToken(id, secret, form, c)
+	if err != nil {
+		handleOAuthErrors(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, schema.OAuthTokenOut{
+		AccessToken:  tokens.Access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.Refresh,
+		Scope:        strings.Join(tokens.Scopes, " "),
+	})
+}
+
+// IntrospectOAuthToken godoc
+// @Summary      Introspect OAuth token
+// @Schemes
+// @Description  Describe an access or refresh token granted to the confidential client as described by RFC 7662. Tokens that are not valid or were granted to other clients are inactive
+// @Tags         OAuth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token            formData  string true  "Token"
+// @Param        token_type_hint  formData  string false "Ignored"
+// @Param        client_id        formData  string false "Client id"
+// @Param        client_secret    formData  string false "Client secret"
+// @Success      200      {object}  schema.OAuthIntrospectionOut
+// @Failure      400      {object}  schema.OAuthErrorOut "Public client"
+// @Failure      401      {object}  schema.OAuthErrorOut "Invalid client"
+// @Failure      default  {string}  string               "Unexpected error"
+// @Router       /oauth/introspect [post]
+// .
+func (h OAuthHandler) introspect(c *gin.Context) {
+	var form schema.OAuthTokenHintForm
+	if err := c.ShouldBindWith(&form, binding.FormPost); err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			schema.OAuthErrorOut{Error: "invalid_request"},
+		)
+		return
+	}
+	id, secret := clientCredentials(c)
+	desc, err := h.manager.IntrospectOAuthToken(id, secret, form.Token, c)
+	if err != nil {
+		handleOAuthErrors(err, c)
+		return
+	}
+	if !desc.Active {
+		c.JSON(http.StatusOK, schema.OAuthIntrospectionOut{})
+		return
+	}
+	c.JSON(http.StatusOK, schema.OAuthIntrospectionOut{
+		Active:    true,
+		Scope:     strings.Join(desc.Scopes, " "),
+		ClientID:  desc.ClientID,
+		Username:  desc.Username,
+		TokenType: desc.TokenType,
+		ExpiresAt: desc.ExpiresAt.Unix(),
+		IssuedAt:  desc.IssuedAt.Unix(),
+		Subject:   strconv.FormatUint(uint64(desc.UserID), 10),
+		Audience:  desc.Audience,
+		Issuer:    desc.Issuer,
+	})
+}
+
+// RevokeOAuthToken godoc
+// @Summary      Revoke OAuth token
+// @Schemes
+// @Description  Revoke an access or refresh token granted to the client, along with every other token of its grant, as described by RFC 7009. Tokens that are not valid or were granted to other clients are ignored
+// @Tags         OAuth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token            formData  string true  "Token"
+// @Param        token_type_hint  formData  string false "Ignored"
+// @Param        client_id        formData  string false "Client id"
+// @Param        client_secret    formData  string false "Client secret"
+// @Success      200
+// @Failure      401      {object}  schema.OAuthErrorOut "Invalid client"
+// @Failure      default  {string}  string               "Unexpected error"
+// @Router       /oauth/revoke [post]
+// .
+func (h OAuthHandler) revoke(c *gin.Context) {
+	var form schema.OAuthTokenHintForm
+	if err := c.ShouldBindWith(&form, binding.FormPost); err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			schema.OAuthErrorOut{Error: "invalid_request"},
+		)
+		return
+	}
+	id, secret := clientCredentials(c)
+	if err := h.manager.RevokeOAuthToken(id, secret, form.Token, c); err != nil {
+		handleOAuthErrors(err, c)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// clientCredentials returns the client identifier and secret of the request
+// taken from its basic authorization header, or otherwise its body, as
+// described by RFC 6749 section 2.3.1.
+func clientCredentials(c *gin.Context) (string, string) {
+	id, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		return c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	// Both are form encoded before being sent.
+	if unescaped, err := url.QueryUnescape(id); err == nil {
+		id = unescaped
+	}
+	if unescaped, err := url.QueryUnescape(secret); err == nil {
+		secret = unescaped
+	}
+	return id, secret
+}
+
+// oauthErrorCode returns the error code, as described by RFC 6749 section
+// 5.2, and status used to report err. The code is empty for unexpected
+// errors.
+func oauthErrorCode(err error) (string, int) {
+	switch {
+	case errors.Is(err, provider.ErrInvalidClient):
+		return "invalid_client", http.StatusUnauthorized
+	case errors.Is(err, provider.ErrInvalidGrant):
+		return "invalid_grant", http.StatusBadRequest
+	case errors.Is(err, provider.ErrInvalidScope):
+		return "invalid_scope", http.StatusBadRequest
+	case errors.Is(err, provider.ErrUnauthorizedClient):
+		return "unauthorized_client", http.StatusBadRequest
+	case errors.Is(err, provider.ErrUnsupportedGrantType):
+		return "unsupported_grant_type", http.StatusBadRequest
+	case errors.Is(err, provider.ErrUnsupportedResponseType):
+		return "unsupported_response_type", http.StatusBadRequest
+	case errors.Is(err, provider.ErrInvalidOAuthRequest),
+		errors.Is(err, provider.ErrInvalidRedirectURI):
+		return "invalid_request", http.StatusBadRequest
+	case errors.Is(err, provider.ErrThrottled):
+		return "invalid_grant", http.StatusTooManyRequests
+	}
+	return "", 0
+}
+
+func handleOAuthErrors(err error, c *gin.Context) {
+	code, status := oauthErrorCode(err)
+	if code == "" {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	if status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	var throttleErr provider.ThrottleError
+	if errors.As(err, &throttleErr) {
+		setRetryAfter(throttleErr, c)
+	}
+	c.JSON(status, schema.OAuthErrorOut{
+		Error:            code,
+		ErrorDescription: err.Error(),
+	})
+}
+
+// AddRoutes add a group of routes to r under the path "/oauth".
+func (h OAuthHandler) AddRoutes(r *gin.Engine) {
+	g := r.Group("/oauth")
+	g.POST(
+		"/clients",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeClientWrite),
+		middleware.RequireReauthentication(h.manager),
+		middleware.FormValidation[schema.OAuthClientForm](),
+		h.registerClient,
+	)
+	g.GET(
+		"/clients",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeClientRead),
+		h.listClients,
+	)
+	g.DELETE(
+		"/clients/:clientid",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeClientWrite),
+		h.revokeClient,
+	)
+	g.GET("/authorize", h.authMW, h.getAuthorization)
+	g.POST(
+		"/authorize",
+		h.authMW,
+		middleware.FormValidation[schema.OAuthConsentForm](),
+		h.authorize,
+	)
+	g.POST("/token", h.token)
+	g.POST("/introspect", h.introspect)
+	g.POST("/revoke", h.revoke)
+}
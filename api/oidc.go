@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"gin-gorm-api/provider"
+	"gin-gorm-api/schema"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListOIDCProviders godoc
+// @Summary      List identity providers
+// @Schemes
+// @Description  List the OpenID Connect identity providers users can log in with
+// @Tags         Auth
+// @Produce      json
+// @Success      200      {object}  schema.OIDCProvidersOut
+// @Router       /auth/oidc [get]
+// .
+func (h AuthHandler) listOIDCProviders(c *gin.Context) {
+	c.JSON(
+		http.StatusOK,
+		schema.OIDCProvidersOut{Providers: h.manager.OIDCProviders()},
+	)
+}
+
+// StartOIDC godoc
+// @Summary      Start identity provider login
+// @Schemes
+// @Description  Redirect to an OpenID Connect identity provider to log in there
+// @Tags         Auth
+// @Param        provider path      string true "Provider name"
+// @Success      302
+// @Failure      404      {string}  string  "Provider not found"
+// @Failure      default  {string}  string  "Unexpected error"
+// @Router       /auth/oidc/{provider} [get]
+// .
+func (h AuthHandler) startOIDC(c *gin.Context) {
+	link, err := h.manager.StartOIDC(c.Param("provider"), c)
+	switch {
+	case err == nil:
+		c.Redirect(http.StatusFound, link)
+	case errors.Is(err, provider.ErrUnknownProvider):
+		c.Status(http.StatusNotFound)
+	default:
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+	}
+}
+
+// CompleteOIDC godoc
+// @Summary      Complete identity provider login
+// @Schemes
+// @Description  Start session as the user linked to the identity vouched for by an OpenID Connect identity provider. Identities are linked on their first login
+// @Tags         Auth
+// @Produce      json
+// @Param        state    query     string true  "State"
+// @Param        code     query     string false "Authorization code"
+// @Param        error    query     string false "Error"
+// @Success      200      {object}  schema.UserOut
+// @Success      202      {object}  schema.MFARequiredOut "Second factor required"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      409      {object}  schema.Errors "Email in use"
+// @Failure      429      {object}  schema.Errors "Too many attempts"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/oidc/callback [get]
+// .
+func (h AuthHandler) completeOIDC(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		// As described in RFC 6749 section 4.1.2.1.
+		c.JSON(http.StatusForbidden, schema.Errors{"error": reason})
+		return
+	}
+	user, err := h.manager.CompleteOIDC(c.Query("state"), c.Query("code"), c)
+	if err != nil {
+		handleOIDCErrors(err, c)
+		return
+	}
+	if user.MFAEnabled() {
+		h.requireMFA(user, c)
+		return
+	}
+	h.startSession(user, c)
+}
+
+func handleOIDCErrors(err error, c *gin.Context) {
+	switch {
+	case handleThrottle(err, c):
+	case errors.Is(err, provider.ErrDuplicateUser):
+		c.JSON(
+			http.StatusConflict,
+			schema.SimpleError(provider.ErrDuplicateUser),
+		)
+	case errors.Is(err, provider.ErrIdentityProvider):
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+	case errors.Is(err, provider.ErrInvalidOIDCState),
+		errors.Is(err, provider.ErrInvalidIDToken),
+		errors.Is(err, provider.ErrUnknownProvider),
+		errors.Is(err, provider.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, schema.SimpleError(err))
+	case errors.Is(err, provider.ErrInvalidCredentials):
+		c.Status(http.StatusForbidden)
+	case errors.Is(err, provider.ErrTokenExpired),
+		errors.Is(err, provider.ErrInvalidToken),
+		errors.Is(err, provider.ErrWrongTokenType),
+		errors.Is(err, provider.ErrWrongIssuer),
+		errors.Is(err, provider.ErrWrongAudience):
+		handleTokenErrors(err, c)
+	default:
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"gin-gorm-api/middleware"
 	"gin-gorm-api/model"
+	"gin-gorm-api/provider"
 	"gin-gorm-api/schema"
 	"net/http"
 
@@ -13,24 +14,30 @@ import (
 
 // UserHandler exposes endpoints to interact with the User model.
 type UserHandler struct {
-	db     *gorm.DB
-	authMW gin.HandlerFunc
+	db      *gorm.DB
+	manager provider.UserAuthManager
+	authMW  gin.HandlerFunc
 }
 
 // NewUserHandler returns a new UserHandler.
-func NewUserHandler(db *gorm.DB, authMW gin.HandlerFunc) UserHandler {
-	return UserHandler{db: db, authMW: authMW}
+func NewUserHandler(
+	db *gorm.DB,
+	manager provider.UserAuthManager,
+	authMW gin.HandlerFunc,
+) UserHandler {
+	return UserHandler{db: db, manager: manager, authMW: authMW}
 }
 
 // CreateUser godoc
 // @Summary      Create user
 // @Schemes
-// @Description  Create new user
+// @Description  Create new user and send it an email verification message. If users are hidden the response is the same whether it was created or not
 // @Tags         User
 // @Accept       json
 // @Produce      json
 // @Param        form     body      schema.NewUserForm true "User form"
 // @Success      201      {object}  schema.UserOut
+// @Success      202      {string}  string        "Hidden outcome"
 // @Failure      400      {object}  schema.Errors "Bad request"
 // @Failure      409      {object}  schema.Errors "Duplicate user"
 // @Failure      default  {string}  string        "Unexpected error"
@@ -39,18 +46,20 @@ func NewUserHandler(db *gorm.DB, authMW gin.HandlerFunc) UserHandler {
 func (h UserHandler) create(c *gin.Context) {
 	formData, _ := c.Get("form")
 	form, _ := formData.(schema.NewUserForm)
-	user := model.User{Username: form.Username, Email: form.Email}
-	if err := user.SetPassword(form.Password); err != nil {
-		_ = c.AbortWithError(http.StatusInternalServerError, err)
-		return
-	}
-	r := h.db.WithContext(c.Request.Context()).Create(&user)
-	if r.Error != nil {
-		if errors.Is(r.Error, gorm.ErrDuplicatedKey) {
-			c.JSON(http.StatusConflict, schema.SimpleError(r.Error))
+	user, err := h.manager.Register(form, c)
+	if err != nil {
+		if errors.Is(err, provider.ErrDuplicateUser) {
+			c.JSON(
+				http.StatusConflict,
+				schema.SimpleError(provider.ErrDuplicateUser),
+			)
 			return
 		}
-		_ = c.AbortWithError(http.StatusFailedDependency, r.Error)
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	if h.manager.HidesUsers() {
+		c.Status(http.StatusAccepted)
 		return
 	}
 	c.JSON(
@@ -67,7 +76,7 @@ func (h UserHandler) create(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Success      200      {object}  []schema.UserOut
-// @Failure      403
+// @Failure      403      {object}  schema.Errors "Forbidden"
 // @Failure      default  {string}  string "Unexpected error"
 // @Router       /user/   [get]
 // .
@@ -91,7 +100,7 @@ func (h UserHandler) getAll(c *gin.Context) {
 // @Param        user_id  path      int true "User id"
 // @Success      200      {object}  schema.UserOut
 // @Failure      400      {object}  schema.Errors "Bad request"
-// @Failure      403
+// @Failure      403      {object}  schema.Errors "Forbidden"
 // @Failure      404
 // @Failure      default  {string}  string "Unexpected error"
 // @Router       /user/{user_id}   [get]
@@ -123,6 +132,18 @@ func (h UserHandler) getByID(c *gin.Context) {
 func (h UserHandler) AddRoutes(r *gin.Engine) {
 	g := r.Group("/user")
 	g.POST("/", middleware.FormValidation[schema.NewUserForm](), h.create)
-	g.GET("/", h.authMW, h.getAll)
-	g.GET("/:userid", h.authMW, h.getByID)
+	g.GET(
+		"/",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserRead),
+		middleware.RequirePermission(model.PermUserList),
+		h.getAll,
+	)
+	g.GET(
+		"/:userid",
+		h.authMW,
+		middleware.RequireScopes(provider.ScopeUserRead),
+		middleware.RequirePermission(model.PermUserRead),
+		h.getByID,
+	)
 }
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"gin-gorm-api/model"
+	"gin-gorm-api/provider"
+	"gin-gorm-api/schema"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BeginWebAuthnRegistration godoc
+// @Summary      Begin passkey registration
+// @Schemes
+// @Description  Get the options to create a passkey for the current user with navigator.credentials.create
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Success      200      {object}  schema.WebAuthnCreationOptionsOut
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Reauthentication required"
+// @Failure      403      {object}  schema.Errors "Managed by a directory"
+// @Failure      404      {string}  string        "Passkeys disabled"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/webauthn/register [post]
+// .
+func (h AuthHandler) beginWebAuthnRegistration(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	ceremony, err := h.manager.BeginWebAuthnRegistration(user, c)
+	if err != nil {
+		handleWebAuthnErrors(err, c)
+		return
+	}
+	params := make([]schema.WebAuthnCredentialParam, len(ceremony.Algorithms))
+	for i, alg := range ceremony.Algorithms {
+		params[i] = schema.WebAuthnCredentialParam{
+			Type: "public-key",
+			Alg:  alg,
+		}
+	}
+	exclude := make([]schema.WebAuthnDescriptor, len(ceremony.Credentials))
+	for i, cred := range ceremony.Credentials {
+		exclude[i] = webAuthnDescriptor(cred)
+	}
+	c.JSON(http.StatusOK, schema.WebAuthnCreationOptionsOut{
+		Token: ceremony.Token,
+		PublicKey: schema.WebAuthnCreationOptions{
+			RP: schema.WebAuthnRelyingParty{
+				ID:   ceremony.RPID,
+				Name: ceremony.RPName,
+			},
+			User: schema.WebAuthnUser{
+				ID:          encodeBase64URL(ceremony.UserHandle),
+				Name:        ceremony.Username,
+				DisplayName: ceremony.Username,
+			},
+			Challenge:          encodeBase64URL(ceremony.Challenge),
+			PubKeyCredParams:   params,
+			Timeout:            ceremony.Timeout.Milliseconds(),
+			ExcludeCredentials: exclude,
+			// Logins do not name the user so passkeys must be discoverable.
+			AuthenticatorSelection: schema.WebAuthnSelection{
+				ResidentKey:        "required",
+				RequireResidentKey: true,
+				UserVerification:   ceremony.UserVerification,
+			},
+			Attestation: "none",
+		},
+	})
+}
+
+// CompleteWebAuthnRegistration godoc
+// @Summary      Complete passkey registration
+// @Schemes
+// @Description  Register the passkey created by an authenticator for the current user
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.WebAuthnRegistrationForm true "WebAuthn registration form"
+// @Success      201      {object}  schema.WebAuthnCredentialOut
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      404      {string}  string        "Passkeys disabled"
+// @Failure      409      {object}  schema.Errors "Passkey already registered"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/webauthn/register/complete [post]
+// .
+func (h AuthHandler) completeWebAuthnRegistration(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.WebAuthnRegistrationForm)
+	cred, err := h.manager.CompleteWebAuthnRegistration(user, form, c)
+	if err != nil {
+		handleWebAuthnErrors(err, c)
+		return
+	}
+	c.JSON(http.StatusCreated, webAuthnCredentialOut(cred))
+}
+
+// ListWebAuthnCredentials godoc
+// @Summary      List passkeys
+// @Schemes
+// @Description  List the passkeys of the current user
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Success      200      {object}  []schema.WebAuthnCredentialOut
+// @Failure      403      {string}  string  "Forbidden"
+// @Failure      default  {string}  string  "Unexpected error"
+// @Router       /auth/webauthn/credentials [get]
+// .
+func (h AuthHandler) listWebAuthnCredentials(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	creds, err := h.manager.ListWebAuthnCredentials(user, c)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	out := make([]schema.WebAuthnCredentialOut, len(creds))
+	for i, cred := range creds {
+		out[i] = webAuthnCredentialOut(cred)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// DeleteWebAuthnCredential godoc
+// @Summary      Delete passkey
+// @Schemes
+// @Description  Delete a passkey of the current user
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        credentialid path  int true "Passkey id"
+// @Success      204
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Reauthentication required"
+// @Failure      404      {string}  string        "Passkey not found"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/webauthn/credentials/{credentialid} [delete]
+// .
+func (h AuthHandler) deleteWebAuthnCredential(c *gin.Context) {
+	sessionData, _ := c.Get(h.manager.UserKey)
+	user, ok := sessionData.(model.User)
+	if !ok {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	credID, err := getParamID("credentialid", c)
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			schema.Errors{"credential_id": err.Error()},
+		)
+		return
+	}
+	err = h.manager.DeleteWebAuthnCredential(user, uint(credID), c)
+	if err != nil {
+		if errors.Is(err, provider.ErrWebAuthnCredentialNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// BeginWebAuthnLogin godoc
+// @Summary      Begin passkey login
+// @Schemes
+// @Description  Get the options to assert a passkey with navigator.credentials.get
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Success      200      {object}  schema.WebAuthnRequestOptionsOut
+// @Failure      404      {string}  string  "Passkeys disabled"
+// @Failure      default  {string}  string  "Unexpected error"
+// @Router       /auth/webauthn/login [post]
+// .
+func (h AuthHandler) beginWebAuthnLogin(c *gin.Context) {
+	ceremony, err := h.manager.BeginWebAuthnLogin(c)
+	if err != nil {
+		handleWebAuthnErrors(err, c)
+		return
+	}
+	c.JSON(http.StatusOK, schema.WebAuthnRequestOptionsOut{
+		Token: ceremony.Token,
+		PublicKey: schema.WebAuthnRequestOptions{
+			Challenge:        encodeBase64URL(ceremony.Challenge),
+			Timeout:          ceremony.Timeout.Milliseconds(),
+			RPID:             ceremony.RPID,
+			AllowCredentials: []schema.WebAuthnDescriptor{},
+			UserVerification: ceremony.UserVerification,
+		},
+	})
+}
+
+// CompleteWebAuthnLogin godoc
+// @Summary      Complete passkey login
+// @Schemes
+// @Description  Start session by asserting a passkey, unless a second factor is required
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        form     body      schema.WebAuthnLoginForm true "WebAuthn login form"
+// @Success      200      {object}  schema.UserOut
+// @Success      202      {object}  schema.MFARequiredOut "Second factor required"
+// @Failure      400      {object}  schema.Errors "Bad request"
+// @Failure      403      {string}  string        "Forbidden"
+// @Failure      403      {object}  schema.Errors "Forbidden"
+// @Failure      403      {object}  schema.Errors "Cross origin request"
+// @Failure      404      {string}  string        "Passkeys disabled"
+// @Failure      429      {object}  schema.Errors "Too many attempts"
+// @Failure      default  {string}  string        "Unexpected error"
+// @Router       /auth/webauthn/login/complete [post]
+// .
+func (h AuthHandler) completeWebAuthnLogin(c *gin.Context) {
+	formData, _ := c.Get("form")
+	form, _ := formData.(schema.WebAuthnLoginForm)
+	user, err := h.manager.CompleteWebAuthnLogin(form, c)
+	if err != nil {
+		handleWebAuthnErrors(err, c)
+		return
+	}
+	if user.MFAEnabled() {
+		h.requireMFA(user, c)
+		return
+	}
+	h.startSession(user, c)
+}
+
+func handleWebAuthnErrors(err error, c *gin.Context) {
+	switch {
+	case handleThrottle(err, c):
+	case errors.Is(err, provider.ErrWebAuthnDisabled):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, provider.ErrManagedUser):
+		c.JSON(
+			http.StatusForbidden,
+			schema.SimpleError(provider.ErrManagedUser),
+		)
+	case errors.Is(err, provider.ErrInvalidAttestation):
+		c.JSON(
+			http.StatusBadRequest,
+			schema.SimpleError(provider.ErrInvalidAttestation),
+		)
+	case errors.Is(err, provider.ErrDuplicateWebAuthnCredential):
+		c.JSON(
+			http.StatusConflict,
+			schema.SimpleError(provider.ErrDuplicateWebAuthnCredential),
+		)
+	case errors.Is(err, provider.ErrEmailNotVerified):
+		c.JSON(
+			http.StatusForbidden,
+			schema.SimpleError(provider.ErrEmailNotVerified),
+		)
+	case errors.Is(err, provider.ErrInvalidCredentials):
+		c.Status(http.StatusForbidden)
+	case errors.Is(err, provider.ErrTokenExpired),
+		errors.Is(err, provider.ErrInvalidToken),
+		errors.Is(err, provider.ErrWrongTokenType),
+		errors.Is(err, provider.ErrTokenReused):
+		handleTokenErrors(err, c)
+	default:
+		_ = c.AbortWithError(http.StatusFailedDependency, err)
+	}
+}
+
+func webAuthnCredentialOut(
+	cred model.WebAuthnCredential,
+) schema.WebAuthnCredentialOut {
+	return schema.WebAuthnCredentialOut{
+		ID:           cred.ID,
+		Name:         cred.Name,
+		CredentialID: encodeBase64URL(cred.CredentialID),
+		AAGUID:       hex.EncodeToString(cred.AAGUID),
+		Transports:   strings.Fields(cred.Transports),
+		CreatedAt:    cred.CreatedAt,
+		LastUsedAt:   cred.LastUsedAt,
+	}
+}
+
+func webAuthnDescriptor(
+	cred model.WebAuthnCredential,
+) schema.WebAuthnDescriptor {
+	return schema.WebAuthnDescriptor{
+		Type:       "public-key",
+		ID:         encodeBase64URL(cred.CredentialID),
+		Transports: strings.Fields(cred.Transports),
+	}
+}
+
+// encodeBase64URL returns the unpadded base64url encoding of b, as expected
+// by PublicKeyCredential.parseCreationOptionsFromJSON.
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
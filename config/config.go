@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/sethvargo/go-envconfig"
 	"gopkg.in/yaml.v3"
@@ -17,6 +18,7 @@ type Config struct {
 	Secret  string       `yaml:"secret"  env:"SECRET, overwrite"`
 	DB      DBConfig     `yaml:"db"`
 	Engine  EngineConfig `yaml:"engine"`
+	Auth    AuthConfig   `yaml:"auth"`
 }
 
 // EngineConfig holds the config info for the http engine.
@@ -25,6 +27,197 @@ type EngineConfig struct {
 	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES, overwrite"` //nolint:lll // annotaions dont allow new lines.
 }
 
+// AuthConfig holds the config info for user authentication.
+type AuthConfig struct {
+	SessionTTL time.Duration `yaml:"session_ttl" env:"SESSION_TTL, overwrite, default=1h"`   //nolint:lll // annotaions dont allow new lines.
+	RefreshTTL time.Duration `yaml:"refresh_ttl" env:"REFRESH_TTL, overwrite, default=720h"` //nolint:lll // annotaions dont allow new lines.
+	// Transports enabled for sending credentials, any of "cookie" and
+	// "bearer".
+	Transports []string `yaml:"transports" env:"AUTH_TRANSPORTS, overwrite, default=cookie,bearer"` //nolint:lll // annotaions dont allow new lines.
+	// Authenticators checking login passwords, any of "local" and "ldap",
+	// tried in order.
+	Authenticators []string `yaml:"authenticators" env:"AUTH_AUTHENTICATORS, overwrite, default=local"` //nolint:lll // annotaions dont allow new lines.
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer string `yaml:"totp_issuer" env:"TOTP_ISSUER, overwrite, default=gin-gorm-api"` //nolint:lll // annotaions dont allow new lines.
+	// SigningKeys maps key identifiers to base64 encoded 64 byte keys that
+	// are accepted, along with Secret, when verifying tokens.
+	SigningKeys map[string]string `yaml:"signing_keys" env:"SIGNING_KEYS, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// SigningKeyID is the identifier of the key used to sign new tokens. If
+	// empty Secret is used.
+	SigningKeyID string `yaml:"signing_key_id" env:"SIGNING_KEY_ID, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// TokenIssuer identifies this service as the issuer of tokens. Tokens
+	// issued by anyone else are rejected.
+	TokenIssuer string `yaml:"token_issuer" env:"TOKEN_ISSUER, overwrite, default=gin-gorm-api"` //nolint:lll // annotaions dont allow new lines.
+	// TokenAudience identifies this service as the recipient of tokens.
+	// Tokens meant for anyone else are rejected.
+	TokenAudience string `yaml:"token_audience" env:"TOKEN_AUDIENCE, overwrite, default=gin-gorm-api"` //nolint:lll // annotaions dont allow new lines.
+	// LegacyTokenGrace is how long after being issued tokens that name no
+	// issuer nor audience, as issued before both were added, are still
+	// accepted. Setting it to RefreshTTL when upgrading keeps existing
+	// sessions alive, leaving it at zero logs everyone out.
+	LegacyTokenGrace time.Duration `yaml:"legacy_token_grace" env:"LEGACY_TOKEN_GRACE, overwrite, default=0s"` //nolint:lll // annotaions dont allow new lines.
+	// TokenFormat is the encoding of issued tokens, either "native" or "jwt".
+	TokenFormat string `yaml:"token_format" env:"TOKEN_FORMAT, overwrite, default=native"` //nolint:lll // annotaions dont allow new lines.
+	// JWTAlgorithm signs tokens when TokenFormat is "jwt", one of "HS256",
+	// which uses the signing keys, "EdDSA" and "ES256".
+	JWTAlgorithm string `yaml:"jwt_algorithm" env:"JWT_ALGORITHM, overwrite, default=HS256"` //nolint:lll // annotaions dont allow new lines.
+	// JWTKeys maps key identifiers to base64 encoded PKCS #8 private keys
+	// used by asymmetric JWT algorithms.
+	JWTKeys map[string]string `yaml:"jwt_keys" env:"JWT_KEYS, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// JWTKeyID is the identifier of the JWT key used to sign new tokens.
+	JWTKeyID string `yaml:"jwt_key_id" env:"JWT_KEY_ID, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// Argon2Time, Argon2Memory, in KiB, and Argon2Threads are the parameters
+	// used to hash new passwords. Raising them rehashes existing passwords on
+	// login.
+	Argon2Time    uint32 `yaml:"argon2_time" env:"ARGON2_TIME, overwrite, default=2"`         //nolint:lll // annotaions dont allow new lines.
+	Argon2Memory  uint32 `yaml:"argon2_memory" env:"ARGON2_MEMORY, overwrite, default=19456"` //nolint:lll // annotaions dont allow new lines.
+	Argon2Threads uint8  `yaml:"argon2_threads" env:"ARGON2_THREADS, overwrite, default=1"`   //nolint:lll // annotaions dont allow new lines.
+	// ResetTTL is how long password reset tokens are valid.
+	ResetTTL time.Duration `yaml:"reset_ttl" env:"PASSWORD_RESET_TTL, overwrite, default=10m"` //nolint:lll // annotaions dont allow new lines.
+	// EmailVerificationTTL is how long email verification tokens are valid.
+	EmailVerificationTTL time.Duration `yaml:"email_verification_ttl" env:"EMAIL_VERIFICATION_TTL, overwrite, default=24h"` //nolint:lll // annotaions dont allow new lines.
+	// RequireVerifiedEmail refuses logins from users that have not verified
+	// their email address.
+	RequireVerifiedEmail bool `yaml:"require_verified_email" env:"REQUIRE_VERIFIED_EMAIL, overwrite, default=false"` //nolint:lll // annotaions dont allow new lines.
+	// MagicLinkTTL is how long magic login links are valid.
+	MagicLinkTTL time.Duration `yaml:"magic_link_ttl" env:"MAGIC_LINK_TTL, overwrite, default=15m"` //nolint:lll // annotaions dont allow new lines.
+	// MagicLinkURL is the page that consumes magic login links. Their token
+	// is added to it as the token query parameter. If empty the bare token
+	// is sent instead.
+	MagicLinkURL string `yaml:"magic_link_url" env:"MAGIC_LINK_URL, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// EmailRevertTTL is how long the link sent to the previous address of a
+	// user to undo a change of email address is valid.
+	EmailRevertTTL time.Duration `yaml:"email_revert_ttl" env:"EMAIL_REVERT_TTL, overwrite, default=168h"` //nolint:lll // annotaions dont allow new lines.
+	// EmailRevertURL is the page that consumes email change revert links,
+	// like MagicLinkURL.
+	EmailRevertURL string `yaml:"email_revert_url" env:"EMAIL_REVERT_URL, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// ReauthenticationWindow is how long after the user last proved its
+	// identity on a session it can perform sensitive actions without doing
+	// so again.
+	ReauthenticationWindow time.Duration `yaml:"reauthentication_window" env:"REAUTHENTICATION_WINDOW, overwrite, default=10m"` //nolint:lll // annotaions dont allow new lines.
+	// PreventEnumeration makes the endpoints that look users up by username
+	// or email address respond the same whether they exist or not. Their
+	// owners are notified by email instead.
+	PreventEnumeration bool `yaml:"prevent_enumeration" env:"PREVENT_ENUMERATION, overwrite, default=false"` //nolint:lll // annotaions dont allow new lines.
+	// Cookie holds the attributes of session cookies.
+	Cookie CookieConfig `yaml:"cookie"`
+	// Throttle limits failed login attempts.
+	Throttle ThrottleConfig `yaml:"throttle"`
+	// OIDC configures the external identity providers users can log in
+	// with.
+	OIDC OIDCConfig `yaml:"oidc"`
+	// LDAP configures the directory users can log in with.
+	LDAP LDAPConfig `yaml:"ldap"`
+	// WebAuthn configures the passkeys users can log in with.
+	WebAuthn WebAuthnConfig `yaml:"webauthn"`
+	// OAuthCodeTTL is how long the authorization codes issued to OAuth
+	// clients can be exchanged for tokens.
+	OAuthCodeTTL time.Duration `yaml:"oauth_code_ttl" env:"OAUTH_CODE_TTL, overwrite, default=1m"` //nolint:lll // annotaions dont allow new lines.
+	// BootstrapAdmin is the username of the user granted the admin role on
+	// start up if no user holds it.
+	BootstrapAdmin string `yaml:"bootstrap_admin" env:"BOOTSTRAP_ADMIN, overwrite"` //nolint:lll // annotaions dont allow new lines.
+}
+
+// CookieConfig holds the config info for the session and refresh cookies.
+// With HostPrefix their names start with "__Host-", which browsers only
+// accept for secure cookies with path "/" and no domain. MaxAge overrides how
+// long browsers keep them, by default as long as the token they hold, and a
+// negative value makes them last until the browser is closed. With Encrypt
+// their values are sealed with AES-GCM so clients can not read them.
+type CookieConfig struct {
+	SessionName string        `yaml:"session_name" env:"COOKIE_SESSION_NAME, overwrite, default=user_session"` //nolint:lll // annotaions dont allow new lines.
+	RefreshName string        `yaml:"refresh_name" env:"COOKIE_REFRESH_NAME, overwrite, default=user_refresh"` //nolint:lll // annotaions dont allow new lines.
+	Domain      string        `yaml:"domain" env:"COOKIE_DOMAIN, overwrite"`                                   //nolint:lll // annotaions dont allow new lines.
+	Path        string        `yaml:"path" env:"COOKIE_PATH, overwrite, default=/"`                            //nolint:lll // annotaions dont allow new lines.
+	SameSite    string        `yaml:"same_site" env:"COOKIE_SAME_SITE, overwrite, default=lax"`                //nolint:lll // annotaions dont allow new lines.
+	HostPrefix  bool          `yaml:"host_prefix" env:"COOKIE_HOST_PREFIX, overwrite, default=false"`          //nolint:lll // annotaions dont allow new lines.
+	MaxAge      time.Duration `yaml:"max_age" env:"COOKIE_MAX_AGE, overwrite, default=0s"`                     //nolint:lll // annotaions dont allow new lines.
+	Encrypt     bool          `yaml:"encrypt" env:"COOKIE_ENCRYPT, overwrite, default=false"`                  //nolint:lll // annotaions dont allow new lines.
+}
+
+// ThrottleConfig holds the config info for login throttling. Failed attempts
+// are counted per username and per client address. Once a count goes past its
+// backoff limit each further failure blocks attempts for twice as long as the
+// previous one, starting at BackoffBase, and once it reaches its lockout
+// threshold attempts are blocked for LockoutDuration. Counts are forgotten
+// after Window without failures. A zero threshold disables the lockout.
+// Requests for emails, such as magic links, are counted the same way per
+// email address, against the Mail limits, and per client address.
+type ThrottleConfig struct {
+	Window               time.Duration `yaml:"window" env:"LOGIN_ATTEMPT_WINDOW, overwrite, default=1h"`                //nolint:lll // annotaions dont allow new lines.
+	BackoffBase          time.Duration `yaml:"backoff_base" env:"LOGIN_BACKOFF_BASE, overwrite, default=1s"`            //nolint:lll // annotaions dont allow new lines.
+	LockoutDuration      time.Duration `yaml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION, overwrite, default=15m"`   //nolint:lll // annotaions dont allow new lines.
+	UserBackoffAfter     int           `yaml:"user_backoff_after" env:"LOGIN_USER_BACKOFF_AFTER, overwrite, default=3"` //nolint:lll // annotaions dont allow new lines.
+	UserLockoutThreshold int           `yaml:"user_lockout_threshold" env:"LOGIN_USER_LOCKOUT, overwrite, default=10"`  //nolint:lll // annotaions dont allow new lines.
+	IPBackoffAfter       int           `yaml:"ip_backoff_after" env:"LOGIN_IP_BACKOFF_AFTER, overwrite, default=20"`    //nolint:lll // annotaions dont allow new lines.
+	IPLockoutThreshold   int           `yaml:"ip_lockout_threshold" env:"LOGIN_IP_LOCKOUT, overwrite, default=100"`     //nolint:lll // annotaions dont allow new lines.
+	MailBackoffAfter     int           `yaml:"mail_backoff_after" env:"MAIL_BACKOFF_AFTER, overwrite, default=3"`       //nolint:lll // annotaions dont allow new lines.
+	MailLockoutThreshold int           `yaml:"mail_lockout_threshold" env:"MAIL_LOCKOUT, overwrite, default=10"`        //nolint:lll // annotaions dont allow new lines.
+}
+
+// OIDCConfig holds the config info for OpenID Connect identity providers,
+// which are named by the keys of Issuers and also key their client
+// credentials.
+type OIDCConfig struct {
+	// Issuers maps provider names to their issuer URL, where their discovery
+	// document is found.
+	Issuers map[string]string `yaml:"issuers" env:"OIDC_ISSUERS, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// ClientIDs and ClientSecrets map provider names to the credentials of
+	// this service at them.
+	ClientIDs     map[string]string `yaml:"client_ids" env:"OIDC_CLIENT_IDS, overwrite"`         //nolint:lll // annotaions dont allow new lines.
+	ClientSecrets map[string]string `yaml:"client_secrets" env:"OIDC_CLIENT_SECRETS, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// RedirectURL is the public URL of the /auth/oidc/callback route, which
+	// must be registered at every provider.
+	RedirectURL string `yaml:"redirect_url" env:"OIDC_REDIRECT_URL, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// FlowTTL is how long users have to log in at a provider.
+	FlowTTL time.Duration `yaml:"flow_ttl" env:"OIDC_FLOW_TTL, overwrite, default=10m"` //nolint:lll // annotaions dont allow new lines.
+}
+
+// LDAPConfig holds the config info for an LDAP directory, such as Active
+// Directory. Users are searched for as BindDN, anonymously if empty, and then
+// authenticated by binding as themselves.
+type LDAPConfig struct {
+	// URL of the directory, with the ldap or ldaps scheme.
+	URL          string `yaml:"url" env:"LDAP_URL, overwrite"`                            //nolint:lll // annotaions dont allow new lines.
+	StartTLS     bool   `yaml:"start_tls" env:"LDAP_START_TLS, overwrite, default=false"` //nolint:lll // annotaions dont allow new lines.
+	BindDN       string `yaml:"bind_dn" env:"LDAP_BIND_DN, overwrite"`                    //nolint:lll // annotaions dont allow new lines.
+	BindPassword string `yaml:"bind_password" env:"LDAP_BIND_PASSWORD, overwrite"`        //nolint:lll // annotaions dont allow new lines.
+	BaseDN       string `yaml:"base_dn" env:"LDAP_BASE_DN, overwrite"`                    //nolint:lll // annotaions dont allow new lines.
+	// UserFilter finds a user's entry, with %s replaced by the escaped
+	// username.
+	UserFilter string `yaml:"user_filter" env:"LDAP_USER_FILTER, overwrite, default=(uid=%s)"` //nolint:lll // annotaions dont allow new lines.
+	// UsernameAttribute, EmailAttribute and GroupAttribute name the
+	// attributes of the entry holding the username, email address and
+	// group DNs of the user.
+	UsernameAttribute string `yaml:"username_attribute" env:"LDAP_USERNAME_ATTRIBUTE, overwrite, default=uid"` //nolint:lll // annotaions dont allow new lines.
+	EmailAttribute    string `yaml:"email_attribute" env:"LDAP_EMAIL_ATTRIBUTE, overwrite, default=mail"`      //nolint:lll // annotaions dont allow new lines.
+	GroupAttribute    string `yaml:"group_attribute" env:"LDAP_GROUP_ATTRIBUTE, overwrite, default=memberOf"`  //nolint:lll // annotaions dont allow new lines.
+	// GroupRoles maps group DNs to the name of the role granted to their
+	// members. Since DNs contain commas, entries are separated by
+	// semicolons. The roles it names are synced on every login.
+	GroupRoles map[string]string `yaml:"group_roles" env:"LDAP_GROUP_ROLES, overwrite, delimiter=;"` //nolint:lll // annotaions dont allow new lines.
+	// Timeout limits every operation on the directory.
+	Timeout time.Duration `yaml:"timeout" env:"LDAP_TIMEOUT, overwrite, default=5s"` //nolint:lll // annotaions dont allow new lines.
+}
+
+// WebAuthnConfig holds the config info for passkeys, which are disabled
+// unless RPID is set.
+type WebAuthnConfig struct {
+	// RPID is the domain passkeys are scoped to, which must be the host of
+	// every origin or one of its parent domains.
+	RPID string `yaml:"rp_id" env:"WEBAUTHN_RP_ID, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// RPName names this service in authenticators.
+	RPName string `yaml:"rp_name" env:"WEBAUTHN_RP_NAME, overwrite, default=gin-gorm-api"` //nolint:lll // annotaions dont allow new lines.
+	// Origins of the pages allowed to use passkeys, such as
+	// "https://example.com".
+	Origins []string `yaml:"origins" env:"WEBAUTHN_ORIGINS, overwrite"` //nolint:lll // annotaions dont allow new lines.
+	// UserVerification is "required", "preferred" or "discouraged". Only
+	// when required are assertions without user verification refused.
+	UserVerification string `yaml:"user_verification" env:"WEBAUTHN_USER_VERIFICATION, overwrite, default=preferred"` //nolint:lll // annotaions dont allow new lines.
+	// Timeout is how long users have to complete a registration or login.
+	Timeout time.Duration `yaml:"timeout" env:"WEBAUTHN_TIMEOUT, overwrite, default=5m"` //nolint:lll // annotaions dont allow new lines.
+}
+
 // EngineConfig holds the config info for the database.
 type DBConfig struct {
 	Host     string `yaml:"host"     env:"DB_HOST, overwrite"`
@@ -40,6 +40,16 @@ func main() {
 		log.Fatalf(fatalMessage, err)
 	}
 
+	model.RegisterHasher(
+		model.Argon2idHasher{
+			Time:    config.Auth.Argon2Time,
+			Memory:  config.Auth.Argon2Memory,
+			Threads: config.Auth.Argon2Threads,
+			KeyLen:  32,
+		},
+		true,
+	)
+
 	db, err := model.NewDBSession(config)
 	if err != nil {
 		log.Fatalf(fatalMessage, err)
@@ -47,9 +57,22 @@ func main() {
 	if err = model.RunMigration(db); err != nil {
 		log.Fatalf(fatalMessage, err)
 	}
+	if config.Auth.BootstrapAdmin != "" {
+		err = model.BootstrapAdmin(db, config.Auth.BootstrapAdmin)
+		if err != nil {
+			log.Fatalf(fatalMessage, err)
+		}
+	}
 
 	mailer := provider.NewMailer(config)
-	auth, err := provider.NewUserAuthManager(db, mailer, config, "user")
+	stores := provider.NewStores(db, config)
+	auth, err := provider.NewUserAuthManager(
+		db,
+		mailer,
+		stores,
+		config,
+		"user",
+	)
 	if err != nil {
 		log.Fatalf(fatalMessage, err)
 	}
@@ -61,7 +84,9 @@ func main() {
 	}
 
 	api.NewAuthHandler(auth, sm).AddRoutes(r)
-	api.NewUserHandler(db, sm).AddRoutes(r)
+	api.NewUserHandler(db, auth, sm).AddRoutes(r)
+	api.NewAdminHandler(db, auth, sm).AddRoutes(r)
+	api.NewOAuthHandler(auth, sm).AddRoutes(r)
 
 	startServer(r)
 }
@@ -2,22 +2,57 @@ package middleware
 
 import (
 	"gin-gorm-api/provider"
+	"gin-gorm-api/schema"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// CredentialKey is the key under which the session middleware sets the
+// provider.Credential of an authenticated request.
+const CredentialKey = "credential"
+
 // NewSessionMiddleware returns a middleware that verifies if a session exists
-// and if so adds the corresponding user to c under the key manager.UserKey.
-// Authentication is handled by the given manager which is espected inmutable.
+// and if so adds the corresponding user to c under the key manager.UserKey
+// and its credential under CredentialKey. Authentication is handled by the
+// given manager which is espected inmutable. Requests that may change state
+// and were authenticated by a cookie must also carry the session's CSRF
+// token, otherwise they are aborted.
 func NewSessionMiddleware(manager provider.UserAuthManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user, err := manager.RetrieveSession(c)
+		user, cred, err := manager.RetrieveSession(c)
 		if err != nil {
 			c.AbortWithStatus(http.StatusForbidden)
 			return
 		}
+		if err = manager.CheckCSRF(cred, c); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, schema.SimpleError(err))
+			return
+		}
 		c.Set(manager.UserKey, user)
+		c.Set(CredentialKey, cred)
+		c.Next()
+	}
+}
+
+// RequireReauthentication returns a middleware that verifies that the user of
+// the credential set by the session middleware recently proved its identity,
+// as checked by manager. If it did not the request is aborted and the client
+// is expected to call the reauthentication endpoint before retrying.
+func RequireReauthentication(
+	manager provider.UserAuthManager,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credData, _ := c.Get(CredentialKey)
+		cred, ok := credData.(provider.Credential)
+		if !ok {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		if err := manager.CheckReauthentication(cred); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, schema.SimpleError(err))
+			return
+		}
 		c.Next()
 	}
 }
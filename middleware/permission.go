@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"gin-gorm-api/provider"
+	"gin-gorm-api/schema"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission returns a middleware that verifies that the roles of the
+// user authenticated by the session middleware grant every permission in
+// perms. If they do not the request is aborted with the missing permissions
+// as reason.
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credData, _ := c.Get(CredentialKey)
+		cred, ok := credData.(provider.Credential)
+		if !ok {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		missing := cred.MissingPermissions(perms...)
+		if len(missing) > 0 {
+			c.AbortWithStatusJSON(
+				http.StatusForbidden,
+				schema.Errors{
+					"error":               "insufficient_permission",
+					"missing_permissions": strings.Join(missing, " "),
+				},
+			)
+			return
+		}
+		c.Next()
+	}
+}
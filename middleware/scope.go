@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fmt"
+	"gin-gorm-api/provider"
+	"gin-gorm-api/schema"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScopes returns a middleware that verifies that the credential set by
+// the session middleware holds every scope in scopes. If it does not the
+// request is aborted with the missing scopes as reason.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credData, _ := c.Get(CredentialKey)
+		cred, ok := credData.(provider.Credential)
+		if !ok {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		missing := cred.MissingScopes(scopes...)
+		if len(missing) > 0 {
+			// As described in RFC 6750 section 3.
+			c.Header(
+				"WWW-Authenticate",
+				fmt.Sprintf(
+					`Bearer error="insufficient_scope", scope="%s"`,
+					strings.Join(scopes, " "),
+				),
+			)
+			c.AbortWithStatusJSON(
+				http.StatusForbidden,
+				schema.Errors{
+					"error":          "insufficient_scope",
+					"missing_scopes": strings.Join(missing, " "),
+				},
+			)
+			return
+		}
+		c.Next()
+	}
+}
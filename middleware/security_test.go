@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSameOrigin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{
+			name:   "no headers",
+			status: http.StatusNoContent,
+		},
+		{
+			name:    "same origin fetch",
+			headers: map[string]string{"Sec-Fetch-Site": "same-origin"},
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "user navigation",
+			headers: map[string]string{"Sec-Fetch-Site": "none"},
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "same site fetch",
+			headers: map[string]string{"Sec-Fetch-Site": "same-site"},
+			status:  http.StatusForbidden,
+		},
+		{
+			name:    "cross site fetch",
+			headers: map[string]string{"Sec-Fetch-Site": "cross-site"},
+			status:  http.StatusForbidden,
+		},
+		{
+			name: "cross site fetch from same origin",
+			headers: map[string]string{
+				"Sec-Fetch-Site": "cross-site",
+				"Origin":         "https://api.example.com",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:    "same origin",
+			headers: map[string]string{"Origin": "https://api.example.com"},
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "other origin",
+			headers: map[string]string{"Origin": "https://evil.example"},
+			status:  http.StatusForbidden,
+		},
+		{
+			name:    "other port",
+			headers: map[string]string{"Origin": "https://api.example.com:8443"},
+			status:  http.StatusForbidden,
+		},
+		{
+			name:    "opaque origin",
+			headers: map[string]string{"Origin": "null"},
+			status:  http.StatusForbidden,
+		},
+	}
+	r := gin.New()
+	r.POST("/auth", SameOrigin(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"https://api.example.com/auth",
+				nil,
+			)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey represents a long lived credential of a User.
+type APIKey struct {
+	gorm.Model `gorm:"embedded"`
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"type:varchar(64)"`
+	// Prefix identifies the key publicly so it can be looked up without
+	// knowing its secret.
+	Prefix     string `gorm:"unique;type:varchar(16)"`
+	Hash       []byte `json:"-" gorm:"size:32"`
+	Scopes     string `gorm:"type:varchar(512)"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// Active returns true if and only if k has neither been revoked nor expired.
+func (k APIKey) Active() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt)
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// LoginAttempt records the failed login attempts made under a key, such as a
+// username or a client address.
+type LoginAttempt struct {
+	Key           string `gorm:"primaryKey;type:varchar(320)"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// Locked returns true if and only if attempts under a are blocked at t.
+func (a LoginAttempt) Locked(t time.Time) bool {
+	return a.LockedUntil != nil && t.Before(*a.LockedUntil)
+}
@@ -19,10 +19,28 @@ func NewDBSession(config config.Config) (*gorm.DB, error) {
 		config.DB.Port,
 		config.DB.SSL,
 	)
-	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// Translating errors lets callers detect duplicates with
+	// gorm.ErrDuplicatedKey.
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 }
 
-// RunMigration generates and runs migrations.
+// RunMigration generates and runs migrations and seeds the default roles.
 func RunMigration(db *gorm.DB) error {
-	return db.AutoMigrate(&User{})
+	err := db.AutoMigrate(
+		&User{},
+		&Session{},
+		&APIKey{},
+		&Permission{},
+		&Role{},
+		&RecoveryCode{},
+		&LoginAttempt{},
+		&OneTimeToken{},
+		&UserIdentity{},
+		&OAuthClient{},
+		&WebAuthnCredential{},
+	)
+	if err != nil {
+		return err
+	}
+	return seedRoles(db)
 }
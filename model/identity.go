@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// UserIdentity links a User to its account at an external OpenID Connect
+// identity provider, which names it by Subject.
+type UserIdentity struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"index;not null"`
+	Provider  string `gorm:"uniqueIndex:idx_identity;type:varchar(64)"`
+	Subject   string `gorm:"uniqueIndex:idx_identity;type:varchar(256)"`
+	Email     string `gorm:"type:varchar(256)"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// OAuthClient represents an application registered by a User that can act on
+// behalf of users, and of its owner, through the OAuth2 authorization server.
+type OAuthClient struct {
+	// ID is the client identifier given to the application.
+	ID      string `gorm:"primaryKey;type:varchar(64)"`
+	OwnerID uint   `gorm:"index;not null"`
+	Name    string `gorm:"type:varchar(64)"`
+	// SecretHash is the SHA-256 hash of the client secret. It is empty for
+	// public clients, which can not keep a secret.
+	SecretHash []byte `json:"-" gorm:"size:32"`
+	// RedirectURIs and Scopes are space separated lists of the URIs users
+	// can be sent back to and of the scopes the client can be granted.
+	RedirectURIs string `gorm:"type:varchar(2048)"`
+	Scopes       string `gorm:"type:varchar(512)"`
+	CreatedAt    time.Time
+	RevokedAt    *time.Time
+}
+
+// Confidential returns true if and only if c authenticates with a secret.
+func (c OAuthClient) Confidential() bool {
+	return len(c.SecretHash) > 0
+}
+
+// Active returns true if and only if c has not been revoked.
+func (c OAuthClient) Active() bool {
+	return c.RevokedAt == nil
+}
@@ -0,0 +1,281 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	// ErrUnknownHasher is used to signal that a password hash was produced by
+	// a hasher that is not registered.
+	ErrUnknownHasher = errors.New("unknown password hasher")
+	// ErrInvalidHash is used to signal that a password hash is not a valid
+	// PHC string.
+	ErrInvalidHash = errors.New("invalid password hash")
+)
+
+// A PasswordHasher hashes passwords into self describing PHC strings, of the
+// form $<id>[$<param>=<value>(,<param>=<value>)*][$<salt>[$<hash>]], and
+// verifies passwords against them.
+type PasswordHasher interface {
+	// ID returns the identifier of the hashing function in PHC strings.
+	ID() string
+	// Hash returns the PHC string of pw.
+	Hash(pw string) (string, error)
+	// Verify returns true if and only if pw matches the PHC string phc.
+	Verify(pw, phc string) (bool, error)
+	// NeedsRehash returns true if phc was not produced with the current
+	// parameters of the hasher.
+	NeedsRehash(phc string) bool
+}
+
+var (
+	hashersMu     sync.RWMutex
+	defaultHasher PasswordHasher = DefaultArgon2idHasher()
+	hashers                      = map[string]PasswordHasher{
+		argon2idID:     DefaultArgon2idHasher(),
+		pbkdf2SHA256ID: legacyPBKDF2Hasher(),
+	}
+)
+
+// RegisterHasher makes h available for verifying passwords hashed with its
+// ID. If def is true h is also used to hash new passwords.
+func RegisterHasher(h PasswordHasher, def bool) {
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+	hashers[h.ID()] = h
+	if def {
+		defaultHasher = h
+	}
+}
+
+// hasherFor returns the registered hasher that produced phc.
+func hasherFor(phc string) (PasswordHasher, error) {
+	fields := strings.Split(phc, "$")
+	if len(fields) < 2 || fields[0] != "" {
+		return nil, ErrInvalidHash
+	}
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+	h, ok := hashers[fields[1]]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownHasher, fields[1])
+	}
+	return h, nil
+}
+
+// currentHasher returns the hasher used for new passwords.
+func currentHasher() PasswordHasher {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+	return defaultHasher
+}
+
+const (
+	argon2idID     = "argon2id"
+	pbkdf2SHA256ID = "pbkdf2-sha256"
+	saltSize       = 16
+)
+
+// b64 is the encoding used for salts and hashes in PHC strings.
+var b64 = base64.RawStdEncoding
+
+// Argon2idHasher hashes passwords with Argon2id.
+type Argon2idHasher struct {
+	// Time is the number of passes over memory.
+	Time uint32
+	// Memory is the amount of memory used in KiB.
+	Memory uint32
+	// Threads is the degree of parallelism.
+	Threads uint8
+	// KeyLen is the length of the resulting hash in bytes.
+	KeyLen uint32
+}
+
+// DefaultArgon2idHasher returns an Argon2idHasher with the parameters
+// recommended by:
+// https://cheatsheetseries.owasp.org/cheatsheets/Password_Storage_Cheat_Sheet.html#argon2id
+func DefaultArgon2idHasher() Argon2idHasher {
+	return Argon2idHasher{Time: 2, Memory: 19456, Threads: 1, KeyLen: 32}
+}
+
+// ID returns "argon2id".
+func (a Argon2idHasher) ID() string {
+	return argon2idID
+}
+
+// Hash returns the PHC string of pw.
+func (a Argon2idHasher) Hash(pw string) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	hash := argon2.IDKey([]byte(pw), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return fmt.Sprintf(
+		"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idID,
+		argon2.Version,
+		a.Memory,
+		a.Time,
+		a.Threads,
+		b64.EncodeToString(salt),
+		b64.EncodeToString(hash),
+	), nil
+}
+
+// Verify returns true if and only if pw matches the PHC string phc.
+func (a Argon2idHasher) Verify(pw, phc string) (bool, error) {
+	params, salt, hash, err := a.parse(phc)
+	if err != nil {
+		return false, err
+	}
+	check := argon2.IDKey(
+		[]byte(pw),
+		salt,
+		params.Time,
+		params.Memory,
+		params.Threads,
+		uint32(len(hash)), //nolint:gosec // Hashes are short.
+	)
+	return subtle.ConstantTimeCompare(hash, check) == 1, nil
+}
+
+// NeedsRehash returns true if phc was not produced with the parameters of a.
+func (a Argon2idHasher) NeedsRehash(phc string) bool {
+	params, _, hash, err := a.parse(phc)
+	if err != nil {
+		return true
+	}
+	params.KeyLen = uint32(len(hash)) //nolint:gosec // Hashes are short.
+	return params != a
+}
+
+// parse returns the parameters, salt and hash of the PHC string phc.
+func (a Argon2idHasher) parse(
+	phc string,
+) (params Argon2idHasher, salt, hash []byte, err error) {
+	var version int
+	fields := strings.Split(phc, "$")
+	if len(fields) != 6 || fields[1] != argon2idID {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if _, err = fmt.Sscanf(fields[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if _, err = fmt.Sscanf(
+		fields[3],
+		"m=%d,t=%d,p=%d",
+		&params.Memory,
+		&params.Time,
+		&params.Threads,
+	); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if salt, err = b64.DecodeString(fields[4]); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if hash, err = b64.DecodeString(fields[5]); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	return params, salt, hash, nil
+}
+
+// PBKDF2Hasher hashes passwords with PBKDF2-SHA256.
+type PBKDF2Hasher struct {
+	// Iterations is the number of rounds of the function.
+	Iterations int
+	// KeyLen is the length of the resulting hash in bytes.
+	KeyLen int
+}
+
+// legacyPBKDF2Hasher returns the PBKDF2Hasher that produced the passwords of
+// users created before hashes were stored as PHC strings.
+func legacyPBKDF2Hasher() PBKDF2Hasher {
+	return PBKDF2Hasher{Iterations: 600000, KeyLen: 32}
+}
+
+// ID returns "pbkdf2-sha256".
+func (p PBKDF2Hasher) ID() string {
+	return pbkdf2SHA256ID
+}
+
+// Hash returns the PHC string of pw.
+func (p PBKDF2Hasher) Hash(pw string) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	hash := pbkdf2.Key([]byte(pw), salt, p.Iterations, p.KeyLen, sha256.New)
+	return pbkdf2PHC(p.Iterations, salt, hash), nil
+}
+
+// Verify returns true if and only if pw matches the PHC string phc.
+func (p PBKDF2Hasher) Verify(pw, phc string) (bool, error) {
+	iterations, salt, hash, err := p.parse(phc)
+	if err != nil {
+		return false, err
+	}
+	check := pbkdf2.Key([]byte(pw), salt, iterations, len(hash), sha256.New)
+	return subtle.ConstantTimeCompare(hash, check) == 1, nil
+}
+
+// NeedsRehash returns true if phc was not produced with the parameters of p.
+func (p PBKDF2Hasher) NeedsRehash(phc string) bool {
+	iterations, _, hash, err := p.parse(phc)
+	if err != nil {
+		return true
+	}
+	return iterations != p.Iterations || len(hash) != p.KeyLen
+}
+
+// parse returns the iterations, salt and hash of the PHC string phc.
+func (p PBKDF2Hasher) parse(
+	phc string,
+) (iterations int, salt, hash []byte, err error) {
+	fields := strings.Split(phc, "$")
+	if len(fields) != 5 || fields[1] != pbkdf2SHA256ID {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	if _, err = fmt.Sscanf(fields[2], "i=%d", &iterations); err != nil {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	if salt, err = b64.DecodeString(fields[3]); err != nil {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	if hash, err = b64.DecodeString(fields[4]); err != nil {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	return iterations, salt, hash, nil
+}
+
+// pbkdf2PHC returns the PHC string of a PBKDF2-SHA256 hash.
+func pbkdf2PHC(iterations int, salt, hash []byte) string {
+	return fmt.Sprintf(
+		"$%s$i=%d$%s$%s",
+		pbkdf2SHA256ID,
+		iterations,
+		b64.EncodeToString(salt),
+		b64.EncodeToString(hash),
+	)
+}
+
+// newSalt returns a random salt.
+func newSalt() ([]byte, error) {
+	b := make([]byte, saltSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"errors"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Permissions that can be granted to a Role.
+const (
+	// PermUserList allows listing every user.
+	PermUserList = "user.list"
+	// PermUserRead allows reading any user.
+	PermUserRead = "user.read"
+	// PermRoleManage allows creating roles and assigning them to users.
+	PermRoleManage = "role.manage"
+	// PermSessionRevoke allows revoking the sessions of any user.
+	PermSessionRevoke = "session.revoke"
+	// PermUserUnlock allows lifting the login lockout of any user.
+	PermUserUnlock = "user.unlock"
+)
+
+// AdminRole is the name of the role holding every permission.
+const AdminRole = "admin"
+
+// AllPermissions returns the name of every permission.
+func AllPermissions() []string {
+	return []string{
+		PermUserList,
+		PermUserRead,
+		PermRoleManage,
+		PermSessionRevoke,
+		PermUserUnlock,
+	}
+}
+
+// Permission represents an action a Role allows.
+type Permission struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"unique;type:varchar(64)"`
+}
+
+// Role represents a set of permissions that can be assigned to users.
+type Role struct {
+	ID          uint         `gorm:"primarykey"`
+	Name        string       `gorm:"unique;type:varchar(64)"`
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+}
+
+// PermissionNames returns the names of the permissions granted to u by its
+// roles. Roles and their permissions are expected to be preloaded.
+func (u User) PermissionNames() []string {
+	var names []string
+	for _, role := range u.Roles {
+		for _, perm := range role.Permissions {
+			if !slices.Contains(names, perm.Name) {
+				names = append(names, perm.Name)
+			}
+		}
+	}
+	return names
+}
+
+// seedRoles creates every permission and the admin role holding them.
+func seedRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		perms := make([]Permission, len(AllPermissions()))
+		for i, name := range AllPermissions() {
+			perms[i] = Permission{Name: name}
+		}
+		if r := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(
+			&perms,
+		); r.Error != nil {
+			return r.Error
+		}
+		if r := tx.Where("name IN ?", AllPermissions()).Find(
+			&perms,
+		); r.Error != nil {
+			return r.Error
+		}
+		admin := Role{Name: AdminRole}
+		if r := tx.Where(&admin).FirstOrCreate(&admin); r.Error != nil {
+			return r.Error
+		}
+		return tx.Model(&admin).Association("Permissions").Replace(perms)
+	})
+}
+
+// BootstrapAdmin assigns the admin role to the user named username provided
+// that no user holds it yet. It is a noop if there is no such user.
+func BootstrapAdmin(db *gorm.DB, username string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var admin Role
+		if r := tx.First(&admin, "name = ?", AdminRole); r.Error != nil {
+			return r.Error
+		}
+		var count int64
+		if r := tx.Table("user_roles").Where(
+			"role_id = ?",
+			admin.ID,
+		).Count(&count); r.Error != nil || count > 0 {
+			return r.Error
+		}
+		var user User
+		r := tx.First(&user, "username = ?", username)
+		if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if r.Error != nil {
+			return r.Error
+		}
+		return tx.Model(&user).Association("Roles").Append(&admin)
+	})
+}
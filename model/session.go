@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// Session represents the server side state of an authenticated User session.
+type Session struct {
+	ID         string `gorm:"primaryKey;type:varchar(64)"`
+	UserID     uint   `gorm:"index;not null"`
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	UserAgent  string     `gorm:"type:varchar(512)"`
+	IP         string     `gorm:"type:varchar(64)"`
+	Scopes     string     `gorm:"type:varchar(512)"`
+	RevokedAt  *time.Time `gorm:"index"`
+	// AuthenticatedAt is the last time the user proved its identity on the
+	// session, either by logging in or by re-authenticating.
+	AuthenticatedAt *time.Time
+	// ClientID identifies the OAuthClient the session was granted to, if
+	// any.
+	ClientID string `gorm:"index;type:varchar(64)"`
+	// RefreshNonce identifies the only refresh token of the session that can
+	// still be used.
+	RefreshNonce string `json:"-" gorm:"type:varchar(64)"`
+}
+
+// Active returns true if and only if s has neither been revoked nor expired.
+func (s Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// OneTimeToken records a token that was issued to a User and can only be
+// used once, such as a magic link.
+type OneTimeToken struct {
+	ID        string `gorm:"primaryKey;type:varchar(64)"`
+	UserID    uint   `gorm:"index;not null"`
+	Purpose   string `gorm:"type:varchar(32)"`
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	// SessionID identifies the session the token was exchanged for, if any.
+	SessionID string `gorm:"type:varchar(64)"`
+}
+
+// Usable returns true if and only if t has neither been used nor expired.
+func (t OneTimeToken) Usable() bool {
+	return t.UsedAt == nil && time.Now().Before(t.ExpiresAt)
+}
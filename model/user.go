@@ -1,11 +1,9 @@
 package model
 
 import (
-	"bytes"
-	"crypto/rand"
-	"crypto/sha256"
+	"strings"
+	"time"
 
-	"golang.org/x/crypto/pbkdf2"
 	"gorm.io/gorm"
 )
 
@@ -14,35 +12,102 @@ type User struct {
 	gorm.Model `gorm:"embedded"`
 	Username   string `gorm:"unique;type:varchar(256)"`
 	Email      string `gorm:"unique;type:varchar(256)"`
-	Salt       []byte `json:"-" gorm:"size:8"`
-	Password   []byte `json:"-" gorm:"size:32"`
+	// EmailVerifiedAt is set once the user proves it owns Email.
+	EmailVerifiedAt *time.Time `json:"-"`
+	// PasswordHash is the PHC string of the user's password.
+	PasswordHash string `json:"-" gorm:"type:varchar(256)"`
+	// Salt and Password hold the PBKDF2-SHA256 hash of passwords set before
+	// PasswordHash was introduced. They are cleared once the password is
+	// hashed again.
+	Salt     []byte `json:"-" gorm:"size:8"`
+	Password []byte `json:"-" gorm:"size:32"`
+	Roles    []Role `json:"-" gorm:"many2many:user_roles"`
+	// Directory names the external directory that manages the user's
+	// credentials, if any. Such users have no local password.
+	Directory string `json:"-" gorm:"type:varchar(32)"`
+	// TOTPSecret is set on enrollment but only used for authentication once
+	// TOTPEnabledAt is set.
+	TOTPSecret    []byte     `json:"-" gorm:"size:20"`
+	TOTPEnabledAt *time.Time `json:"-"`
+	// TOTPLastStep is the time step of the last accepted code, which can not
+	// be used again.
+	TOTPLastStep int64 `json:"-"`
+}
+
+// RecoveryCode represents a single use code that can replace a TOTP code.
+type RecoveryCode struct {
+	ID     uint   `gorm:"primarykey"`
+	UserID uint   `gorm:"index;not null"`
+	Hash   []byte `gorm:"size:32"`
+	UsedAt *time.Time
+}
+
+// MFAEnabled returns true if and only if u requires a second factor to log
+// in.
+func (u User) MFAEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// Managed returns true if and only if u's credentials are managed by an
+// external directory.
+func (u User) Managed() bool {
+	return u.Directory != ""
+}
+
+// EmailVerified returns true if and only if u has proven it owns its email
+// address.
+func (u User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
 
 // SetPassword sets u corresponding fields such that it can be authenticated
-// using pw.
+// using pw. The password is hashed with the default PasswordHasher.
 func (u *User) SetPassword(pw string) error {
-	if err := u.newSalt(); err != nil {
+	hash, err := currentHasher().Hash(pw)
+	if err != nil {
 		return err
 	}
-	// Following recommendation from:
-	// https://cheatsheetseries.owasp.org/cheatsheets/Password_Storage_Cheat_Sheet.html#pbkdf2
-	u.Password = pbkdf2.Key([]byte(pw), u.Salt, 600000, 32, sha256.New)
+	u.PasswordHash = hash
+	u.Salt = nil
+	u.Password = nil
 	return nil
 }
 
 // CheckPassword return true if and only if pw corresponds to the string with
 // which u.SetPassword was called.
 func (u *User) CheckPassword(pw string) bool {
-	check := pbkdf2.Key([]byte(pw), u.Salt, 600000, 32, sha256.New)
-	return bytes.Equal(u.Password, check)
+	phc := u.passwordPHC()
+	h, err := hasherFor(phc)
+	if err != nil {
+		return false
+	}
+	ok, err := h.Verify(pw, phc)
+	return err == nil && ok
 }
 
-// newSalt set's u.Salt to a random 8 byte string.
-func (u *User) newSalt() error {
-	b := make([]byte, 8)
-	if _, err := rand.Read(b); err != nil {
-		return err
+// SimulatePasswordCheck spends as long as CheckPassword would on pw so that
+// checks for users that do not exist take as long as those that do.
+func SimulatePasswordCheck(pw string) {
+	_, _ = currentHasher().Hash(pw)
+}
+
+// PasswordNeedsRehash returns true if u's password was not hashed with the
+// default PasswordHasher and its current parameters.
+func (u *User) PasswordNeedsRehash() bool {
+	phc := u.passwordPHC()
+	h := currentHasher()
+	if !strings.HasPrefix(phc, "$"+h.ID()+"$") {
+		return true
 	}
-	u.Salt = b
-	return nil
+	return h.NeedsRehash(phc)
+}
+
+// passwordPHC returns the PHC string of u's password, building it from the
+// legacy fields if needed.
+func (u *User) passwordPHC() string {
+	if u.PasswordHash != "" || len(u.Password) == 0 {
+		return u.PasswordHash
+	}
+	legacy := legacyPBKDF2Hasher()
+	return pbkdf2PHC(legacy.Iterations, u.Salt, u.Password)
 }
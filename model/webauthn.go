@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// WebAuthnCredential represents a passkey of a User, a public key credential
+// registered through the Web Authentication API and named by CredentialID.
+type WebAuthnCredential struct {
+	ID           uint   `gorm:"primarykey"`
+	UserID       uint   `gorm:"index;not null"`
+	Name         string `gorm:"type:varchar(64)"`
+	CredentialID []byte `gorm:"unique;size:1023"`
+	// PublicKey is the COSE encoded public key of the credential and
+	// Algorithm the COSE identifier of its signature algorithm.
+	PublicKey []byte `json:"-"`
+	Algorithm int
+	// SignCount is the signature counter last reported by the
+	// authenticator, which only ever grows unless it does not keep one.
+	SignCount uint32
+	// AAGUID identifies the model of the authenticator.
+	AAGUID []byte `gorm:"column:aaguid;size:16"`
+	// Transports are the space separated ways the authenticator can be
+	// reached, as reported on registration.
+	Transports string `gorm:"type:varchar(128)"`
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
@@ -0,0 +1,204 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix is prepended to every API key so they can be told apart from
+// session tokens.
+const apiKeyPrefix = "gak_"
+
+// CreateAPIKey creates a new API key for user as specified by form and
+// returns it along with its secret. The secret is not stored so it can not be
+// recovered afterwards. A key can only be granted scopes held by cred, the
+// credential of the request creating it.
+func (m UserAuthManager) CreateAPIKey(
+	user model.User,
+	cred Credential,
+	form schema.APIKeyForm,
+	c *gin.Context,
+) (key model.APIKey, secret string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create api key: %w", err)
+		}
+	}()
+
+	for _, scope := range form.Scopes {
+		if !slices.Contains(AllScopes(), scope) {
+			return key, "", fmt.Errorf("%w '%s'", ErrUnknownScope, scope)
+		}
+	}
+	if len(cred.MissingScopes(form.Scopes...)) > 0 {
+		return key, "", ErrScopeNotGranted
+	}
+
+	prefix, err := randomString(9)
+	if err != nil {
+		return key, "", err
+	}
+	keySecret, err := randomString(32)
+	if err != nil {
+		return key, "", err
+	}
+	hash := sha256.Sum256([]byte(keySecret))
+	key = model.APIKey{
+		UserID:    user.ID,
+		Name:      form.Name,
+		Prefix:    prefix,
+		Hash:      hash[:],
+		Scopes:    joinScopes(form.Scopes),
+		ExpiresAt: form.ExpiresAt,
+	}
+	if r := m.db.WithContext(c.Request.Context()).Create(&key); r.Error != nil {
+		return key, "", r.Error
+	}
+	return key, apiKeyPrefix + prefix + "." + keySecret, nil
+}
+
+// ListAPIKeys returns the API keys of user.
+func (m UserAuthManager) ListAPIKeys(
+	user model.User,
+	c *gin.Context,
+) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	if r := m.db.WithContext(c.Request.Context()).Where(
+		"user_id = ?",
+		user.ID,
+	).Order("created_at DESC").Find(&keys); r.Error != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", r.Error)
+	}
+	return keys, nil
+}
+
+// UpdateAPIKey changes the name and expiration of the API key of user with
+// identifier id to match those in form. If no such key exists
+// ErrAPIKeyNotFound is returned.
+func (m UserAuthManager) UpdateAPIKey(
+	user model.User,
+	id uint,
+	form schema.APIKeyUpdateForm,
+	c *gin.Context,
+) (key model.APIKey, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to update api key: %w", err)
+		}
+	}()
+
+	db := m.db.WithContext(c.Request.Context())
+	if key, err = m.userAPIKey(db, user, id); err != nil {
+		return key, err
+	}
+	if form.Name != "" {
+		key.Name = form.Name
+	}
+	if form.ExpiresAt != nil {
+		key.ExpiresAt = form.ExpiresAt
+	}
+	if r := db.Save(&key); r.Error != nil {
+		return key, r.Error
+	}
+	return key, nil
+}
+
+// RevokeAPIKey revokes the API key of user with identifier id. If no such key
+// exists ErrAPIKeyNotFound is returned.
+func (m UserAuthManager) RevokeAPIKey(
+	user model.User,
+	id uint,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to revoke api key: %w", err)
+		}
+	}()
+
+	db := m.db.WithContext(c.Request.Context())
+	key, err := m.userAPIKey(db, user, id)
+	if err != nil {
+		return err
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+	return db.Model(&key).Update("revoked_at", time.Now()).Error
+}
+
+// userAPIKey returns the API key of user with identifier id.
+func (m UserAuthManager) userAPIKey(
+	db *gorm.DB,
+	user model.User,
+	id uint,
+) (model.APIKey, error) {
+	var key model.APIKey
+	r := db.First(&key, "id = ? AND user_id = ?", id, user.ID)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return key, ErrAPIKeyNotFound
+	}
+	return key, r.Error
+}
+
+// retrieveAPIKey returns the owner and credential of the API key s provided
+// that it is valid and active. The key's last use is updated.
+func (m UserAuthManager) retrieveAPIKey(
+	s string,
+	c *gin.Context,
+) (user model.User, cred Credential, err error) {
+	prefix, secret, ok := strings.Cut(
+		strings.TrimPrefix(s, apiKeyPrefix),
+		".",
+	)
+	if !ok {
+		return user, cred, ErrInvalidToken
+	}
+	db := m.db.WithContext(c.Request.Context())
+	var key model.APIKey
+	r := db.First(&key, "prefix = ?", prefix)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return user, cred, ErrInvalidToken
+	}
+	if r.Error != nil {
+		return user, cred, r.Error
+	}
+	hash := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(hash[:], key.Hash) != 1 {
+		return user, cred, ErrInvalidToken
+	}
+	if !key.Active() {
+		return user, cred, ErrTokenExpired
+	}
+	if r = db.Preload("Roles.Permissions").First(
+		&user,
+		key.UserID,
+	); r.Error != nil {
+		return user, cred, r.Error
+	}
+	// As with sessions, usage is only recorded once per minute.
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > time.Minute {
+		if r = db.Model(&key).Update(
+			"last_used_at",
+			time.Now(),
+		); r.Error != nil {
+			return user, cred, r.Error
+		}
+	}
+	return user, Credential{
+		APIKeyID:    key.ID,
+		Transport:   BearerTransport,
+		Scopes:      splitScopes(key.Scopes),
+		Permissions: user.PermissionNames(),
+	}, nil
+}
@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"gin-gorm-api/model"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// An AttemptStore persists the failed login attempts made under a key.
+type AttemptStore interface {
+	// Get returns the attempts recorded under key. If there are none a
+	// LoginAttempt with no failures is returned.
+	Get(c context.Context, key string) (model.LoginAttempt, error)
+	// Fail records a failed attempt under key and returns the updated
+	// record. Failures older than window are forgotten.
+	Fail(
+		c context.Context,
+		key string,
+		window time.Duration,
+	) (model.LoginAttempt, error)
+	// Lock blocks attempts under key until the given time.
+	Lock(c context.Context, key string, until time.Time) error
+	// Reset forgets every attempt recorded under key.
+	Reset(c context.Context, key string) error
+}
+
+// DBAttemptStore is an AttemptStore backed by a database.
+type DBAttemptStore struct {
+	db *gorm.DB
+}
+
+// NewDBAttemptStore returns a DBAttemptStore that uses db for persistence.
+func NewDBAttemptStore(db *gorm.DB) DBAttemptStore {
+	return DBAttemptStore{db}
+}
+
+func (s DBAttemptStore) Get(
+	c context.Context,
+	key string,
+) (model.LoginAttempt, error) {
+	var attempt model.LoginAttempt
+	r := s.db.WithContext(c).First(&attempt, "key = ?", key)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return model.LoginAttempt{Key: key}, nil
+	}
+	return attempt, r.Error
+}
+
+func (s DBAttemptStore) Fail(
+	c context.Context,
+	key string,
+	window time.Duration,
+) (attempt model.LoginAttempt, err error) {
+	err = s.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		// Make sure the row exists so it can be locked.
+		if r := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(
+			&model.LoginAttempt{Key: key},
+		); r.Error != nil {
+			return r.Error
+		}
+		if r := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(
+			&attempt,
+			"key = ?",
+			key,
+		); r.Error != nil {
+			return r.Error
+		}
+		now := time.Now()
+		if now.Sub(attempt.LastFailureAt) > window {
+			attempt.Failures = 0
+		}
+		attempt.Failures++
+		attempt.LastFailureAt = now
+		return tx.Save(&attempt).Error
+	})
+	return attempt, err
+}
+
+func (s DBAttemptStore) Lock(
+	c context.Context,
+	key string,
+	until time.Time,
+) error {
+	return s.db.WithContext(c).Model(&model.LoginAttempt{}).Where(
+		"key = ?",
+		key,
+	).Update("locked_until", until).Error
+}
+
+func (s DBAttemptStore) Reset(c context.Context, key string) error {
+	return s.db.WithContext(c).Delete(
+		&model.LoginAttempt{},
+		"key = ?",
+		key,
+	).Error
+}
+
+// MemoryAttemptStore is an AttemptStore that keeps attempts in memory. It is
+// meant for testing and single instance deployments.
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempt
+}
+
+// NewMemoryAttemptStore returns an empty MemoryAttemptStore.
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]model.LoginAttempt)}
+}
+
+func (s *MemoryAttemptStore) Get(
+	_ context.Context,
+	key string,
+) (model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return model.LoginAttempt{Key: key}, nil
+	}
+	return attempt, nil
+}
+
+func (s *MemoryAttemptStore) Fail(
+	_ context.Context,
+	key string,
+	window time.Duration,
+) (model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = model.LoginAttempt{Key: key}
+	}
+	now := time.Now()
+	if now.Sub(attempt.LastFailureAt) > window {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	s.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (s *MemoryAttemptStore) Lock(
+	_ context.Context,
+	key string,
+	until time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+	attempt.LockedUntil = &until
+	s.attempts[key] = attempt
+	return nil
+}
+
+func (s *MemoryAttemptStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
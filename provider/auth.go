@@ -1,15 +1,14 @@
 package provider
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"gin-gorm-api/config"
 	"gin-gorm-api/model"
 	"gin-gorm-api/schema"
 	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -23,11 +22,23 @@ const (
 	_ tokenType = iota
 	sessionToken
 	resetToken
+	refreshToken
+	mfaToken
+	verifyEmailToken
+	magicLinkToken
+	changeEmailToken
+	revertEmailToken
+	oidcFlowToken
+	authCodeToken
+	webAuthnCreateToken
+	webAuthnGetToken
 )
 
 // An authToken is a signed string that identifies a user and a time frame for
-// it to be used.
+// it to be used. Its fields other than Info are only set by the native token
+// format.
 type authToken struct {
+	KeyID            string        `json:"kid,omitempty"`
 	Info             authTokenInfo `json:"info"`
 	VerificationCode string        `json:"verification_code"`
 }
@@ -36,24 +47,86 @@ type authToken struct {
 type authTokenInfo struct {
 	UserID    uint      `json:"user_id"`
 	Type      tokenType `json:"type"`
+	SessionID string    `json:"session_id,omitempty"`
+	Nonce     string    `json:"nonce,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Provider  string    `json:"provider,omitempty"`
+	State     string    `json:"state,omitempty"`
+	Verifier  string    `json:"verifier,omitempty"`
+	ClientID  string    `json:"client_id,omitempty"`
+	Redirect  string    `json:"redirect,omitempty"`
+	Challenge string    `json:"challenge,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Audience  []string  `json:"audience,omitempty"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
+// newTokenInfo returns the authTokenInfo of a token of type t for the user
+// with identifier id that is valid from now and for the given duration.
+func newTokenInfo(
+	id uint,
+	t tokenType,
+	duration time.Duration,
+) authTokenInfo {
+	now := time.Now()
+	return authTokenInfo{
+		UserID:    id,
+		Type:      t,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(duration),
+	}
+}
+
 // A UserAuthManager can perform basic authentication tasks based on
-// model.User. It uses HMAC-SHA256 for token signing.
+// model.User. Tokens are encoded and signed by a tokenCodec, by default with
+// HMAC-SHA256 using keys taken from a keyring so they can be rotated, and the
+// state of sessions is kept in a SessionStore so they can be revoked before
+// they expire.
+//
+// Sessions are renewed through single use refresh tokens. Each refresh
+// rotates the session's refresh token and replaying an already used one
+// revokes the session altogether.
 type UserAuthManager struct {
-	db      *gorm.DB
-	msm     Mailer
-	secret  []byte
-	UserKey string
-	secure  bool
+	db         *gorm.DB
+	msm        Mailer
+	stores     Stores
+	codec      tokenCodec
+	keys       keyring
+	UserKey    string
+	cookies    cookieJar
+	sessionTTL time.Duration
+	refreshTTL time.Duration
+	cookieAuth bool
+	bearerAuth bool
+	totpIssuer string
+	throttle   config.ThrottleConfig
+	resetTTL   time.Duration
+	verifyTTL  time.Duration
+	// mustVerify makes Authenticate refuse users whose email address
+	// has not been verified.
+	mustVerify bool
+	magicTTL   time.Duration
+	magicURL   string
+	hideUsers  bool
+	revertTTL  time.Duration
+	revertURL  string
+	reauthTTL  time.Duration
+	issuer     string
+	audience   string
+	legacyTTL  time.Duration
+	oidc       oidcClient
+	codeTTL    time.Duration
+	authn      []Authenticator
+	webauthn   webAuthnParty
 }
 
 // NewUserAuthManager returns a UserAuthManager.
 func NewUserAuthManager(
 	db *gorm.DB,
 	msm Mailer,
+	stores Stores,
 	conf config.Config,
 	userKey string,
 ) (manager UserAuthManager, err error) {
@@ -63,24 +136,77 @@ func NewUserAuthManager(
 		}
 	}()
 
-	secretB, err := base64.StdEncoding.DecodeString(conf.Secret)
+	keys, err := newKeyring(
+		conf.Secret,
+		conf.Auth.SigningKeys,
+		conf.Auth.SigningKeyID,
+	)
 	if err != nil {
 		return UserAuthManager{}, err
 	}
-	if len(secretB) != 64 {
-		return UserAuthManager{}, ErrInvalidSecretSize
+	codec, err := newTokenCodec(conf.Auth, keys)
+	if err != nil {
+		return UserAuthManager{}, err
+	}
+	cookies, err := newCookieJar(conf, keys)
+	if err != nil {
+		return UserAuthManager{}, err
+	}
+	transports, err := parseTransports(conf.Auth.Transports)
+	if err != nil {
+		return UserAuthManager{}, err
+	}
+	authn, err := newAuthenticators(db, conf.Auth)
+	if err != nil {
+		return UserAuthManager{}, err
+	}
+	webauthn, err := newWebAuthnParty(conf.Auth.WebAuthn)
+	if err != nil {
+		return UserAuthManager{}, err
 	}
 	manager = UserAuthManager{
-		db:      db,
-		msm:     msm,
-		secret:  secretB,
-		secure:  !conf.Debug,
-		UserKey: userKey,
+		db:         db,
+		msm:        msm,
+		stores:     stores,
+		codec:      codec,
+		keys:       keys,
+		cookies:    cookies,
+		UserKey:    userKey,
+		sessionTTL: conf.Auth.SessionTTL,
+		refreshTTL: conf.Auth.RefreshTTL,
+		cookieAuth: slices.Contains(transports, CookieTransport),
+		bearerAuth: slices.Contains(transports, BearerTransport),
+		totpIssuer: conf.Auth.TOTPIssuer,
+		throttle:   conf.Auth.Throttle,
+		resetTTL:   conf.Auth.ResetTTL,
+		verifyTTL:  conf.Auth.EmailVerificationTTL,
+		mustVerify: conf.Auth.RequireVerifiedEmail,
+		magicTTL:   conf.Auth.MagicLinkTTL,
+		magicURL:   conf.Auth.MagicLinkURL,
+		hideUsers:  conf.Auth.PreventEnumeration,
+		revertTTL:  conf.Auth.EmailRevertTTL,
+		revertURL:  conf.Auth.EmailRevertURL,
+		reauthTTL:  conf.Auth.ReauthenticationWindow,
+		issuer:     conf.Auth.TokenIssuer,
+		audience:   conf.Auth.TokenAudience,
+		legacyTTL:  conf.Auth.LegacyTokenGrace,
+		oidc:       newOIDCClient(conf.Auth.OIDC),
+		codeTTL:    conf.Auth.OAuthCodeTTL,
+		authn:      authn,
+		webauthn:   webauthn,
 	}
 	return manager, nil
 }
 
-// Authenticate the credentials in form and returns their corresponding user.
+// Authenticate the credentials in form and returns their corresponding user,
+// as vouched for by the first of the configured authenticators that knows
+// it.
+//
+// Failed attempts are counted per username and per client address and once
+// either goes past its limit further attempts fail with a ThrottleError until
+// the block expires. If verified emails are required, users that have not
+// verified theirs fail with ErrEmailNotVerified once their password is
+// checked.
 func (m UserAuthManager) Authenticate(
 	form schema.LoginForm,
 	c *gin.Context,
@@ -91,77 +217,411 @@ func (m UserAuthManager) Authenticate(
 		}
 	}()
 
-	r := m.db.WithContext(c.Request.Context()).First(
-		&user,
-		"username = ?",
-		form.Username,
-	)
-	if r.Error != nil {
-		return model.User{}, r.Error
+	keys := m.loginKeys(form.Username, c)
+	if err = m.checkAttempts(c, keys...); err != nil {
+		return model.User{}, err
 	}
-	if !user.CheckPassword(form.Password) {
+	user, err = m.authenticate(c, form.Username, form.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		if err = m.failAttempt(c, keys...); err != nil {
+			return model.User{}, err
+		}
 		return model.User{}, ErrInvalidCredentials
 	}
+	if err != nil {
+		return model.User{}, err
+	}
+	// Users with a second factor are only cleared once it is provided too.
+	if !user.MFAEnabled() {
+		err = m.stores.Attempts.Reset(c.Request.Context(), keys[0].key)
+		if err != nil {
+			return model.User{}, err
+		}
+	}
+	if m.mustVerify && !user.EmailVerified() {
+		return model.User{}, ErrEmailNotVerified
+	}
 	return user, nil
 }
 
-// RegisterSession generates an authentication token for user and calls
-// c.SetCookie with it.
+// RegisterSession stores a new session for user, generates its
+// authentication and refresh tokens and calls c.SetCookie with them.
 func (m UserAuthManager) RegisterSession(
 	user model.User,
 	c *gin.Context,
 ) error {
-	seconds := 3600
-	token := m.signedToken(
-		user.ID,
-		sessionToken,
-		time.Now(),
-		time.Duration(seconds)*time.Second,
-	)
-	tokenB, err := json.Marshal(&token)
+	if !m.cookieAuth {
+		return fmt.Errorf(
+			"failed to register session: %w",
+			ErrTransportDisabled,
+		)
+	}
+	tokens, err := m.createSession(user, c)
 	if err != nil {
 		return fmt.Errorf("failed to register session: %w", err)
 	}
-	tokenS := base64.URLEncoding.EncodeToString(tokenB)
-	c.SetCookie("user_session", tokenS, seconds, "/", "", m.secure, true)
+	if err = m.setSessionCookies(tokens, c); err != nil {
+		return fmt.Errorf("failed to register session: %w", err)
+	}
 	return nil
 }
 
-// RetrieveSession call c.Cookie to obtain a session's authentication token and
-// if a valid one is found returns the corresponding user.
-func (m UserAuthManager) RetrieveSession(
+// RegisterBearerSession stores a new session for user and returns its
+// authentication and refresh tokens so they can be handed to the client
+// instead of being set as cookies.
+func (m UserAuthManager) RegisterBearerSession(
+	user model.User,
+	c *gin.Context,
+) (SessionTokens, error) {
+	if !m.bearerAuth {
+		return SessionTokens{}, fmt.Errorf(
+			"failed to register session: %w",
+			ErrTransportDisabled,
+		)
+	}
+	tokens, err := m.createSession(user, c)
+	if err != nil {
+		return tokens, fmt.Errorf("failed to register session: %w", err)
+	}
+	return tokens, nil
+}
+
+// createSession stores a new session for user and returns its tokens.
+func (m UserAuthManager) createSession(
+	user model.User,
+	c *gin.Context,
+) (SessionTokens, error) {
+	session, err := m.newSession(user, c)
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	err = m.stores.Sessions.Create(c.Request.Context(), session)
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	return m.sessionTokens(session)
+}
+
+// RefreshSession reads a session's refresh token from its cookie and if a
+// valid one is found rotates it, renews the session's cookies and returns the
+// corresponding user. If the refresh token was already used the whole session
+// is revoked and ErrTokenReused is returned.
+func (m UserAuthManager) RefreshSession(
 	c *gin.Context,
 ) (user model.User, err error) {
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("failed to retrieve session: %w", err)
+			err = fmt.Errorf("failed to refresh session: %w", err)
 		}
 	}()
 
-	s, err := c.Cookie("user_session")
+	if !m.cookieAuth {
+		return user, ErrTransportDisabled
+	}
+	s, err := m.cookies.get(c, m.cookies.refresh)
 	if err != nil {
 		return user, err
 	}
-	token, err := m.parseToken(s)
+	user, tokens, err := m.refreshSession(s, "", c)
 	if err != nil {
 		return user, err
 	}
-	if r := m.db.WithContext(c.Request.Context()).First(
+	return user, m.setSessionCookies(tokens, c)
+}
+
+// RefreshBearerSession behaves as RefreshSession but takes the refresh token
+// from form and returns the renewed tokens instead of setting them as
+// cookies.
+func (m UserAuthManager) RefreshBearerSession(
+	form schema.RefreshForm,
+	c *gin.Context,
+) (tokens SessionTokens, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to refresh session: %w", err)
+		}
+	}()
+
+	if !m.bearerAuth {
+		return tokens, ErrTransportDisabled
+	}
+	_, tokens, err = m.refreshSession(form.RefreshToken, "", c)
+	return tokens, err
+}
+
+// refreshSession validates the refresh token encoded in s and if it is valid
+// rotates it and returns the session's user and renewed tokens. Only sessions
+// granted to the OAuth client with identifier clientID, none if empty, can be
+// refreshed.
+func (m UserAuthManager) refreshSession(
+	s string,
+	clientID string,
+	c *gin.Context,
+) (user model.User, tokens SessionTokens, err error) {
+	token, err := m.parseToken(s, refreshToken)
+	if err != nil {
+		return user, tokens, err
+	}
+	ctx := c.Request.Context()
+	session, err := m.stores.Sessions.Get(ctx, token.Info.SessionID)
+	if err != nil {
+		return user, tokens, err
+	}
+	if !session.Active() || session.UserID != token.Info.UserID {
+		return user, tokens, ErrSessionRevoked
+	}
+	if session.ClientID != clientID {
+		return user, tokens, ErrWrongClient
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return user, tokens, err
+	}
+	session.ExpiresAt = time.Now().Add(m.refreshTTL)
+	err = m.stores.Sessions.Rotate(
+		ctx,
+		session.ID,
+		token.Info.Nonce,
+		nonce,
+		session.ExpiresAt,
+	)
+	if errors.Is(err, ErrTokenReused) {
+		if rErr := m.stores.Sessions.Revoke(ctx, session.ID); rErr != nil {
+			return user, tokens, errors.Join(err, rErr)
+		}
+		return user, tokens, err
+	}
+	if err != nil {
+		return user, tokens, err
+	}
+	session.RefreshNonce = nonce
+	if r := m.db.WithContext(ctx).First(&user, session.UserID); r.Error != nil {
+		return user, tokens, r.Error
+	}
+	tokens, err = m.sessionTokens(session)
+	return user, tokens, err
+}
+
+// newSession returns a new model.Session for user with the client
+// information found in c.
+func (m UserAuthManager) newSession(
+	user model.User,
+	c *gin.Context,
+) (model.Session, error) {
+	id, err := randomString(32)
+	if err != nil {
+		return model.Session{}, err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return model.Session{}, err
+	}
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	now := time.Now()
+	session := model.Session{
+		ID:           id,
+		UserID:       user.ID,
+		CreatedAt:    now,
+		LastSeenAt:   now,
+		ExpiresAt:    now.Add(m.refreshTTL),
+		UserAgent:    userAgent,
+		IP:           c.ClientIP(),
+		Scopes:       joinScopes(AllScopes()),
+		RefreshNonce: nonce,
+	}
+	// Sessions are only created once the user proves its identity.
+	session.AuthenticatedAt = &now
+	return session, nil
+}
+
+// sessionTokens generates the authentication and refresh tokens of session.
+func (m UserAuthManager) sessionTokens(
+	session model.Session,
+) (SessionTokens, error) {
+	info := newTokenInfo(session.UserID, sessionToken, m.sessionTTL)
+	info.SessionID = session.ID
+	info.Scopes = splitScopes(session.Scopes)
+	info.ClientID = session.ClientID
+	access, err := m.encodedToken(info)
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	scopes := info.Scopes
+	info = newTokenInfo(session.UserID, refreshToken, m.refreshTTL)
+	info.SessionID = session.ID
+	info.Nonce = session.RefreshNonce
+	refresh, err := m.encodedToken(info)
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	return SessionTokens{
+		Access:    access,
+		Refresh:   refresh,
+		ExpiresIn: m.sessionTTL,
+		Scopes:    scopes,
+		sessionID: session.ID,
+	}, nil
+}
+
+// setSessionCookies sets the session and refresh cookies to the given tokens
+// and sends the CSRF token of their session in the CSRFHeader.
+func (m UserAuthManager) setSessionCookies(
+	tokens SessionTokens,
+	c *gin.Context,
+) error {
+	err := m.cookies.set(c, m.cookies.session, tokens.Access, m.sessionTTL)
+	if err != nil {
+		return err
+	}
+	err = m.cookies.set(c, m.cookies.refresh, tokens.Refresh, m.refreshTTL)
+	if err != nil {
+		return err
+	}
+	c.Header(CSRFHeader, m.CSRFToken(tokens.sessionID))
+	return nil
+}
+
+// RetrieveSession obtains a session's authentication token from the request's
+// bearer authorization header or session cookie, as allowed by the enabled
+// transports, and if a valid one, whose session has not been revoked, is found
+// returns the corresponding user and credential. The session's last activity
+// is updated with the client information found in c. API keys are also
+// accepted as bearer tokens.
+func (m UserAuthManager) RetrieveSession(
+	c *gin.Context,
+) (user model.User, cred Credential, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve session: %w", err)
+		}
+	}()
+
+	s, transport, err := m.requestToken(c)
+	if err != nil {
+		return user, cred, err
+	}
+	if transport == BearerTransport && strings.HasPrefix(s, apiKeyPrefix) {
+		return m.retrieveAPIKey(s, c)
+	}
+	token, err := m.parseToken(s, sessionToken)
+	if err != nil {
+		return user, cred, err
+	}
+	ctx := c.Request.Context()
+	session, err := m.stores.Sessions.Get(ctx, token.Info.SessionID)
+	if err != nil {
+		return user, cred, err
+	}
+	if !session.Active() || session.UserID != token.Info.UserID {
+		return user, cred, ErrSessionRevoked
+	}
+	if r := m.db.WithContext(ctx).Preload("Roles.Permissions").First(
 		&user,
 		token.Info.UserID,
 	); r.Error != nil {
-		return user, r.Error
+		return user, cred, r.Error
 	}
-	return user, nil
+	// Writing on every request is wasteful so activity is only recorded
+	// once per minute.
+	if time.Since(session.LastSeenAt) > time.Minute {
+		err = m.stores.Sessions.Touch(ctx, session.ID, c.ClientIP())
+		if err != nil {
+			return user, cred, err
+		}
+	}
+	cred = Credential{
+		SessionID:   session.ID,
+		ClientID:    session.ClientID,
+		Transport:   transport,
+		Scopes:      token.Info.Scopes,
+		Permissions: user.PermissionNames(),
+	}
+	if session.AuthenticatedAt != nil {
+		cred.AuthenticatedAt = *session.AuthenticatedAt
+	}
+	return user, cred, nil
+}
+
+// ListSessions returns the active sessions of user.
+func (m UserAuthManager) ListSessions(
+	user model.User,
+	c *gin.Context,
+) ([]model.Session, error) {
+	sessions, err := m.stores.Sessions.ListUser(
+		c.Request.Context(),
+		user.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes the session of user with identifier id. If no such
+// session exists ErrSessionNotFound is returned.
+func (m UserAuthManager) RevokeSession(
+	user model.User,
+	id string,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to revoke session: %w", err)
+		}
+	}()
+
+	ctx := c.Request.Context()
+	session, err := m.stores.Sessions.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session.UserID != user.ID {
+		return ErrSessionNotFound
+	}
+	return m.stores.Sessions.Revoke(ctx, id)
 }
 
-// RemoveSession sets an empty user session cookie.
-func (m UserAuthManager) RemoveSession(c *gin.Context) {
-	c.SetCookie("user_session", "", -1, "/", "", m.secure, true)
+// RemoveSession revokes the session of cred and, if it was sent as a cookie,
+// sets empty session and refresh cookies in its place.
+func (m UserAuthManager) RemoveSession(cred Credential, c *gin.Context) error {
+	if cred.Transport == CookieTransport {
+		m.cookies.clear(c, m.cookies.session)
+		m.cookies.clear(c, m.cookies.refresh)
+	}
+	if err := m.stores.Sessions.Revoke(
+		c.Request.Context(),
+		cred.SessionID,
+	); err != nil {
+		return fmt.Errorf("failed to remove session: %w", err)
+	}
+	return nil
 }
 
-// RequestPasswordReset generates a password reset token and calls m.msm.Send
-// with it.
+// RevokeUserSessions revokes every session of user, effectively logging it
+// out of every device.
+func (m UserAuthManager) RevokeUserSessions(
+	user model.User,
+	c *gin.Context,
+) error {
+	if err := m.stores.Sessions.RevokeUser(
+		c.Request.Context(),
+		user.ID,
+	); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// RequestPasswordReset sends a password reset token to the user whose email
+// address is in form. Unknown addresses are not reported as errors, their
+// owner is told that no account uses them instead. Messages are sent in the
+// background so that answering takes as long either way, and requests are
+// throttled per email and client address. If users are hidden the owner of a
+// user managed by a directory is notified instead of ErrManagedUser being
+// returned.
 func (m UserAuthManager) RequestPasswordReset(
 	form schema.PasswordResetRequestForm,
 	c *gin.Context,
@@ -172,29 +632,63 @@ func (m UserAuthManager) RequestPasswordReset(
 		}
 	}()
 
+	if err = m.throttleMail(form.Email, c); err != nil {
+		return err
+	}
 	var user model.User
-	if r := m.db.WithContext(c.Request.Context()).First(
+	r := m.db.WithContext(c.Request.Context()).First(
 		&user,
 		"email = ?",
 		form.Email,
-	); r.Error != nil {
+	)
+	switch {
+	case errors.Is(r.Error, gorm.ErrRecordNotFound):
+		m.sendNotice(
+			form.Email,
+			"Password reset request",
+			"A password reset was requested for this address but no account "+
+				"uses it.",
+			c,
+		)
+		return nil
+	case r.Error != nil:
 		return r.Error
+	case user.Managed() && m.hideUsers:
+		m.sendNotice(
+			form.Email,
+			"Password reset request",
+			"A password reset was requested for this address but its "+
+				"account's password is managed by a directory.",
+			c,
+		)
+		return nil
+	case user.Managed():
+		return ErrManagedUser
 	}
-	token := m.signedToken(user.ID, resetToken, time.Now(), 10*time.Minute)
-	tokenB, err := json.Marshal(token)
-	if err != nil {
-		return err
-	}
-	return m.msm.Send(
-		c.Request.Context(),
-		form.Email,
-		"Password reset code",
-		base64.URLEncoding.EncodeToString(tokenB),
-	)
+	inBackground(c, func(c *gin.Context) error {
+		info := newTokenInfo(user.ID, resetToken, m.resetTTL)
+		token, err := m.oneTimeToken(info, c)
+		if err != nil {
+			return fmt.Errorf("failed to send password reset: %w", err)
+		}
+		err = m.msm.Send(
+			c.Request.Context(),
+			user.Email,
+			"Password reset code",
+			token,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to send password reset: %w", err)
+		}
+		return nil
+	})
+	return nil
 }
 
-// ResetPassword validates a password reset token and if it is valid changes
+// ResetPassword consumes a password reset token and if it is valid changes
 // the corresponding user's password according to the information in form.
+// Every other reset token of the user is invalidated and all of its sessions
+// are revoked.
 func (m UserAuthManager) ResetPassword(
 	form schema.PasswordResetForm,
 	c *gin.Context,
@@ -205,33 +699,45 @@ func (m UserAuthManager) ResetPassword(
 		}
 	}()
 
-	token, err := m.parseToken(form.Token)
+	token, err := m.consumeToken(form.Token, resetToken, c)
 	if err != nil {
 		return err
 	}
 	var user model.User
-	if r := m.db.WithContext(c.Request.Context()).First(
+	ctx := c.Request.Context()
+	if r := m.db.WithContext(ctx).First(
 		&user,
 		token.Info.UserID,
 	); r.Error != nil {
 		return r.Error
 	}
-	if user.UpdatedAt.After(token.Info.IssuedAt) {
-		return ErrTokenExpired
+	if user.Managed() {
+		return ErrManagedUser
 	}
 	if err = user.SetPassword(form.Password); err != nil {
 		return err
 	}
-	if r := m.db.WithContext(c.Request.Context()).Model(&user).Update(
-		"password",
-		user.Password,
+	if r := m.db.WithContext(ctx).Model(&user).Updates(
+		map[string]any{
+			"password_hash": user.PasswordHash,
+			"salt":          nil,
+			"password":      nil,
+		},
 	); r.Error != nil {
 		return r.Error
 	}
-	return nil
+	if err = m.revokeResetTokens(user, c); err != nil {
+		return err
+	}
+	// Whoever asked for the reset may have lost control of the account so
+	// every device is logged out.
+	return m.stores.Sessions.RevokeUser(ctx, user.ID)
 }
 
-// SetPassword changes the user's password to match the one in form.
+// SetPassword changes the user's password to match the one in form, provided
+// that its current password is also in form, and invalidates its outstanding
+// password reset tokens. Failures count against the same limits as those of
+// Authenticate.
 func (m UserAuthManager) SetPassword(
 	user model.User,
 	form schema.PasswordChangeForm,
@@ -243,6 +749,12 @@ func (m UserAuthManager) SetPassword(
 		}
 	}()
 
+	if user.Managed() {
+		return ErrManagedUser
+	}
+	if err = m.checkPassword(user, form.CurrentPassword, c); err != nil {
+		return err
+	}
 	if err = user.SetPassword(form.Password); err != nil {
 		return err
 	}
@@ -251,73 +763,159 @@ func (m UserAuthManager) SetPassword(
 	); r.Error != nil {
 		return r.Error
 	}
-	return nil
+	return m.revokeResetTokens(user, c)
+}
+
+// revokeResetTokens invalidates the outstanding password reset tokens of
+// user.
+func (m UserAuthManager) revokeResetTokens(
+	user model.User,
+	c *gin.Context,
+) error {
+	return m.stores.Tokens.RevokeUser(
+		c.Request.Context(),
+		user.ID,
+		tokenTypeNames[resetToken],
+	)
 }
 
-// parseToken returns the token encoded in s provided that s is a valid
-// encoding.
-func (m UserAuthManager) parseToken(s string) (authToken, error) {
-	var token authToken
+// parseToken returns the token of type t encoded in s provided that s is a
+// valid encoding of a token that has not expired and was issued by m for
+// itself. Tokens of any other type fail with ErrWrongTokenType, so that
+// tokens can not be used for a purpose other than their own. Tokens naming
+// no issuer nor audience are accepted within the legacy grace period.
+func (m UserAuthManager) parseToken(s string, t tokenType) (authToken, error) {
 	s, err := url.QueryUnescape(s)
 	if err != nil {
-		return token, ErrInvalidToken
+		return authToken{}, ErrInvalidToken
 	}
-	decToken, err := base64.URLEncoding.DecodeString(s)
+	token, err := m.codec.decode(s)
 	if err != nil {
+		return token, err
+	}
+	if time.Now().After(token.Info.ExpiresAt) {
 		return token, ErrInvalidToken
 	}
-	if err = json.Unmarshal(decToken, &token); err != nil {
-		return token, fmt.Errorf("could not parse token: %w", err)
+	if !m.legacyToken(token.Info) {
+		if token.Info.Issuer != m.issuer {
+			return token, ErrWrongIssuer
+		}
+		if !slices.Contains(token.Info.Audience, m.audience) {
+			return token, ErrWrongAudience
+		}
 	}
-	if !m.validToken(token) {
-		return token, ErrInvalidToken
+	if token.Info.Type != t {
+		return token, ErrWrongTokenType
 	}
 	return token, nil
 }
 
-// validToken returns true if and only if its verification code is a valid
-// signature of its information.
-func (m UserAuthManager) validToken(token authToken) bool {
-	verToken := m.signedToken(
-		token.Info.UserID,
-		token.Info.Type,
-		token.Info.IssuedAt,
-		token.Info.ExpiresAt.Sub(token.Info.IssuedAt),
-	)
-	code, err := base64.StdEncoding.DecodeString(token.VerificationCode)
+// legacyToken returns true if and only if info names no issuer nor audience,
+// as the tokens issued before both were added, and was issued within the
+// legacy grace period.
+func (m UserAuthManager) legacyToken(info authTokenInfo) bool {
+	return info.Issuer == "" && len(info.Audience) == 0 &&
+		time.Since(info.IssuedAt) < m.legacyTTL
+}
+
+// encodedToken returns the url safe encoding of a token signed with the
+// provided information, issued by m for itself.
+func (m UserAuthManager) encodedToken(info authTokenInfo) (string, error) {
+	info.Issuer = m.issuer
+	info.Audience = []string{m.audience}
+	return m.codec.encode(info)
+}
+
+// oneTimeToken records a single use token with the provided information, to
+// be consumed through consumeToken, and returns its encoding.
+func (m UserAuthManager) oneTimeToken(
+	info authTokenInfo,
+	c *gin.Context,
+) (string, error) {
+	nonce, err := randomString(32)
 	if err != nil {
-		return false // This could be a bad token being given so not a problem.
+		return "", err
 	}
-	verCode, err := base64.StdEncoding.DecodeString(verToken.VerificationCode)
+	info.Nonce = nonce
+	if err = m.stores.Tokens.Create(c.Request.Context(), model.OneTimeToken{
+		ID:        nonce,
+		UserID:    info.UserID,
+		Purpose:   tokenTypeNames[info.Type],
+		ExpiresAt: info.ExpiresAt,
+	}); err != nil {
+		return "", err
+	}
+	return m.encodedToken(info)
+}
+
+// statelessToken returns the encoding of a single use token with the provided
+// information. Unlike those of oneTimeToken it is only recorded once consumed
+// through consumeStatelessToken, so that issuing it to anonymous clients
+// takes no storage.
+func (m UserAuthManager) statelessToken(info authTokenInfo) (string, error) {
+	nonce, err := randomString(32)
 	if err != nil {
-		panic(err) // We generated this code so it is our problem.
+		return "", err
 	}
-	if !hmac.Equal(code, verCode) {
-		return false
+	info.Nonce = nonce
+	return m.encodedToken(info)
+}
+
+// consumeStatelessToken records the token issued by statelessToken as used
+// until it expires. If it was already used ErrTokenReused is returned.
+func (m UserAuthManager) consumeStatelessToken(
+	token authToken,
+	c *gin.Context,
+) error {
+	if token.Info.Nonce == "" {
+		return ErrInvalidToken
 	}
-	if time.Now().After(token.Info.ExpiresAt) {
-		return false
+	now := time.Now()
+	err := m.stores.Tokens.Create(c.Request.Context(), model.OneTimeToken{
+		ID:        token.Info.Nonce,
+		UserID:    token.Info.UserID,
+		Purpose:   tokenTypeNames[token.Info.Type],
+		ExpiresAt: token.Info.ExpiresAt,
+		UsedAt:    &now,
+	})
+	if errors.Is(err, ErrDuplicateToken) {
+		return ErrTokenReused
 	}
-	return true
+	return err
 }
 
-// signedToken returns a valid authentication token with the provided
-// information.
-func (m UserAuthManager) signedToken(
-	id uint,
+// consumeToken returns the single use token of type t encoded in s provided
+// that it is valid and has not been used before, marking it as used.
+func (m UserAuthManager) consumeToken(
+	s string,
 	t tokenType,
-	issued time.Time,
-	duration time.Duration,
-) authToken {
-	tokenInfo := authTokenInfo{id, t, issued, issued.Add(duration)}
-	info, err := json.Marshal(&tokenInfo)
+	c *gin.Context,
+) (authToken, error) {
+	token, _, err := m.consumeTokenRecord(s, t, c)
+	return token, err
+}
+
+// consumeTokenRecord is like consumeToken but also returns the stored record
+// of the token, which is returned along with ErrTokenReused as well.
+func (m UserAuthManager) consumeTokenRecord(
+	s string,
+	t tokenType,
+	c *gin.Context,
+) (authToken, model.OneTimeToken, error) {
+	token, err := m.parseToken(s, t)
+	if err != nil {
+		return token, model.OneTimeToken{}, err
+	}
+	record, err := m.stores.Tokens.Consume(
+		c.Request.Context(),
+		token.Info.Nonce,
+	)
 	if err != nil {
-		panic(err)
+		return token, record, err
 	}
-	hmac := hmac.New(sha256.New, m.secret)
-	hmac.Write(info)
-	return authToken{
-		tokenInfo,
-		base64.StdEncoding.EncodeToString(hmac.Sum(nil)),
+	if record.UserID != token.Info.UserID ||
+		record.Purpose != tokenTypeNames[t] {
+		return token, record, ErrInvalidToken
 	}
+	return token, record, nil
 }
@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"errors"
+	"gin-gorm-api/config"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "gin-gorm-api"
+	testAudience = "gin-gorm-api"
+)
+
+// testKeyring returns a keyring holding a single key under legacyKeyID.
+func testKeyring(t *testing.T) keyring {
+	t.Helper()
+	keys, err := newKeyring(testSecret, nil, legacyKeyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// testCodecs returns every tokenCodec by the name of its format.
+func testCodecs(t *testing.T) map[string]tokenCodec {
+	t.Helper()
+	keys := testKeyring(t)
+	jwtCodec, err := newJWTCodec(
+		config.AuthConfig{JWTAlgorithm: HS256},
+		keys,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]tokenCodec{
+		NativeTokenFormat: nativeCodec{keys: keys},
+		JWTTokenFormat:    jwtCodec,
+	}
+}
+
+// testManager returns a UserAuthManager that only encodes and parses tokens
+// with codec.
+func testManager(codec tokenCodec) UserAuthManager {
+	return UserAuthManager{
+		codec:    codec,
+		issuer:   testIssuer,
+		audience: testAudience,
+	}
+}
+
+func TestParseTokenType(t *testing.T) {
+	for format, codec := range testCodecs(t) {
+		m := testManager(codec)
+		for issued := range tokenTypeNames {
+			token, err := m.encodedToken(newTokenInfo(1, issued, time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for expected := range tokenTypeNames {
+				name := format + "/" + tokenTypeNames[issued] + "/" +
+					tokenTypeNames[expected]
+				t.Run(name, func(t *testing.T) {
+					parsed, err := m.parseToken(token, expected)
+					if issued == expected {
+						if err != nil {
+							t.Fatalf("got %v, want no error", err)
+						}
+						if parsed.Info.Type != issued {
+							t.Fatalf("got type %d, want %d", parsed.Info.Type, issued)
+						}
+						return
+					}
+					if !errors.Is(err, ErrWrongTokenType) {
+						t.Fatalf("got %v, want %v", err, ErrWrongTokenType)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestParseTokenBinding(t *testing.T) {
+	tests := []struct {
+		name     string
+		issuer   string
+		audience []string
+		grace    time.Duration
+		age      time.Duration
+		err      error
+	}{
+		{
+			name:     "valid",
+			issuer:   testIssuer,
+			audience: []string{testAudience},
+		},
+		{
+			name:     "one of several audiences",
+			issuer:   testIssuer,
+			audience: []string{"other", testAudience},
+		},
+		{
+			name:     "wrong issuer",
+			issuer:   "other",
+			audience: []string{testAudience},
+			err:      ErrWrongIssuer,
+		},
+		{
+			name:     "wrong audience",
+			issuer:   testIssuer,
+			audience: []string{"other"},
+			err:      ErrWrongAudience,
+		},
+		{
+			name:     "no audience",
+			issuer:   testIssuer,
+			audience: nil,
+			err:      ErrWrongAudience,
+		},
+		{
+			name: "legacy without grace",
+			err:  ErrWrongIssuer,
+		},
+		{
+			name:  "legacy within grace",
+			grace: time.Hour,
+			age:   time.Minute,
+		},
+		{
+			name:  "legacy after grace",
+			grace: time.Hour,
+			age:   2 * time.Hour,
+			err:   ErrWrongIssuer,
+		},
+		{
+			name:     "wrong issuer within grace",
+			issuer:   "other",
+			audience: nil,
+			grace:    time.Hour,
+			err:      ErrWrongIssuer,
+		},
+		{
+			name:     "wrong audience within grace",
+			audience: []string{"other"},
+			grace:    time.Hour,
+			err:      ErrWrongIssuer,
+		},
+	}
+	for format, codec := range testCodecs(t) {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				m := testManager(codec)
+				m.legacyTTL = tt.grace
+				info := newTokenInfo(1, sessionToken, 3*time.Hour)
+				info.IssuedAt = info.IssuedAt.Add(-tt.age)
+				info.Issuer = tt.issuer
+				info.Audience = tt.audience
+				// Encoded directly so that the issuer and audience are
+				// kept as is.
+				token, err := codec.encode(info)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = m.parseToken(token, sessionToken)
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, want %v", err, tt.err)
+				}
+			})
+		}
+	}
+}
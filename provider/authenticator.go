@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// An Authenticator checks the password of a login. UserAuthManager tries its
+// authenticators in order and takes care of throttling, so they only check
+// credentials.
+type Authenticator interface {
+	// Authenticate returns the user with the given username provided that
+	// password is its password. If the user is unknown to the authenticator
+	// or the password is wrong ErrInvalidCredentials is returned.
+	Authenticate(c *gin.Context, username, password string) (model.User, error)
+}
+
+// LocalAuthenticator is an Authenticator checking the passwords stored by
+// model.User. Users managed by a directory are unknown to it.
+type LocalAuthenticator struct {
+	db *gorm.DB
+}
+
+// NewLocalAuthenticator returns a LocalAuthenticator that finds users in db.
+func NewLocalAuthenticator(db *gorm.DB) LocalAuthenticator {
+	return LocalAuthenticator{db}
+}
+
+// Authenticate implements Authenticator. If the user's password was hashed
+// with an outdated hasher or parameters it is hashed again with the current
+// ones.
+func (a LocalAuthenticator) Authenticate(
+	c *gin.Context,
+	username string,
+	password string,
+) (user model.User, err error) {
+	r := a.db.WithContext(c.Request.Context()).First(
+		&user,
+		"username = ?",
+		username,
+	)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) || user.Managed() {
+		model.SimulatePasswordCheck(password)
+		return model.User{}, ErrInvalidCredentials
+	}
+	if r.Error != nil {
+		return model.User{}, r.Error
+	}
+	if !user.CheckPassword(password) {
+		return model.User{}, ErrInvalidCredentials
+	}
+	if user.PasswordNeedsRehash() {
+		if err := a.rehashPassword(&user, password, c); err != nil {
+			// The login is still valid so the error is only recorded.
+			_ = c.Error(err)
+		}
+	}
+	return user, nil
+}
+
+// rehashPassword hashes pw again with the default hasher and stores it as
+// user's password. The update does not count as a change of user.
+func (a LocalAuthenticator) rehashPassword(
+	user *model.User,
+	pw string,
+	c *gin.Context,
+) error {
+	if err := user.SetPassword(pw); err != nil {
+		return fmt.Errorf("failed to rehash password: %w", err)
+	}
+	if r := a.db.WithContext(c.Request.Context()).Model(user).UpdateColumns(
+		map[string]any{
+			"password_hash": user.PasswordHash,
+			"salt":          nil,
+			"password":      nil,
+		},
+	); r.Error != nil {
+		return fmt.Errorf("failed to rehash password: %w", r.Error)
+	}
+	return nil
+}
+
+// newAuthenticators returns the authenticators named in conf.
+func newAuthenticators(
+	db *gorm.DB,
+	conf config.AuthConfig,
+) ([]Authenticator, error) {
+	authenticators := make([]Authenticator, len(conf.Authenticators))
+	for i, name := range conf.Authenticators {
+		switch strings.TrimSpace(name) {
+		case "local":
+			authenticators[i] = NewLocalAuthenticator(db)
+		case "ldap":
+			ldap, err := NewLDAPAuthenticator(db, conf.LDAP)
+			if err != nil {
+				return nil, err
+			}
+			authenticators[i] = ldap
+		default:
+			return nil, fmt.Errorf("%w '%s'", ErrInvalidAuthenticator, name)
+		}
+	}
+	return authenticators, nil
+}
+
+// authenticate returns the user with the given username and password as
+// vouched for by the first of m's authenticators that knows it.
+func (m UserAuthManager) authenticate(
+	c *gin.Context,
+	username string,
+	password string,
+) (model.User, error) {
+	for _, authenticator := range m.authn {
+		user, err := authenticator.Authenticate(c, username, password)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			return user, err
+		}
+	}
+	return model.User{}, ErrInvalidCredentials
+}
@@ -0,0 +1,224 @@
+package provider
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"gin-gorm-api/config"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// hostPrefix marks cookies that browsers only accept if they are secure,
+	// have path "/" and no domain.
+	hostPrefix = "__Host-"
+	// flowCookie holds the state of an OpenID Connect login while the user is
+	// away at the identity provider.
+	flowCookie = "oidc_flow"
+)
+
+// cookieKeyInfo separates the keys derived for cookie encryption from any
+// other use of the signing keys.
+var cookieKeyInfo = []byte("gin-gorm-api session cookie encryption")
+
+// A cookieJar sets and reads the session cookies with the attributes given by
+// config.CookieConfig. If encryption is enabled their values are sealed with
+// AES-256-GCM under keys derived from those of the keyring, so they rotate
+// along with them.
+type cookieJar struct {
+	session  string
+	refresh  string
+	flow     string
+	domain   string
+	path     string
+	sameSite http.SameSite
+	secure   bool
+	maxAge   time.Duration
+	active   string
+	aeads    map[string]cipher.AEAD
+}
+
+// newCookieJar returns the cookieJar described by conf. Cookies are secure
+// unless conf.Debug is set.
+func newCookieJar(
+	conf config.Config,
+	keys keyring,
+) (jar cookieJar, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to configure cookies: %w", err)
+		}
+	}()
+
+	cc := conf.Auth.Cookie
+	jar = cookieJar{
+		session: cc.SessionName,
+		refresh: cc.RefreshName,
+		flow:    flowCookie,
+		domain:  cc.Domain,
+		path:    cc.Path,
+		secure:  !conf.Debug,
+		maxAge:  cc.MaxAge,
+	}
+	switch strings.ToLower(cc.SameSite) {
+	case "lax":
+		jar.sameSite = http.SameSiteLaxMode
+	case "strict":
+		jar.sameSite = http.SameSiteStrictMode
+	case "none":
+		// Browsers drop cross site cookies that are not secure.
+		if !jar.secure {
+			return jar, fmt.Errorf(
+				"%w: same site none requires secure cookies",
+				ErrInvalidCookie,
+			)
+		}
+		jar.sameSite = http.SameSiteNoneMode
+	default:
+		return jar, fmt.Errorf("%w '%s'", ErrInvalidSameSite, cc.SameSite)
+	}
+	if cc.HostPrefix {
+		if !jar.secure || jar.path != "/" || jar.domain != "" {
+			return jar, fmt.Errorf(
+				"%w: %s prefix requires secure cookies with path / and no "+
+					"domain",
+				ErrInvalidCookie,
+				hostPrefix,
+			)
+		}
+		jar.session = hostPrefix + jar.session
+		jar.refresh = hostPrefix + jar.refresh
+		jar.flow = hostPrefix + jar.flow
+	}
+	if !cc.Encrypt {
+		return jar, nil
+	}
+	jar.active, _ = keys.signingKey()
+	jar.aeads = make(map[string]cipher.AEAD, len(keys.keys))
+	for id, key := range keys.keys {
+		if jar.aeads[id], err = newCookieAEAD(key); err != nil {
+			return jar, err
+		}
+	}
+	return jar, nil
+}
+
+// newCookieAEAD returns the AEAD that seals cookies under the key derived
+// from signing key.
+func newCookieAEAD(key []byte) (cipher.AEAD, error) {
+	derived := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, key, nil, cookieKeyInfo)
+	if _, err := io.ReadFull(kdf, derived); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// set sets the cookie name to value for as long as a token valid for ttl,
+// unless the jar overrides it.
+func (j cookieJar) set(
+	c *gin.Context,
+	name, value string,
+	ttl time.Duration,
+) error {
+	value, err := j.seal(name, value)
+	if err != nil {
+		return fmt.Errorf("failed to set cookie: %w", err)
+	}
+	maxAge := ttl
+	if j.maxAge != 0 {
+		maxAge = j.maxAge
+	}
+	cookie := j.cookie(name, value)
+	// A zero MaxAge omits the attribute, making it a session cookie.
+	cookie.MaxAge = max(int(maxAge.Seconds()), 0)
+	// Browsers return from identity providers through a cross site
+	// redirect, which strict cookies are not sent with.
+	if name == j.flow && cookie.SameSite == http.SameSiteStrictMode {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	http.SetCookie(c.Writer, cookie)
+	return nil
+}
+
+// clear removes the cookie name from the client.
+func (j cookieJar) clear(c *gin.Context, name string) {
+	cookie := j.cookie(name, "")
+	cookie.MaxAge = -1
+	http.SetCookie(c.Writer, cookie)
+}
+
+// get returns the value of the cookie name sent with the request in c.
+func (j cookieJar) get(c *gin.Context, name string) (string, error) {
+	value, err := c.Cookie(name)
+	if err != nil {
+		return "", ErrMissingCredentials
+	}
+	return j.open(name, value)
+}
+
+// cookie returns a cookie named name holding value with the attributes of j.
+func (j cookieJar) cookie(name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     j.path,
+		Domain:   j.domain,
+		Secure:   j.secure,
+		HttpOnly: true,
+		SameSite: j.sameSite,
+	}
+}
+
+// seal encrypts the value of the cookie name if encryption is enabled. The
+// name is authenticated too so values can not be swapped between cookies.
+func (j cookieJar) seal(name, value string) (string, error) {
+	if j.aeads == nil {
+		return value, nil
+	}
+	aead := j.aeads[j.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return j.active + "." + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts the value of the cookie name if encryption is enabled.
+func (j cookieJar) open(name, value string) (string, error) {
+	if j.aeads == nil {
+		return value, nil
+	}
+	id, enc, ok := cutLast(value, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	aead, ok := j.aeads[id]
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidToken
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, []byte(name))
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE identifiers of the signature algorithms accepted from passkeys, as
+// registered by IANA.
+const (
+	coseES256 = -7
+	coseEdDSA = -8
+	coseRS256 = -257
+)
+
+// coseAlgorithms are the signature algorithms accepted from passkeys in order
+// of preference.
+var coseAlgorithms = []int{coseES256, coseEdDSA, coseRS256}
+
+// cborDecoder decodes the CBOR structures of WebAuthn, which must not repeat
+// map keys.
+var cborDecoder = func() cbor.DecMode {
+	decoder, err := cbor.DecOptions{
+		DupMapKey: cbor.DupMapKeyEnforcedAPF,
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return decoder
+}()
+
+// parseCOSEKey returns the public key encoded as the COSE_Key b, as described
+// by RFC 9053, along with the COSE identifier of its signature algorithm.
+func parseCOSEKey(b []byte) (key any, alg int, err error) {
+	var params map[int]cbor.RawMessage
+	if err = cborDecoder.Unmarshal(b, &params); err != nil {
+		return nil, 0, err
+	}
+	var kty int
+	if err = coseParam(params, 1, &kty); err != nil {
+		return nil, 0, err
+	}
+	if err = coseParam(params, 3, &alg); err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case kty == 2 && alg == coseES256:
+		key, err = parseCOSEEC2Key(params)
+	case kty == 1 && alg == coseEdDSA:
+		key, err = parseCOSEOKPKey(params)
+	case kty == 3 && alg == coseRS256:
+		key, err = parseCOSERSAKey(params)
+	default:
+		err = ErrInvalidAlgorithm
+	}
+	return key, alg, err
+}
+
+// coseParam decodes the parameter of a COSE_Key with the given label into v.
+func coseParam(params map[int]cbor.RawMessage, label int, v any) error {
+	raw, ok := params[label]
+	if !ok {
+		return fmt.Errorf("missing cose key parameter %d", label)
+	}
+	return cborDecoder.Unmarshal(raw, v)
+}
+
+// parseCOSEEC2Key returns the P-256 key described by params.
+func parseCOSEEC2Key(
+	params map[int]cbor.RawMessage,
+) (*ecdsa.PublicKey, error) {
+	var crv int
+	var x, y []byte
+	if err := coseParam(params, -1, &crv); err != nil {
+		return nil, err
+	}
+	if err := coseParam(params, -2, &x); err != nil {
+		return nil, err
+	}
+	if err := coseParam(params, -3, &y); err != nil {
+		return nil, err
+	}
+	if crv != 1 || len(x) != 32 || len(y) != 32 {
+		return nil, ErrInvalidAlgorithm
+	}
+	// Uncompressed point: 0x04 || X || Y.
+	point := append(append([]byte{4}, x...), y...)
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, err // Not on the curve.
+	}
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// parseCOSEOKPKey returns the Ed25519 key described by params.
+func parseCOSEOKPKey(
+	params map[int]cbor.RawMessage,
+) (ed25519.PublicKey, error) {
+	var crv int
+	var x []byte
+	if err := coseParam(params, -1, &crv); err != nil {
+		return nil, err
+	}
+	if err := coseParam(params, -2, &x); err != nil {
+		return nil, err
+	}
+	if crv != 6 || len(x) != ed25519.PublicKeySize {
+		return nil, ErrInvalidAlgorithm
+	}
+	return ed25519.PublicKey(x), nil
+}
+
+// parseCOSERSAKey returns the RSA key described by params, which must be at
+// least 2048 bits long.
+func parseCOSERSAKey(params map[int]cbor.RawMessage) (*rsa.PublicKey, error) {
+	var n, e []byte
+	if err := coseParam(params, -1, &n); err != nil {
+		return nil, err
+	}
+	if err := coseParam(params, -2, &e); err != nil {
+		return nil, err
+	}
+	mod := new(big.Int).SetBytes(n)
+	exp := new(big.Int).SetBytes(e)
+	if mod.BitLen() < 2048 || !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+		return nil, ErrInvalidAlgorithm
+	}
+	return &rsa.PublicKey{N: mod, E: int(exp.Int64())}, nil
+}
+
+// verifySignature returns true if and only if sig is a signature of data by
+// key with the algorithm with COSE identifier alg.
+func verifySignature(key any, alg int, data, sig []byte) bool {
+	digest := sha256.Sum256(data)
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		return alg == coseES256 && key.Curve == elliptic.P256() &&
+			ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return alg == coseEdDSA && ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		return alg == coseRS256 &&
+			rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"slices"
+	"time"
+)
+
+// A Credential describes how the user of a request was authenticated.
+type Credential struct {
+	// SessionID identifies the session the request belongs to.
+	SessionID string
+	// APIKeyID identifies the API key used by the request, if any.
+	APIKeyID uint
+	// ClientID identifies the OAuth client the session was granted to, if
+	// any.
+	ClientID string
+	// Transport used by the client to send the credential.
+	Transport Transport
+	// Scopes granted to the credential.
+	Scopes []string
+	// Permissions granted to the user by its roles.
+	Permissions []string
+	// AuthenticatedAt is the last time the user proved its identity on the
+	// session. It is zero for API keys and sessions that never did.
+	AuthenticatedAt time.Time
+}
+
+// MissingScopes returns the scopes in scopes not granted to c.
+func (c Credential) MissingScopes(scopes ...string) []string {
+	var missing []string
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// MissingPermissions returns the permissions in perms not granted to c.
+func (c Credential) MissingPermissions(perms ...string) []string {
+	var missing []string
+	for _, perm := range perms {
+		if !slices.Contains(c.Permissions, perm) {
+			missing = append(missing, perm)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CSRFHeader is the header that carries CSRF tokens, both in the responses
+// that set session cookies and in the requests that must present them.
+const CSRFHeader = "X-CSRF-Token"
+
+// CSRFToken returns the CSRF token of the session with identifier sessionID.
+// It is the HMAC-SHA256 of the identifier under the active signing key, so it
+// can not be forged without the key and needs no storage.
+func (m UserAuthManager) CSRFToken(sessionID string) string {
+	id, key := m.keys.signingKey()
+	return id + "." + csrfMAC(key, sessionID)
+}
+
+// CheckCSRF returns ErrInvalidCSRFToken if the request in c may change state,
+// was authenticated by a session cookie as described by cred and does not
+// carry the session's CSRF token in the CSRFHeader. Credentials sent in
+// headers can not be forged by other sites so they are never checked.
+func (m UserAuthManager) CheckCSRF(cred Credential, c *gin.Context) error {
+	if cred.Transport != CookieTransport {
+		return nil
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	id, mac, ok := cutLast(c.GetHeader(CSRFHeader), ".")
+	if !ok {
+		return ErrInvalidCSRFToken
+	}
+	key, ok := m.keys.key(id)
+	if !ok {
+		return ErrInvalidCSRFToken
+	}
+	if !hmac.Equal([]byte(mac), []byte(csrfMAC(key, cred.SessionID))) {
+		return ErrInvalidCSRFToken
+	}
+	return nil
+}
+
+// csrfMAC returns the encoded MAC of the CSRF token of sessionID under key.
+func csrfMAC(key []byte, sessionID string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("csrf:" + sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
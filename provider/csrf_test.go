@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"errors"
+	"gin-gorm-api/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	m, db, _ := newTestManager(t, nil)
+	user := model.User{Username: "alice", Email: "alice@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	login := func() *httptest.ResponseRecorder {
+		c, w := newTestContext(http.MethodPost, "/auth", nil, nil)
+		if err := m.RegisterSession(user, c); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	session, other := login(), login()
+	c, _ := newTestContext(http.MethodPost, "/auth/token", nil, nil)
+	tokens, err := m.RegisterBearerSession(user, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrfToken := session.Header().Get(CSRFHeader)
+	if csrfToken == "" {
+		t.Fatal("no csrf token sent along with the session cookies")
+	}
+	tests := []struct {
+		name   string
+		method string
+		bearer bool
+		csrf   string
+		err    error
+	}{
+		{
+			name:   "cookie without token",
+			method: http.MethodPost,
+			err:    ErrInvalidCSRFToken,
+		},
+		{
+			name:   "cookie delete without token",
+			method: http.MethodDelete,
+			err:    ErrInvalidCSRFToken,
+		},
+		{
+			name:   "cookie patch without token",
+			method: http.MethodPatch,
+			err:    ErrInvalidCSRFToken,
+		},
+		{
+			name:   "cookie with token",
+			method: http.MethodPost,
+			csrf:   csrfToken,
+		},
+		{
+			name:   "cookie with token of another session",
+			method: http.MethodPost,
+			csrf:   other.Header().Get(CSRFHeader),
+			err:    ErrInvalidCSRFToken,
+		},
+		{
+			name:   "cookie with malformed token",
+			method: http.MethodPost,
+			csrf:   "token",
+			err:    ErrInvalidCSRFToken,
+		},
+		{
+			name:   "cookie with token of unknown key",
+			method: http.MethodPost,
+			csrf:   "unknown." + csrfToken,
+			err:    ErrInvalidCSRFToken,
+		},
+		{
+			name:   "cookie safe method",
+			method: http.MethodGet,
+		},
+		{
+			name:   "bearer without token",
+			method: http.MethodPost,
+			bearer: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext(tt.method, "/auth/me", nil, session)
+			if tt.bearer {
+				c.Request.Header.Del("Cookie")
+				c.Request.Header.Set("Authorization", "Bearer "+tokens.Access)
+			}
+			if tt.csrf != "" {
+				c.Request.Header.Set(CSRFHeader, tt.csrf)
+			}
+			_, cred, err := m.RetrieveSession(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = m.CheckCSRF(cred, c)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SendEmailVerification generates an email verification token for the
+// current email address of user and calls m.msm.Send with it.
+func (m UserAuthManager) SendEmailVerification(
+	user model.User,
+	c *gin.Context,
+) error {
+	info := newTokenInfo(user.ID, verifyEmailToken, m.verifyTTL)
+	info.Email = user.Email
+	token, err := m.encodedToken(info)
+	if err != nil {
+		return fmt.Errorf("failed to send email verification: %w", err)
+	}
+	if err = m.msm.Send(
+		c.Request.Context(),
+		user.Email,
+		"Email verification code",
+		token,
+	); err != nil {
+		return fmt.Errorf("failed to send email verification: %w", err)
+	}
+	return nil
+}
+
+// ResendEmailVerification sends a new email verification token to the user
+// whose email address is in form. If it is already verified ErrEmailVerified
+// is returned. If users are hidden neither case is reported as an error and
+// the token is sent in the background so that answering takes as long either
+// way. Requests are throttled per email and client address.
+func (m UserAuthManager) ResendEmailVerification(
+	form schema.EmailVerificationRequestForm,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to resend email verification: %w", err)
+		}
+	}()
+
+	if err = m.throttleMail(form.Email, c); err != nil {
+		return err
+	}
+	var user model.User
+	r := m.db.WithContext(c.Request.Context()).First(
+		&user,
+		"email = ?",
+		form.Email,
+	)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) && m.hideUsers {
+		return nil
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+	if user.EmailVerified() {
+		if m.hideUsers {
+			return nil
+		}
+		return ErrEmailVerified
+	}
+	if m.hideUsers {
+		inBackground(c, func(c *gin.Context) error {
+			return m.SendEmailVerification(user, c)
+		})
+		return nil
+	}
+	return m.SendEmailVerification(user, c)
+}
+
+// VerifyEmail validates the email verification token in form and if it is
+// valid marks the email address of the corresponding user as verified. Tokens
+// issued for an address the user no longer has are rejected.
+func (m UserAuthManager) VerifyEmail(
+	form schema.EmailVerificationForm,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to verify email: %w", err)
+		}
+	}()
+
+	token, err := m.parseToken(form.Token, verifyEmailToken)
+	if err != nil {
+		return err
+	}
+	var user model.User
+	db := m.db.WithContext(c.Request.Context())
+	if r := db.First(&user, token.Info.UserID); r.Error != nil {
+		return r.Error
+	}
+	if user.Email != token.Info.Email {
+		return ErrInvalidToken
+	}
+	if user.EmailVerified() {
+		return nil
+	}
+	return db.Model(&user).UpdateColumn("email_verified_at", time.Now()).Error
+}
+
+// RequestEmailChange sends a single use token confirming the change of user's
+// email address to the new one in form, and a notice with a link that undoes
+// the change to the current one. The address is only changed once the token
+// is passed to ConfirmEmailChange. The password in form must be user's, its
+// failures are throttled like those of Authenticate. If the new address is in
+// use ErrDuplicateUser is returned, unless users are hidden in which case its
+// owner is notified instead.
+func (m UserAuthManager) RequestEmailChange(
+	user model.User,
+	form schema.EmailChangeForm,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to request email change: %w", err)
+		}
+	}()
+
+	if user.Managed() {
+		return ErrManagedUser
+	}
+	if err = m.checkPassword(user, form.Password, c); err != nil {
+		return err
+	}
+	ctx := c.Request.Context()
+	var count int64
+	if r := m.db.WithContext(ctx).Model(&model.User{}).Where(
+		"email = ?",
+		form.Email,
+	).Count(&count); r.Error != nil {
+		return r.Error
+	}
+	if count > 0 {
+		if !m.hideUsers {
+			return ErrDuplicateUser
+		}
+		return m.msm.Send(
+			ctx,
+			form.Email,
+			"Email change attempt",
+			"Someone tried to move another account to this address, which "+
+				"already has one.",
+		)
+	}
+	// Only the latest request can be confirmed.
+	if err = m.stores.Tokens.RevokeUser(
+		ctx,
+		user.ID,
+		tokenTypeNames[changeEmailToken],
+	); err != nil {
+		return err
+	}
+	info := newTokenInfo(user.ID, changeEmailToken, m.verifyTTL)
+	info.Email = form.Email
+	token, err := m.oneTimeToken(info, c)
+	if err != nil {
+		return err
+	}
+	info = newTokenInfo(user.ID, revertEmailToken, m.revertTTL)
+	info.Email = user.Email
+	revert, err := m.oneTimeToken(info, c)
+	if err != nil {
+		return err
+	}
+	link, err := tokenLink(m.revertURL, revert)
+	if err != nil {
+		return err
+	}
+	if err = m.msm.Send(
+		ctx,
+		form.Email,
+		"Email change code",
+		token,
+	); err != nil {
+		return err
+	}
+	return m.msm.Send(
+		ctx,
+		user.Email,
+		"Email change requested",
+		"A change of this account's email address to "+form.Email+
+			" was requested. If it was not you, undo it and secure your "+
+			"account: "+link,
+	)
+}
+
+// ConfirmEmailChange consumes an email change token and if it is valid sets
+// the email address of the corresponding user to the one it was sent to,
+// which is verified by doing so. If the address was taken in the meantime
+// ErrDuplicateUser is returned.
+func (m UserAuthManager) ConfirmEmailChange(
+	form schema.EmailChangeTokenForm,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to confirm email change: %w", err)
+		}
+	}()
+
+	token, err := m.consumeToken(form.Token, changeEmailToken, c)
+	if err != nil {
+		return err
+	}
+	return m.setEmail(token.Info.UserID, token.Info.Email, c)
+}
+
+// RevertEmailChange consumes an email change revert token and if it is valid
+// restores the email address of the corresponding user to the one it was sent
+// to. Since the change may not have been made by the user, pending email
+// changes and password resets are invalidated and every session is revoked.
+func (m UserAuthManager) RevertEmailChange(
+	form schema.EmailChangeTokenForm,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to revert email change: %w", err)
+		}
+	}()
+
+	token, err := m.consumeToken(form.Token, revertEmailToken, c)
+	if err != nil {
+		return err
+	}
+	userID := token.Info.UserID
+	if err = m.setEmail(userID, token.Info.Email, c); err != nil {
+		return err
+	}
+	ctx := c.Request.Context()
+	for _, t := range []tokenType{changeEmailToken, resetToken} {
+		err = m.stores.Tokens.RevokeUser(ctx, userID, tokenTypeNames[t])
+		if err != nil {
+			return err
+		}
+	}
+	return m.stores.Sessions.RevokeUser(ctx, userID)
+}
+
+// setEmail sets the email address of the user with id userID to the verified
+// address email.
+func (m UserAuthManager) setEmail(
+	userID uint,
+	email string,
+	c *gin.Context,
+) error {
+	var user model.User
+	db := m.db.WithContext(c.Request.Context())
+	if r := db.First(&user, userID); r.Error != nil {
+		return r.Error
+	}
+	r := db.Model(&user).Updates(map[string]any{
+		"email":             email,
+		"email_verified_at": time.Now(),
+	})
+	if errors.Is(r.Error, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateUser
+	}
+	return r.Error
+}
@@ -1,6 +1,10 @@
 package provider
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	// ErrTokenExpired is used to signal that a token is expired.
@@ -12,4 +16,166 @@ var (
 	// ErrInvalidSecretSize is used to signal that an auth provider's secret is
 	// not 64 bytes long.
 	ErrInvalidSecretSize = errors.New("secret must be 64 bytes long")
+	// ErrUnknownKey is used to signal that a signing key is not in the
+	// keyring.
+	ErrUnknownKey = errors.New("unknown key")
+	// ErrInvalidTokenFormat is used to signal that a token format is not
+	// known.
+	ErrInvalidTokenFormat = errors.New("invalid token format")
+	// ErrInvalidAlgorithm is used to signal that a signing algorithm is not
+	// supported or does not match its key.
+	ErrInvalidAlgorithm = errors.New("invalid signing algorithm")
+	// ErrInvalidSameSite is used to signal that a cookie SameSite mode is not
+	// known.
+	ErrInvalidSameSite = errors.New("invalid same site mode")
+	// ErrInvalidCookie is used to signal that cookie attributes contradict
+	// each other.
+	ErrInvalidCookie = errors.New("invalid cookie attributes")
+	// ErrSessionNotFound is used to signal that a session is not in a store.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionRevoked is used to signal that a session has been revoked.
+	ErrSessionRevoked = errors.New("session revoked")
+	// ErrWrongTokenType is used to signal that a token was issued for a
+	// purpose other than the one it was presented for.
+	ErrWrongTokenType = errors.New("wrong token type")
+	// ErrWrongIssuer is used to signal that a token was not issued by this
+	// service.
+	ErrWrongIssuer = errors.New("wrong token issuer")
+	// ErrWrongAudience is used to signal that a token was not issued for this
+	// service.
+	ErrWrongAudience = errors.New("wrong token audience")
+	// ErrTokenReused is used to signal that a single use token has already
+	// been used.
+	ErrTokenReused = errors.New("token reused")
+	// ErrMissingCredentials is used to signal that a request holds no
+	// credentials.
+	ErrMissingCredentials = errors.New("missing credentials")
+	// ErrInvalidTransport is used to signal that a credential transport is
+	// not known.
+	ErrInvalidTransport = errors.New("invalid transport")
+	// ErrTransportDisabled is used to signal that a credential transport is
+	// not enabled.
+	ErrTransportDisabled = errors.New("transport disabled")
+	// ErrAPIKeyNotFound is used to signal that an API key does not exist.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrUnknownScope is used to signal that a scope does not exist.
+	ErrUnknownScope = errors.New("unknown scope")
+	// ErrScopeNotGranted is used to signal that a credential attempted to
+	// grant a scope it does not hold.
+	ErrScopeNotGranted = errors.New("scope not granted")
+	// ErrMFAEnabled is used to signal that a user already has a second factor
+	// enabled.
+	ErrMFAEnabled = errors.New("mfa already enabled")
+	// ErrMFANotEnrolled is used to signal that a user has no second factor
+	// to use.
+	ErrMFANotEnrolled = errors.New("mfa not enrolled")
+	// ErrDuplicateSession is used to signal that a session identifier is
+	// already in use.
+	ErrDuplicateSession = errors.New("duplicate session")
+	// ErrDuplicateToken is used to signal that a one time token identifier
+	// is already in use.
+	ErrDuplicateToken = errors.New("duplicate token")
+	// ErrThrottled is used to signal that login attempts are temporarily
+	// blocked.
+	ErrThrottled = errors.New("too many attempts")
+	// ErrInvalidCSRFToken is used to signal that a cookie authenticated
+	// request lacks the CSRF token of its session.
+	ErrInvalidCSRFToken = errors.New("invalid csrf token")
+	// ErrDuplicateUser is used to signal that a username or email address is
+	// already in use.
+	ErrDuplicateUser = errors.New("username or email already in use")
+	// ErrEmailNotVerified is used to signal that a user has not verified its
+	// email address.
+	ErrEmailNotVerified = errors.New("email not verified")
+	// ErrEmailVerified is used to signal that a user's email address is
+	// already verified.
+	ErrEmailVerified = errors.New("email already verified")
+	// ErrReauthenticationRequired is used to signal that a session must prove
+	// its user's identity again before a sensitive action.
+	ErrReauthenticationRequired = errors.New("reauthentication required")
+	// ErrUnknownProvider is used to signal that an identity provider is not
+	// configured.
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	// ErrIdentityProvider is used to signal that an identity provider could
+	// not be reached or gave an unexpected response.
+	ErrIdentityProvider = errors.New("identity provider error")
+	// ErrInvalidOIDCState is used to signal that the response of an identity
+	// provider does not belong to a login started by the client.
+	ErrInvalidOIDCState = errors.New("invalid oidc state")
+	// ErrInvalidIDToken is used to signal that an ID token is not valid.
+	ErrInvalidIDToken = errors.New("invalid id token")
+	// ErrInvalidAuthenticator is used to signal that an authenticator is not
+	// supported.
+	ErrInvalidAuthenticator = errors.New("invalid authenticator")
+	// ErrDirectory is used to signal that a directory could not be reached
+	// or gave an unexpected response.
+	ErrDirectory = errors.New("directory error")
+	// ErrManagedUser is used to signal that a user's credentials are
+	// managed by a directory and can not be changed here.
+	ErrManagedUser = errors.New("user managed by a directory")
+	// ErrWrongClient is used to signal that a token was issued to a client
+	// other than the one using it.
+	ErrWrongClient = errors.New("token issued to another client")
+	// ErrOAuthClientNotFound is used to signal that an OAuth client does not
+	// exist.
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	// ErrInvalidRedirectURI is used to signal that a redirect URI is not
+	// acceptable or not registered for a client.
+	ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+	// ErrFirstPartyOnly is used to signal that an action can only be
+	// performed by users on sessions of their own, not by OAuth clients or
+	// API keys.
+	ErrFirstPartyOnly = errors.New("first party session required")
+	// ErrInvalidClient is used to signal that an OAuth client failed to
+	// authenticate or is not active.
+	ErrInvalidClient = errors.New("invalid client")
+	// ErrInvalidGrant is used to signal that an authorization code or
+	// refresh token is not valid for the client using it.
+	ErrInvalidGrant = errors.New("invalid grant")
+	// ErrInvalidOAuthRequest is used to signal that an OAuth request lacks a
+	// parameter or has an unacceptable one.
+	ErrInvalidOAuthRequest = errors.New("invalid oauth request")
+	// ErrInvalidScope is used to signal that an OAuth client requested a
+	// scope it can not be granted.
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrUnauthorizedClient is used to signal that an OAuth client can not
+	// use a grant type.
+	ErrUnauthorizedClient = errors.New("grant type not allowed for client")
+	// ErrUnsupportedGrantType is used to signal that an OAuth grant type is
+	// not supported.
+	ErrUnsupportedGrantType = errors.New("unsupported grant type")
+	// ErrUnsupportedResponseType is used to signal that an OAuth response
+	// type is not supported.
+	ErrUnsupportedResponseType = errors.New("unsupported response type")
+	// ErrWebAuthnDisabled is used to signal that passkeys are not
+	// configured.
+	ErrWebAuthnDisabled = errors.New("webauthn disabled")
+	// ErrInvalidWebAuthnConfig is used to signal that the relying party of
+	// passkeys is misconfigured.
+	ErrInvalidWebAuthnConfig = errors.New("invalid webauthn config")
+	// ErrInvalidAttestation is used to signal that the response of an
+	// authenticator to a registration can not be verified.
+	ErrInvalidAttestation = errors.New("invalid attestation")
+	// ErrWebAuthnCredentialNotFound is used to signal that a passkey does
+	// not exist or belongs to another user.
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+	// ErrDuplicateWebAuthnCredential is used to signal that a passkey is
+	// already registered.
+	ErrDuplicateWebAuthnCredential = errors.New(
+		"webauthn credential already registered",
+	)
 )
+
+// ThrottleError is used to signal that login attempts are blocked for
+// RetryAfter. It wraps ErrThrottled.
+type ThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e ThrottleError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrThrottled, e.RetryAfter)
+}
+
+func (e ThrottleError) Unwrap() error {
+	return ErrThrottled
+}
@@ -0,0 +1,278 @@
+package provider
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"gin-gorm-api/config"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWT signing algorithms that can be selected through
+// config.AuthConfig.JWTAlgorithm.
+const (
+	// HS256 signs tokens with the keys of the keyring.
+	HS256 = "HS256"
+	// EdDSA signs tokens with Ed25519 keys.
+	EdDSA = "EdDSA"
+	// ES256 signs tokens with ECDSA P-256 keys.
+	ES256 = "ES256"
+)
+
+// tokenTypeNames holds the value of the type claim of each tokenType.
+var tokenTypeNames = map[tokenType]string{
+	sessionToken:        "session",
+	resetToken:          "reset",
+	refreshToken:        "refresh",
+	mfaToken:            "mfa",
+	verifyEmailToken:    "verify_email",
+	magicLinkToken:      "magic_link",
+	changeEmailToken:    "change_email",
+	revertEmailToken:    "revert_email",
+	oidcFlowToken:       "oidc_flow",
+	authCodeToken:       "authorization_code",
+	webAuthnCreateToken: "webauthn_create",
+	webAuthnGetToken:    "webauthn_get",
+}
+
+// A JWK is the public part of a key used to sign JSON Web Tokens as described
+// by RFC 7517.
+type JWK struct {
+	KeyType   string
+	KeyID     string
+	Algorithm string
+	Curve     string
+	X         string
+	Y         string
+}
+
+// jwtClaims are the claims of the JSON Web Tokens issued by a jwtCodec.
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Type      string `json:"type"`
+	SessionID string `json:"sid,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Provider  string `json:"provider,omitempty"`
+	State     string `json:"state,omitempty"`
+	Verifier  string `json:"verifier,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Redirect  string `json:"redirect_uri,omitempty"`
+	Challenge string `json:"code_challenge,omitempty"`
+}
+
+// jwtCodec encodes tokens in the JWTTokenFormat.
+type jwtCodec struct {
+	method     jwt.SigningMethod
+	active     string
+	signKeys   map[string]any
+	verifyKeys map[string]any
+}
+
+// newJWTCodec returns a jwtCodec using the algorithm selected by conf. HS256
+// uses the keys of keyring while asymmetric algorithms use the base64 encoded
+// PKCS #8 private keys in conf.JWTKeys.
+func newJWTCodec(
+	conf config.AuthConfig,
+	keys keyring,
+) (codec jwtCodec, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create jwt codec: %w", err)
+		}
+	}()
+
+	codec = jwtCodec{
+		signKeys:   make(map[string]any),
+		verifyKeys: make(map[string]any),
+	}
+	switch conf.JWTAlgorithm {
+	case HS256:
+		codec.method = jwt.SigningMethodHS256
+		codec.active, _ = keys.signingKey()
+		for id, key := range keys.keys {
+			codec.signKeys[id] = key
+			codec.verifyKeys[id] = key
+		}
+		return codec, nil
+	case EdDSA:
+		codec.method = jwt.SigningMethodEdDSA
+	case ES256:
+		codec.method = jwt.SigningMethodES256
+	default:
+		return codec, fmt.Errorf(
+			"%w '%s'",
+			ErrInvalidAlgorithm,
+			conf.JWTAlgorithm,
+		)
+	}
+	codec.active = conf.JWTKeyID
+	for id, encKey := range conf.JWTKeys {
+		if err = codec.addPrivateKey(id, encKey); err != nil {
+			return codec, fmt.Errorf("key %q: %w", id, err)
+		}
+	}
+	if _, ok := codec.signKeys[codec.active]; !ok {
+		return codec, fmt.Errorf("key %q: %w", codec.active, ErrUnknownKey)
+	}
+	return codec, nil
+}
+
+// addPrivateKey adds the base64 encoded PKCS #8 private key encKey with
+// identifier id to j. The key must match the signing method of j.
+func (j jwtCodec) addPrivateKey(id, encKey string) error {
+	der, err := base64.StdEncoding.DecodeString(encKey)
+	if err != nil {
+		return err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return err
+	}
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		if j.method != jwt.SigningMethodEdDSA {
+			break
+		}
+		j.signKeys[id] = key
+		j.verifyKeys[id] = key.Public()
+		return nil
+	case *ecdsa.PrivateKey:
+		if j.method != jwt.SigningMethodES256 ||
+			key.Curve != elliptic.P256() {
+			break
+		}
+		j.signKeys[id] = key
+		j.verifyKeys[id] = &key.PublicKey
+		return nil
+	}
+	return ErrInvalidAlgorithm
+}
+
+func (j jwtCodec) encode(info authTokenInfo) (string, error) {
+	claims := jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    info.Issuer,
+			Subject:   strconv.FormatUint(uint64(info.UserID), 10),
+			Audience:  info.Audience,
+			IssuedAt:  jwt.NewNumericDate(info.IssuedAt),
+			ExpiresAt: jwt.NewNumericDate(info.ExpiresAt),
+		},
+		Type:      tokenTypeNames[info.Type],
+		SessionID: info.SessionID,
+		Nonce:     info.Nonce,
+		Scope:     joinScopes(info.Scopes),
+		Email:     info.Email,
+		Provider:  info.Provider,
+		State:     info.State,
+		Verifier:  info.Verifier,
+		ClientID:  info.ClientID,
+		Redirect:  info.Redirect,
+		Challenge: info.Challenge,
+	}
+	token := jwt.NewWithClaims(j.method, claims)
+	if j.active != legacyKeyID {
+		token.Header["kid"] = j.active
+	}
+	return token.SignedString(j.signKeys[j.active])
+}
+
+func (j jwtCodec) decode(s string) (authToken, error) {
+	var claims jwtClaims
+	_, err := jwt.ParseWithClaims(
+		s,
+		&claims,
+		j.verifyKey,
+		jwt.WithValidMethods([]string{j.method.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return authToken{}, ErrInvalidToken
+	}
+	userID, err := strconv.ParseUint(claims.Subject, 10, 0)
+	if err != nil || claims.IssuedAt == nil {
+		return authToken{}, ErrInvalidToken
+	}
+	info := authTokenInfo{
+		UserID:    uint(userID),
+		SessionID: claims.SessionID,
+		Nonce:     claims.Nonce,
+		Scopes:    splitScopes(claims.Scope),
+		Email:     claims.Email,
+		Provider:  claims.Provider,
+		State:     claims.State,
+		Verifier:  claims.Verifier,
+		ClientID:  claims.ClientID,
+		Redirect:  claims.Redirect,
+		Challenge: claims.Challenge,
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	for t, name := range tokenTypeNames {
+		if name == claims.Type {
+			info.Type = t
+		}
+	}
+	if info.Type == 0 {
+		return authToken{}, ErrInvalidToken
+	}
+	return authToken{Info: info}, nil
+}
+
+// verifyKey returns the key named by the kid header of token.
+func (j jwtCodec) verifyKey(token *jwt.Token) (any, error) {
+	id, _ := token.Header["kid"].(string)
+	key, ok := j.verifyKeys[id]
+	if !ok {
+		return nil, ErrUnknownKey // Unknown or retired key.
+	}
+	return key, nil
+}
+
+func (j jwtCodec) publicKeys() []JWK {
+	if j.method == jwt.SigningMethodHS256 {
+		return nil
+	}
+	enc := base64.RawURLEncoding
+	jwks := make([]JWK, 0, len(j.verifyKeys))
+	for _, id := range slices.Sorted(maps.Keys(j.verifyKeys)) {
+		jwk := JWK{KeyID: id, Algorithm: j.method.Alg()}
+		switch key := j.verifyKeys[id].(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = enc.EncodeToString(key)
+		case *ecdsa.PublicKey:
+			ecdhKey, err := key.ECDH()
+			if err != nil {
+				continue
+			}
+			// Uncompressed point: 0x04 || X || Y.
+			point := ecdhKey.Bytes()[1:]
+			jwk.KeyType = "EC"
+			jwk.Curve = "P-256"
+			jwk.X = enc.EncodeToString(point[:32])
+			jwk.Y = enc.EncodeToString(point[32:])
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+// JWKS returns the public keys that verify the tokens issued by m. It is
+// empty unless tokens are JSON Web Tokens signed with an asymmetric
+// algorithm.
+func (m UserAuthManager) JWKS() []JWK {
+	return m.codec.publicKeys()
+}
@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// legacyKeyID is the identifier of the key given by config.Config.Secret.
+// Tokens signed with it carry no key identifier so tokens issued before key
+// rotation was introduced remain valid.
+const legacyKeyID = ""
+
+// A keyring holds the keys used to sign and verify tokens. Tokens are always
+// signed with the active key and verified with the key they name, so keys can
+// be rotated without invalidating outstanding tokens. A key is retired by
+// removing it from the keyring.
+type keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// newKeyring returns a keyring holding the base64 encoded secret, if not
+// empty, under legacyKeyID along with the base64 encoded keys. The key with
+// identifier active is used for signing, an empty active identifier selects
+// the legacy secret. Every key must be 64 bytes long.
+func newKeyring(
+	secret string,
+	keys map[string]string,
+	active string,
+) (ring keyring, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to load keyring: %w", err)
+		}
+	}()
+
+	ring = keyring{active: active, keys: make(map[string][]byte)}
+	encKeys := maps.Clone(keys)
+	if encKeys == nil {
+		encKeys = make(map[string]string)
+	}
+	if secret != "" {
+		encKeys[legacyKeyID] = secret
+	}
+	// Sorted so errors are reported consistently.
+	for _, id := range slices.Sorted(maps.Keys(encKeys)) {
+		key, err := base64.StdEncoding.DecodeString(encKeys[id])
+		if err != nil {
+			return keyring{}, fmt.Errorf("key %q: %w", id, err)
+		}
+		if len(key) != 64 {
+			return keyring{}, fmt.Errorf("key %q: %w", id, ErrInvalidSecretSize)
+		}
+		ring.keys[id] = key
+	}
+	if _, ok := ring.keys[active]; !ok {
+		return keyring{}, fmt.Errorf("key %q: %w", active, ErrUnknownKey)
+	}
+	return ring, nil
+}
+
+// signingKey returns the identifier and value of the active key.
+func (k keyring) signingKey() (string, []byte) {
+	return k.active, k.keys[k.active]
+}
+
+// key returns the key with identifier id and true if it is in the keyring.
+func (k keyring) key(id string) ([]byte, bool) {
+	key, ok := k.keys[id]
+	return key, ok
+}
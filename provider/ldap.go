@@ -0,0 +1,252 @@
+package provider
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// ldapDirectory is the value of model.User.Directory for users provisioned
+// by an LDAPAuthenticator.
+const ldapDirectory = "ldap"
+
+// LDAPAuthenticator is an Authenticator checking passwords against an LDAP
+// directory. Users are provisioned on their first login and their email
+// address and the roles mapped from their groups are synced on every login.
+type LDAPAuthenticator struct {
+	db   *gorm.DB
+	conf config.LDAPConfig
+	// groups holds the parsed keys of conf.GroupRoles.
+	groups map[string]*ldap.DN
+}
+
+// NewLDAPAuthenticator returns an LDAPAuthenticator for the directory
+// described by conf that provisions users in db.
+func NewLDAPAuthenticator(
+	db *gorm.DB,
+	conf config.LDAPConfig,
+) (a LDAPAuthenticator, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create ldap authenticator: %w", err)
+		}
+	}()
+
+	if _, err = url.Parse(conf.URL); err != nil || conf.URL == "" {
+		return a, fmt.Errorf("%w: invalid url '%s'", ErrDirectory, conf.URL)
+	}
+	a = LDAPAuthenticator{
+		db:     db,
+		conf:   conf,
+		groups: make(map[string]*ldap.DN, len(conf.GroupRoles)),
+	}
+	for group := range conf.GroupRoles {
+		if a.groups[group], err = ldap.ParseDN(group); err != nil {
+			return a, fmt.Errorf("group %q: %w", group, err)
+		}
+	}
+	return a, nil
+}
+
+// Authenticate implements Authenticator. The user's entry is searched for
+// and its password checked by binding as it. Failures to reach the directory
+// wrap ErrDirectory.
+func (a LDAPAuthenticator) Authenticate(
+	c *gin.Context,
+	username string,
+	password string,
+) (model.User, error) {
+	// An empty password would make an unauthenticated bind, which
+	// directories accept regardless of the user.
+	if password == "" {
+		return model.User{}, ErrInvalidCredentials
+	}
+	conn, err := a.dial()
+	if err != nil {
+		return model.User{}, fmt.Errorf("%w: %w", ErrDirectory, err)
+	}
+	defer conn.Close()
+	entry, err := a.search(conn, username)
+	if err != nil {
+		return model.User{}, err
+	}
+	err = conn.Bind(entry.DN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return model.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return model.User{}, fmt.Errorf("%w: %w", ErrDirectory, err)
+	}
+	return a.provision(c, entry)
+}
+
+// dial returns a connection to the directory, bound as the service account
+// if one is configured.
+func (a LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(
+		a.conf.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: a.conf.Timeout}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(a.conf.Timeout)
+	if a.conf.StartTLS {
+		uri, _ := url.Parse(a.conf.URL)
+		err = conn.StartTLS(&tls.Config{
+			ServerName: uri.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if a.conf.BindDN != "" {
+		err = conn.Bind(a.conf.BindDN, a.conf.BindPassword)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// search returns the only entry matching the user filter for username.
+func (a LDAPAuthenticator) search(
+	conn *ldap.Conn,
+	username string,
+) (*ldap.Entry, error) {
+	res, err := conn.Search(ldap.NewSearchRequest(
+		a.conf.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2, // More than one match is ambiguous.
+		int(a.conf.Timeout.Seconds()),
+		false,
+		fmt.Sprintf(a.conf.UserFilter, ldap.EscapeFilter(username)),
+		[]string{
+			a.conf.UsernameAttribute,
+			a.conf.EmailAttribute,
+			a.conf.GroupAttribute,
+		},
+		nil,
+	))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDirectory, err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return res.Entries[0], nil
+}
+
+// provision returns the user of entry, creating it if it does not exist and
+// syncing its email address and the roles mapped from its groups. Local
+// users with the same username are not taken over.
+func (a LDAPAuthenticator) provision(
+	c *gin.Context,
+	entry *ldap.Entry,
+) (user model.User, err error) {
+	username := entry.GetAttributeValue(a.conf.UsernameAttribute)
+	email := entry.GetAttributeValue(a.conf.EmailAttribute)
+	if username == "" || email == "" {
+		return user, fmt.Errorf(
+			"%w: entry '%s' lacks username or email",
+			ErrDirectory,
+			entry.DN,
+		)
+	}
+	err = a.db.WithContext(c.Request.Context()).Transaction(
+		func(tx *gorm.DB) error {
+			now := time.Now()
+			r := tx.Preload("Roles").First(&user, "username = ?", username)
+			switch {
+			case errors.Is(r.Error, gorm.ErrRecordNotFound):
+				// The directory vouches for the address.
+				user = model.User{
+					Username:        username,
+					Email:           email,
+					EmailVerifiedAt: &now,
+					Directory:       ldapDirectory,
+				}
+				r = tx.Create(&user)
+			case r.Error != nil:
+				return r.Error
+			case user.Directory != ldapDirectory:
+				return ErrInvalidCredentials
+			case user.Email != email:
+				user.Email = email
+				user.EmailVerifiedAt = &now
+				r = tx.Model(&user).Updates(map[string]any{
+					"email":             email,
+					"email_verified_at": now,
+				})
+			}
+			if errors.Is(r.Error, gorm.ErrDuplicatedKey) {
+				return ErrDuplicateUser
+			}
+			if r.Error != nil {
+				return r.Error
+			}
+			return a.syncRoles(tx, &user, entry)
+		},
+	)
+	return user, err
+}
+
+// syncRoles replaces the roles of user named by the group mapping with those
+// mapped from the groups of entry. Other roles are left untouched.
+func (a LDAPAuthenticator) syncRoles(
+	tx *gorm.DB,
+	user *model.User,
+	entry *ldap.Entry,
+) error {
+	if len(a.conf.GroupRoles) == 0 {
+		return nil
+	}
+	var granted []string
+	for _, value := range entry.GetAttributeValues(a.conf.GroupAttribute) {
+		dn, err := ldap.ParseDN(value)
+		if err != nil {
+			continue
+		}
+		for group, groupDN := range a.groups {
+			role := a.conf.GroupRoles[group]
+			if groupDN.EqualFold(dn) && !slices.Contains(granted, role) {
+				granted = append(granted, role)
+			}
+		}
+	}
+	var roles []model.Role
+	if len(granted) > 0 {
+		if r := tx.Where("name IN ?", granted).Find(&roles); r.Error != nil {
+			return r.Error
+		}
+	}
+	managed := slices.Collect(maps.Values(a.conf.GroupRoles))
+	for _, role := range user.Roles {
+		if !slices.Contains(managed, role.Name) {
+			roles = append(roles, role)
+		}
+	}
+	if err := tx.Model(user).Association("Roles").Replace(roles); err != nil {
+		return err
+	}
+	user.Roles = roles
+	return nil
+}
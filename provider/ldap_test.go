@@ -0,0 +1,554 @@
+package provider
+
+import (
+	"errors"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+const (
+	testBaseDN   = "dc=example,dc=com"
+	testBindDN   = "cn=service,dc=example,dc=com"
+	testBindPass = "service"
+	testAliceDN  = "uid=alice,ou=people,dc=example,dc=com"
+	testEditors  = "cn=editors,ou=groups,dc=example,dc=com"
+	testViewers  = "cn=viewers,ou=groups,dc=example,dc=com"
+)
+
+// A testLDAPEntry is an entry of a testLDAPServer, which can be bound as
+// with its password unless empty.
+type testLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// testLDAPServer is an in process LDAP directory supporting simple binds and
+// searches filtered by equality, presence, and, or and not. It records the
+// binds and searches it is asked for.
+type testLDAPServer struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	entries  []testLDAPEntry
+	binds    []string
+	searches []testLDAPSearch
+}
+
+// A testLDAPSearch is a search received by a testLDAPServer along with the
+// equality assertions of its filter.
+type testLDAPSearch struct {
+	sizeLimit  int64
+	assertions []string
+}
+
+func newTestLDAPServer(
+	t *testing.T,
+	entries ...testLDAPEntry,
+) *testLDAPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testLDAPServer{ln: ln, entries: entries}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *testLDAPServer) url() string {
+	return "ldap://" + s.ln.Addr().String()
+}
+
+// update calls f with the entry with the given dn.
+func (s *testLDAPServer) update(dn string, f func(e *testLDAPEntry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.entries {
+		if s.entries[i].dn == dn {
+			f(&s.entries[i])
+		}
+	}
+}
+
+// serve answers the requests sent over conn as described by RFC 4511.
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		p, err := ber.ReadPacket(conn)
+		if err != nil || len(p.Children) < 2 {
+			return
+		}
+		id, _ := p.Children[0].Value.(int64)
+		op := p.Children[1]
+		var res []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			res = append(res, s.bind(id, op))
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationSearchRequest:
+			res = s.search(id, op)
+		default:
+			res = append(res, ldapResult(
+				id,
+				op.Tag+1,
+				ldap.LDAPResultUnwillingToPerform,
+			))
+		}
+		for _, r := range res {
+			if _, err = conn.Write(r.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *testLDAPServer) bind(id int64, op *ber.Packet) *ber.Packet {
+	dn := op.Children[1].Data.String()
+	password := op.Children[2].Data.String()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.binds = append(s.binds, dn)
+	code := uint16(ldap.LDAPResultInvalidCredentials)
+	for _, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) && e.password != "" &&
+			e.password == password {
+			code = ldap.LDAPResultSuccess
+		}
+	}
+	return ldapResult(id, ldap.ApplicationBindResponse, code)
+}
+
+func (s *testLDAPServer) search(id int64, op *ber.Packet) []*ber.Packet {
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, a.Data.String())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.searches = append(s.searches, testLDAPSearch{
+		sizeLimit:  sizeLimit,
+		assertions: assertions(filter),
+	})
+	var found []testLDAPEntry
+	for _, e := range s.entries {
+		if matches(filter, e) {
+			found = append(found, e)
+		}
+	}
+	code := uint16(ldap.LDAPResultSuccess)
+	if sizeLimit > 0 && int64(len(found)) > sizeLimit {
+		found = found[:sizeLimit]
+		code = ldap.LDAPResultSizeLimitExceeded
+	}
+	res := make([]*ber.Packet, 0, len(found)+1)
+	for _, e := range found {
+		res = append(res, ldapEntryPacket(id, e, attrs))
+	}
+	return append(res, ldapResult(id, ldap.ApplicationSearchResultDone, code))
+}
+
+// matches returns true if and only if e matches filter.
+func matches(filter *ber.Packet, e testLDAPEntry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, f := range filter.Children {
+			if !matches(f, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, f := range filter.Children {
+			if matches(f, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matches(filter.Children[0], e)
+	case ldap.FilterEqualityMatch:
+		attr := filter.Children[0].Data.String()
+		value := filter.Children[1].Data.String()
+		return slices.ContainsFunc(attrValues(e, attr), func(v string) bool {
+			return strings.EqualFold(v, value)
+		})
+	case ldap.FilterPresent:
+		return len(attrValues(e, filter.Data.String())) > 0
+	}
+	return false
+}
+
+// assertions returns the values asserted by the equality matches of filter.
+func assertions(filter *ber.Packet) []string {
+	if filter.Tag == ldap.FilterEqualityMatch {
+		return []string{filter.Children[1].Data.String()}
+	}
+	var values []string
+	if filter.Tag != ldap.FilterPresent {
+		for _, f := range filter.Children {
+			values = append(values, assertions(f)...)
+		}
+	}
+	return values
+}
+
+func attrValues(e testLDAPEntry, attr string) []string {
+	for name, values := range e.attrs {
+		if strings.EqualFold(name, attr) {
+			return values
+		}
+	}
+	return nil
+}
+
+func ldapEnvelope(id int64, op *ber.Packet) *ber.Packet {
+	p := ber.NewSequence("LDAP Response")
+	p.AppendChild(ber.NewInteger(
+		ber.ClassUniversal,
+		ber.TypePrimitive,
+		ber.TagInteger,
+		id,
+		"Message ID",
+	))
+	p.AppendChild(op)
+	return p
+}
+
+func ldapString(s string) *ber.Packet {
+	return ber.NewString(
+		ber.ClassUniversal,
+		ber.TypePrimitive,
+		ber.TagOctetString,
+		s,
+		"",
+	)
+}
+
+func ldapResult(id int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(
+		ber.ClassUniversal,
+		ber.TypePrimitive,
+		ber.TagEnumerated,
+		int64(code),
+		"Result Code",
+	))
+	op.AppendChild(ldapString(""))
+	op.AppendChild(ldapString(""))
+	return ldapEnvelope(id, op)
+}
+
+func ldapEntryPacket(id int64, e testLDAPEntry, attrs []string) *ber.Packet {
+	op := ber.Encode(
+		ber.ClassApplication,
+		ber.TypeConstructed,
+		ldap.ApplicationSearchResultEntry,
+		nil,
+		"",
+	)
+	op.AppendChild(ldapString(e.dn))
+	list := ber.NewSequence("Attributes")
+	for name, values := range e.attrs {
+		wanted := slices.ContainsFunc(attrs, func(a string) bool {
+			return strings.EqualFold(a, name)
+		})
+		if len(attrs) > 0 && !wanted {
+			continue
+		}
+		attr := ber.NewSequence("Attribute")
+		attr.AppendChild(ldapString(name))
+		set := ber.Encode(
+			ber.ClassUniversal,
+			ber.TypeConstructed,
+			ber.TagSet,
+			nil,
+			"Values",
+		)
+		for _, v := range values {
+			set.AppendChild(ldapString(v))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	op.AppendChild(list)
+	return ldapEnvelope(id, op)
+}
+
+// newTestLDAPAuthenticator returns an LDAPAuthenticator for s, bound as the
+// service account, that grants the roles "editor" and "viewer" to the
+// members of the testEditors and testViewers groups.
+func newTestLDAPAuthenticator(
+	t *testing.T,
+	s *testLDAPServer,
+) (LDAPAuthenticator, *gorm.DB) {
+	t.Helper()
+	db := newTestDB(t)
+	for _, name := range []string{"editor", "viewer", "auditor"} {
+		if err := db.Create(&model.Role{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err := NewLDAPAuthenticator(db, config.LDAPConfig{
+		URL:               s.url(),
+		BindDN:            testBindDN,
+		BindPassword:      testBindPass,
+		BaseDN:            testBaseDN,
+		UserFilter:        "(&(objectClass=person)(uid=%s))",
+		UsernameAttribute: "uid",
+		EmailAttribute:    "mail",
+		GroupAttribute:    "memberOf",
+		GroupRoles: map[string]string{
+			testEditors: "editor",
+			testViewers: "viewer",
+		},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, db
+}
+
+func testLDAPEntries() []testLDAPEntry {
+	return []testLDAPEntry{
+		{dn: testBindDN, password: testBindPass},
+		{
+			dn:       testAliceDN,
+			password: "alice-password",
+			attrs: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"alice"},
+				"mail":        {"alice@example.com"},
+				"memberOf":    {testEditors},
+			},
+		},
+	}
+}
+
+// ldapLogin authenticates as username with password through a.
+func ldapLogin(
+	a LDAPAuthenticator,
+	username, password string,
+) (model.User, error) {
+	c, _ := newTestContext(http.MethodPost, "/auth", nil, nil)
+	return a.Authenticate(c, username, password)
+}
+
+func roleNames(db *gorm.DB, user model.User) ([]string, error) {
+	var roles []model.Role
+	if err := db.Model(&user).Association("Roles").Find(&roles); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = role.Name
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	s := newTestLDAPServer(t, testLDAPEntries()...)
+	a, db := newTestLDAPAuthenticator(t, s)
+	user, err := ldapLogin(a, "alice", "alice-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" || user.Email != "alice@example.com" ||
+		!user.EmailVerified() || user.Directory != ldapDirectory {
+		t.Fatalf("got %+v, want a verified directory user", user)
+	}
+	roles, err := roleNames(db, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(roles, []string{"editor"}) {
+		t.Fatalf("got roles %v, want [editor]", roles)
+	}
+	if !slices.Contains(s.binds, testAliceDN) {
+		t.Fatalf("got binds %v, want one as %s", s.binds, testAliceDN)
+	}
+
+	// Later logins find the same user and sync its email address.
+	s.update(testAliceDN, func(e *testLDAPEntry) {
+		e.attrs["mail"] = []string{"alice@example.org"}
+	})
+	again, err := ldapLogin(a, "alice", "alice-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID || again.Email != "alice@example.org" {
+		t.Fatalf("got %+v, want user %d with the new address", again, user.ID)
+	}
+}
+
+func TestLDAPAuthenticateRefused(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		// bound is whether the server must have been bound as the user.
+		bound bool
+	}{
+		{
+			name:     "wrong password",
+			username: "alice",
+			password: "wrong",
+			bound:    true,
+		},
+		{
+			name:     "empty password",
+			username: "alice",
+			password: "",
+		},
+		{
+			name:     "unknown user",
+			username: "bob",
+			password: "alice-password",
+		},
+		{
+			name:     "filter injection",
+			username: "*)(uid=*",
+			password: "alice-password",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestLDAPServer(t, testLDAPEntries()...)
+			a, db := newTestLDAPAuthenticator(t, s)
+			_, err := ldapLogin(a, tt.username, tt.password)
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("got %v, want %v", err, ErrInvalidCredentials)
+			}
+			if bound := slices.Contains(s.binds, testAliceDN); bound != tt.bound {
+				t.Fatalf("got binds %v", s.binds)
+			}
+			if tt.password == "" && len(s.binds) > 0 {
+				t.Fatalf("got binds %v, want none", s.binds)
+			}
+			for _, search := range s.searches {
+				if !slices.Contains(search.assertions, tt.username) {
+					t.Fatalf(
+						"got assertions %v, want %q",
+						search.assertions,
+						tt.username,
+					)
+				}
+			}
+			var count int64
+			if err = db.Model(&model.User{}).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 {
+				t.Fatalf("got %d users, want none", count)
+			}
+		})
+	}
+}
+
+func TestLDAPAuthenticateAmbiguous(t *testing.T) {
+	for _, matches := range []int{2, 3} {
+		entries := testLDAPEntries()
+		for i := 1; i < matches; i++ {
+			entry := entries[1]
+			entry.dn = strings.Replace(entry.dn, "people", "others", 1) +
+				strings.Repeat("x", i)
+			entries = append(entries, entry)
+		}
+		s := newTestLDAPServer(t, entries...)
+		a, _ := newTestLDAPAuthenticator(t, s)
+		_, err := ldapLogin(a, "alice", "alice-password")
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf(
+				"%d matches: got %v, want %v",
+				matches,
+				err,
+				ErrInvalidCredentials,
+			)
+		}
+		if len(s.searches) != 1 || s.searches[0].sizeLimit != 2 {
+			t.Fatalf("%d matches: got searches %+v", matches, s.searches)
+		}
+		if len(s.binds) != 1 {
+			t.Fatalf("%d matches: got binds %v", matches, s.binds)
+		}
+	}
+}
+
+func TestLDAPAuthenticateLocalUser(t *testing.T) {
+	s := newTestLDAPServer(t, testLDAPEntries()...)
+	a, db := newTestLDAPAuthenticator(t, s)
+	local := model.User{Username: "alice", Email: "local@example.com"}
+	if err := db.Create(&local).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, err := ldapLogin(a, "alice", "alice-password")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidCredentials)
+	}
+	var user model.User
+	if err = db.First(&user, local.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != local.Email || user.Managed() {
+		t.Fatalf("got %+v, want the local user untouched", user)
+	}
+}
+
+func TestLDAPSyncRoles(t *testing.T) {
+	s := newTestLDAPServer(t, testLDAPEntries()...)
+	a, db := newTestLDAPAuthenticator(t, s)
+	user, err := ldapLogin(a, "alice", "alice-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var auditor model.Role
+	if err = db.First(&auditor, "name = ?", "auditor").Error; err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&user).Association("Roles").Append(&auditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.update(testAliceDN, func(e *testLDAPEntry) {
+		e.attrs["memberOf"] = []string{
+			strings.ToUpper(testViewers),
+			"cn=unmapped,ou=groups,dc=example,dc=com",
+		}
+	})
+	if user, err = ldapLogin(a, "alice", "alice-password"); err != nil {
+		t.Fatal(err)
+	}
+	roles, err := roleNames(db, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Roles granted outside of the mapping are kept.
+	if want := []string{"auditor", "viewer"}; !slices.Equal(roles, want) {
+		t.Fatalf("got roles %v, want %v", roles, want)
+	}
+}
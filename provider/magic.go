@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RequestMagicLink sends a single use login link to the user whose email
+// address is in form. Whether such a user exists is not disclosed, no error is
+// returned if it does not and the link is sent in the background so that
+// answering takes as long either way. Users managed by a directory are treated
+// as unknown since only the directory can vouch for them. Requests are
+// throttled per email and client address.
+func (m UserAuthManager) RequestMagicLink(
+	form schema.MagicLinkRequestForm,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to request magic link: %w", err)
+		}
+	}()
+
+	if err = m.throttleMail(form.Email, c); err != nil {
+		return err
+	}
+	var user model.User
+	ctx := c.Request.Context()
+	r := m.db.WithContext(ctx).First(&user, "email = ?", form.Email)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+	if user.Managed() {
+		return nil
+	}
+	inBackground(c, func(c *gin.Context) error {
+		return m.sendMagicLink(user, c)
+	})
+	return nil
+}
+
+// sendMagicLink sends a single use login link to user.
+func (m UserAuthManager) sendMagicLink(
+	user model.User,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to send magic link: %w", err)
+		}
+	}()
+
+	info := newTokenInfo(user.ID, magicLinkToken, m.magicTTL)
+	info.Email = user.Email
+	token, err := m.oneTimeToken(info, c)
+	if err != nil {
+		return err
+	}
+	link, err := tokenLink(m.magicURL, token)
+	if err != nil {
+		return err
+	}
+	return m.msm.Send(c.Request.Context(), user.Email, "Login link", link)
+}
+
+// tokenLink returns the page at base with token as its token query
+// parameter, or token itself if base is empty.
+func tokenLink(base, token string) (string, error) {
+	if base == "" {
+		return token, nil
+	}
+	link, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// ConsumeMagicLink validates the magic link token in form and if it is valid,
+// and has not been used before, returns the corresponding user, which can
+// then be passed to RegisterSession. Since the link was sent to the user's
+// email address its ownership is verified as well.
+func (m UserAuthManager) ConsumeMagicLink(
+	form schema.MagicLinkForm,
+	c *gin.Context,
+) (user model.User, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to consume magic link: %w", err)
+		}
+	}()
+
+	token, err := m.consumeToken(form.Token, magicLinkToken, c)
+	if err != nil {
+		return user, err
+	}
+	db := m.db.WithContext(c.Request.Context())
+	if r := db.First(&user, token.Info.UserID); r.Error != nil {
+		return user, r.Error
+	}
+	if user.Email != token.Info.Email {
+		return model.User{}, ErrInvalidToken
+	}
+	if !user.EmailVerified() {
+		now := time.Now()
+		r := db.Model(&user).UpdateColumn("email_verified_at", now)
+		if r.Error != nil {
+			return model.User{}, r.Error
+		}
+		user.EmailVerifiedAt = &now
+	}
+	return user, nil
+}
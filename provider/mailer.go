@@ -2,8 +2,11 @@ package provider
 
 import (
 	"context"
+	"fmt"
 	"gin-gorm-api/config"
 	"log"
+
+	"github.com/gin-gonic/gin"
 )
 
 // A Mailer can send messages with a subject to and address.
@@ -27,3 +30,29 @@ func NewMailer(config config.Config) Mailer {
 	}
 	panic("no production emailer implemented")
 }
+
+// inBackground runs task with a copy of c that outlives its request, so that
+// how long task takes, such as sending an email, is not seen by the client.
+// Errors are logged since the response may already be sent.
+func inBackground(c *gin.Context, task func(c *gin.Context) error) {
+	bc := c.Copy()
+	bc.Request = bc.Request.WithContext(
+		context.WithoutCancel(c.Request.Context()),
+	)
+	go func() {
+		if err := task(bc); err != nil {
+			log.Print(err)
+		}
+	}()
+}
+
+// sendNotice sends the message msg with subject subj to addr in the
+// background.
+func (m UserAuthManager) sendNotice(addr, subj, msg string, c *gin.Context) {
+	inBackground(c, func(c *gin.Context) error {
+		if err := m.msm.Send(c.Request.Context(), addr, subj, msg); err != nil {
+			return fmt.Errorf("failed to send notice: %w", err)
+		}
+		return nil
+	})
+}
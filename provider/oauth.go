@@ -0,0 +1,661 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OAuth grant types accepted by OAuthToken.
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// An OAuthAuthorization is a validated authorization request that a user can
+// approve or deny.
+type OAuthAuthorization struct {
+	Client model.OAuthClient
+	// RedirectURI is where the user is sent back to. It is set as soon as it
+	// is known to be registered for Client, even if the request turns out to
+	// be invalid, so that the error can be reported to the client.
+	RedirectURI string
+	Scopes      []string
+	// requestedURI is the redirect URI as given in the request, empty if
+	// omitted, which the token request must repeat.
+	requestedURI string
+	state        string
+	challenge    string
+}
+
+// Redirect returns RedirectURI with the given parameters and the state of
+// the request added to its query.
+func (a OAuthAuthorization) Redirect(params url.Values) string {
+	link, err := url.Parse(a.RedirectURI)
+	if err != nil {
+		return "" // Registered URIs are always valid.
+	}
+	query := link.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	if a.state != "" {
+		query.Set("state", a.state)
+	}
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+// ErrorRedirect returns where to send the user back to in order to report
+// the error code, as described by RFC 6749 section 4.1.2.1.
+func (a OAuthAuthorization) ErrorRedirect(code, description string) string {
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	return a.Redirect(params)
+}
+
+// OAuthIntrospection describes an active token as described by RFC 7662.
+type OAuthIntrospection struct {
+	Active    bool
+	Scopes    []string
+	ClientID  string
+	Username  string
+	UserID    uint
+	TokenType string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Issuer    string
+	Audience  []string
+}
+
+// RegisterOAuthClient registers a new OAuth client owned by user as specified
+// by form and returns it along with its secret, which is empty for public
+// clients. As with API keys the secret is not stored and a client can only
+// be allowed scopes held by cred.
+func (m UserAuthManager) RegisterOAuthClient(
+	user model.User,
+	cred Credential,
+	form schema.OAuthClientForm,
+	c *gin.Context,
+) (client model.OAuthClient, secret string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to register oauth client: %w", err)
+		}
+	}()
+
+	for _, scope := range form.Scopes {
+		if !slices.Contains(AllScopes(), scope) {
+			return client, "", fmt.Errorf("%w '%s'", ErrUnknownScope, scope)
+		}
+	}
+	if len(cred.MissingScopes(form.Scopes...)) > 0 {
+		return client, "", ErrScopeNotGranted
+	}
+	for _, uri := range form.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return client, "", fmt.Errorf(
+				"%w '%s'",
+				ErrInvalidRedirectURI,
+				uri,
+			)
+		}
+	}
+
+	id, err := randomString(16)
+	if err != nil {
+		return client, "", err
+	}
+	client = model.OAuthClient{
+		ID:           id,
+		OwnerID:      user.ID,
+		Name:         form.Name,
+		RedirectURIs: strings.Join(form.RedirectURIs, " "),
+		Scopes:       joinScopes(form.Scopes),
+	}
+	if form.Confidential {
+		if secret, err = randomString(32); err != nil {
+			return client, "", err
+		}
+		hash := sha256.Sum256([]byte(secret))
+		client.SecretHash = hash[:]
+	}
+	if r := m.db.WithContext(c.Request.Context()).Create(
+		&client,
+	); r.Error != nil {
+		return client, "", r.Error
+	}
+	return client, secret, nil
+}
+
+// ListOAuthClients returns the OAuth clients owned by user.
+func (m UserAuthManager) ListOAuthClients(
+	user model.User,
+	c *gin.Context,
+) ([]model.OAuthClient, error) {
+	var clients []model.OAuthClient
+	if r := m.db.WithContext(c.Request.Context()).Where(
+		"owner_id = ?",
+		user.ID,
+	).Order("created_at DESC").Find(&clients); r.Error != nil {
+		return nil, fmt.Errorf("failed to list oauth clients: %w", r.Error)
+	}
+	return clients, nil
+}
+
+// RevokeOAuthClient revokes the OAuth client owned by user with identifier id
+// along with every session granted to it. If no such client exists
+// ErrOAuthClientNotFound is returned.
+func (m UserAuthManager) RevokeOAuthClient(
+	user model.User,
+	id string,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to revoke oauth client: %w", err)
+		}
+	}()
+
+	db := m.db.WithContext(c.Request.Context())
+	var client model.OAuthClient
+	r := db.First(&client, "id = ? AND owner_id = ?", id, user.ID)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return ErrOAuthClientNotFound
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+	if client.Active() {
+		if r = db.Model(&client).Update(
+			"revoked_at",
+			time.Now(),
+		); r.Error != nil {
+			return r.Error
+		}
+	}
+	return m.stores.Sessions.RevokeClient(c.Request.Context(), client.ID)
+}
+
+// AuthorizationRequest validates the authorization request in form, made on
+// behalf of the holder of cred, and returns what the user is asked to
+// consent to. Only first party sessions can authorize clients, otherwise
+// ErrFirstPartyOnly is returned.
+//
+// Proof Key for Code Exchange, as described by RFC 7636, is required from
+// public clients and only the S256 method is supported. If no scope is
+// requested every scope the client is allowed is.
+func (m UserAuthManager) AuthorizationRequest(
+	cred Credential,
+	form schema.OAuthAuthorizeForm,
+	c *gin.Context,
+) (auth OAuthAuthorization, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to validate authorization: %w", err)
+		}
+	}()
+
+	if cred.SessionID == "" || cred.ClientID != "" {
+		return auth, ErrFirstPartyOnly
+	}
+	db := m.db.WithContext(c.Request.Context())
+	if auth.Client, err = m.activeOAuthClient(db, form.ClientID); err != nil {
+		return auth, err
+	}
+	uris := strings.Fields(auth.Client.RedirectURIs)
+	switch {
+	case slices.Contains(uris, form.RedirectURI):
+		auth.RedirectURI = form.RedirectURI
+	case form.RedirectURI == "" && len(uris) == 1:
+		auth.RedirectURI = uris[0]
+	default:
+		return auth, ErrInvalidRedirectURI
+	}
+	auth.requestedURI = form.RedirectURI
+	auth.state = form.State
+
+	if form.ResponseType != "code" {
+		return auth, ErrUnsupportedResponseType
+	}
+	switch {
+	case form.CodeChallenge == "" && auth.Client.Confidential():
+	case form.CodeChallenge == "":
+		return auth, fmt.Errorf(
+			"%w: code_challenge required",
+			ErrInvalidOAuthRequest,
+		)
+	case form.CodeChallengeMethod != "S256":
+		return auth, fmt.Errorf(
+			"%w: code_challenge_method must be S256",
+			ErrInvalidOAuthRequest,
+		)
+	case len(form.CodeChallenge) != 43:
+		return auth, fmt.Errorf(
+			"%w: malformed code_challenge",
+			ErrInvalidOAuthRequest,
+		)
+	}
+	auth.challenge = form.CodeChallenge
+	if auth.Scopes, err = clientScopes(
+		auth.Client,
+		form.Scope,
+	); err != nil {
+		return auth, err
+	}
+	if len(cred.MissingScopes(auth.Scopes...)) > 0 {
+		return auth, ErrInvalidScope
+	}
+	return auth, nil
+}
+
+// ApproveAuthorization issues a single use authorization code for user to
+// the client of auth and returns where to send the user back to with it.
+func (m UserAuthManager) ApproveAuthorization(
+	user model.User,
+	auth OAuthAuthorization,
+	c *gin.Context,
+) (string, error) {
+	info := newTokenInfo(user.ID, authCodeToken, m.codeTTL)
+	info.ClientID = auth.Client.ID
+	info.Redirect = auth.requestedURI
+	info.Challenge = auth.challenge
+	info.Scopes = auth.Scopes
+	code, err := m.oneTimeToken(info, c)
+	if err != nil {
+		return "", fmt.Errorf("failed to approve authorization: %w", err)
+	}
+	return auth.Redirect(url.Values{"code": {code}}), nil
+}
+
+// OAuthToken authenticates the client with identifier clientID and secret
+// and issues it tokens for the grant in form, as described by RFC 6749
+// section 4.1.3 for authorization codes, section 6 for refresh tokens and
+// section 4.4 for client credentials. The tokens are those of a session
+// restricted to the granted scopes, so they are accepted wherever session
+// tokens are, but can only be refreshed by the client. Client credentials
+// act on behalf of the client's owner and are not given a refresh token.
+// They are refused with ErrInvalidClient once the owner is deleted and with
+// a ThrottleError while the owner is locked out. Each request is given a
+// session of its own, so the client's expired sessions are purged then to
+// keep only those issued within the session lifetime.
+func (m UserAuthManager) OAuthToken(
+	clientID string,
+	secret string,
+	form schema.OAuthTokenForm,
+	c *gin.Context,
+) (tokens SessionTokens, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to issue oauth token: %w", err)
+		}
+	}()
+
+	db := m.db.WithContext(c.Request.Context())
+	client, err := m.authenticateOAuthClient(db, clientID, secret)
+	if err != nil {
+		return tokens, err
+	}
+	switch form.GrantType {
+	case GrantAuthorizationCode:
+		return m.exchangeAuthorizationCode(client, form, c)
+	case GrantRefreshToken:
+		_, tokens, err = m.refreshSession(form.RefreshToken, client.ID, c)
+		if isGrantError(err) {
+			return tokens, fmt.Errorf("%w: %w", ErrInvalidGrant, err)
+		}
+		return tokens, err
+	case GrantClientCredentials:
+		if !client.Confidential() {
+			return tokens, ErrUnauthorizedClient
+		}
+		scopes, err := clientScopes(client, form.Scope)
+		if err != nil {
+			return tokens, err
+		}
+		var owner model.User
+		r := db.First(&owner, client.OwnerID)
+		if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+			return tokens, ErrInvalidClient
+		}
+		if r.Error != nil {
+			return tokens, r.Error
+		}
+		if err = m.checkAttempts(c, m.userKey(owner.Username)); err != nil {
+			return tokens, err
+		}
+		err = m.stores.Sessions.PurgeClient(c.Request.Context(), client.ID)
+		if err != nil {
+			return tokens, err
+		}
+		session, err := m.clientSession(owner, client, scopes, c)
+		if err != nil {
+			return tokens, err
+		}
+		session.ExpiresAt = session.CreatedAt.Add(m.sessionTTL)
+		if tokens, err = m.createClientSession(session, c); err != nil {
+			return tokens, err
+		}
+		tokens.Refresh = ""
+		return tokens, nil
+	default:
+		return tokens, ErrUnsupportedGrantType
+	}
+}
+
+// exchangeAuthorizationCode issues tokens to client for the authorization
+// code in form. A code used twice has leaked, so the session it was first
+// exchanged for is revoked as described by RFC 6749 section 4.1.2.
+func (m UserAuthManager) exchangeAuthorizationCode(
+	client model.OAuthClient,
+	form schema.OAuthTokenForm,
+	c *gin.Context,
+) (SessionTokens, error) {
+	ctx := c.Request.Context()
+	token, record, err := m.consumeTokenRecord(form.Code, authCodeToken, c)
+	if errors.Is(err, ErrTokenReused) && record.SessionID != "" {
+		if rErr := m.stores.Sessions.Revoke(ctx, record.SessionID); rErr != nil {
+			return SessionTokens{}, errors.Join(err, rErr)
+		}
+	}
+	if isGrantError(err) {
+		return SessionTokens{}, fmt.Errorf("%w: %w", ErrInvalidGrant, err)
+	}
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	info := token.Info
+	if info.ClientID != client.ID || info.Redirect != form.RedirectURI {
+		return SessionTokens{}, ErrInvalidGrant
+	}
+	// A verifier without a challenge could hide a downgrade attack, as
+	// described by RFC 9700 section 4.8.2.
+	if (info.Challenge == "") != (form.CodeVerifier == "") {
+		return SessionTokens{}, ErrInvalidGrant
+	}
+	if info.Challenge != "" {
+		hash := sha256.Sum256([]byte(form.CodeVerifier))
+		challenge := base64.RawURLEncoding.EncodeToString(hash[:])
+		if subtle.ConstantTimeCompare(
+			[]byte(challenge),
+			[]byte(info.Challenge),
+		) != 1 {
+			return SessionTokens{}, ErrInvalidGrant
+		}
+	}
+	var user model.User
+	r := m.db.WithContext(ctx).First(&user, info.UserID)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return SessionTokens{}, ErrInvalidGrant
+	}
+	if r.Error != nil {
+		return SessionTokens{}, r.Error
+	}
+	session, err := m.clientSession(user, client, info.Scopes, c)
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	// The session is recorded before it is created so that a replay can not
+	// miss it once its tokens are out.
+	if err = m.stores.Tokens.SetSession(ctx, info.Nonce, session.ID); err != nil {
+		return SessionTokens{}, err
+	}
+	return m.createClientSession(session, c)
+}
+
+// clientSession returns a new session for user granted to client with the
+// given scopes. Since the user did not prove its identity to the client the
+// session must reauthenticate before any sensitive action.
+func (m UserAuthManager) clientSession(
+	user model.User,
+	client model.OAuthClient,
+	scopes []string,
+	c *gin.Context,
+) (model.Session, error) {
+	session, err := m.newSession(user, c)
+	if err != nil {
+		return session, err
+	}
+	session.ClientID = client.ID
+	session.Scopes = joinScopes(scopes)
+	session.AuthenticatedAt = nil
+	return session, nil
+}
+
+// createClientSession stores session and returns its tokens.
+func (m UserAuthManager) createClientSession(
+	session model.Session,
+	c *gin.Context,
+) (SessionTokens, error) {
+	err := m.stores.Sessions.Create(c.Request.Context(), session)
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	return m.sessionTokens(session)
+}
+
+// IntrospectOAuthToken authenticates the client with identifier clientID and
+// secret and describes the access or refresh token s, as described by RFC
+// 7662. Tokens that are not valid, or that were granted to another client,
+// are reported as inactive. Public clients can not authenticate so they are
+// refused with ErrUnauthorizedClient, as required by section 2.1.
+func (m UserAuthManager) IntrospectOAuthToken(
+	clientID string,
+	secret string,
+	s string,
+	c *gin.Context,
+) (desc OAuthIntrospection, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to introspect oauth token: %w", err)
+		}
+	}()
+
+	db := m.db.WithContext(c.Request.Context())
+	client, err := m.authenticateOAuthClient(db, clientID, secret)
+	if err != nil {
+		return desc, err
+	}
+	if !client.Confidential() {
+		return desc, ErrUnauthorizedClient
+	}
+	token, session, err := m.clientToken(client, s, c)
+	if err != nil || token.Info.Type == 0 {
+		return desc, err
+	}
+	var user model.User
+	r := db.First(&user, session.UserID)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return desc, nil
+	}
+	if r.Error != nil {
+		return desc, r.Error
+	}
+	return OAuthIntrospection{
+		Active:    true,
+		Scopes:    splitScopes(session.Scopes),
+		ClientID:  client.ID,
+		Username:  user.Username,
+		UserID:    user.ID,
+		TokenType: tokenTypeNames[token.Info.Type],
+		IssuedAt:  token.Info.IssuedAt,
+		ExpiresAt: token.Info.ExpiresAt,
+		Issuer:    token.Info.Issuer,
+		Audience:  token.Info.Audience,
+	}, nil
+}
+
+// RevokeOAuthToken authenticates the client with identifier clientID and
+// secret and revokes the session of the access or refresh token s, as
+// described by RFC 7009. Tokens that are not valid, or that were granted to
+// another client, are ignored.
+func (m UserAuthManager) RevokeOAuthToken(
+	clientID string,
+	secret string,
+	s string,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to revoke oauth token: %w", err)
+		}
+	}()
+
+	db := m.db.WithContext(c.Request.Context())
+	client, err := m.authenticateOAuthClient(db, clientID, secret)
+	if err != nil {
+		return err
+	}
+	token, session, err := m.clientToken(client, s, c)
+	if err != nil || token.Info.Type == 0 {
+		return err
+	}
+	return m.stores.Sessions.Revoke(c.Request.Context(), session.ID)
+}
+
+// clientToken returns the access or refresh token encoded in s and its
+// session provided that it is valid and was granted to client. Otherwise a
+// zero token is returned without error.
+func (m UserAuthManager) clientToken(
+	client model.OAuthClient,
+	s string,
+	c *gin.Context,
+) (authToken, model.Session, error) {
+	token, err := m.parseToken(s, sessionToken)
+	if errors.Is(err, ErrWrongTokenType) {
+		token, err = m.parseToken(s, refreshToken)
+	}
+	if err != nil {
+		return authToken{}, model.Session{}, nil
+	}
+	session, err := m.stores.Sessions.Get(
+		c.Request.Context(),
+		token.Info.SessionID,
+	)
+	if errors.Is(err, ErrSessionNotFound) {
+		return authToken{}, session, nil
+	}
+	if err != nil {
+		return authToken{}, session, err
+	}
+	// Refresh tokens are only valid until they are rotated.
+	if !session.Active() ||
+		session.UserID != token.Info.UserID ||
+		session.ClientID != client.ID ||
+		token.Info.Type == refreshToken &&
+			token.Info.Nonce != session.RefreshNonce {
+		return authToken{}, session, nil
+	}
+	return token, session, nil
+}
+
+// authenticateOAuthClient returns the active OAuth client with identifier id
+// provided that secret is its secret. Public clients have no secret.
+func (m UserAuthManager) authenticateOAuthClient(
+	db *gorm.DB,
+	id string,
+	secret string,
+) (model.OAuthClient, error) {
+	client, err := m.activeOAuthClient(db, id)
+	if err != nil {
+		return client, err
+	}
+	if !client.Confidential() {
+		if secret != "" {
+			return client, ErrInvalidClient
+		}
+		return client, nil
+	}
+	hash := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(hash[:], client.SecretHash) != 1 {
+		return client, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// activeOAuthClient returns the active OAuth client with identifier id.
+func (m UserAuthManager) activeOAuthClient(
+	db *gorm.DB,
+	id string,
+) (model.OAuthClient, error) {
+	var client model.OAuthClient
+	r := db.First(&client, "id = ?", id)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return client, ErrInvalidClient
+	}
+	if r.Error != nil {
+		return client, r.Error
+	}
+	if !client.Active() {
+		return client, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// clientScopes returns the space separated scopes in requested provided that
+// client is allowed all of them, or every scope client is allowed if none
+// are requested.
+func clientScopes(client model.OAuthClient, requested string) (
+	[]string,
+	error,
+) {
+	allowed := splitScopes(client.Scopes)
+	scopes := splitScopes(requested)
+	if len(scopes) == 0 {
+		return allowed, nil
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return nil, fmt.Errorf("%w '%s'", ErrInvalidScope, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// validRedirectURI returns true if and only if s can be registered as a
+// redirect URI: an absolute URI without fragment that uses https, http on
+// the loopback interface or, for native apps, a private-use scheme as
+// described by RFC 8252 section 7.
+func validRedirectURI(s string) bool {
+	uri, err := url.Parse(s)
+	if err != nil || !uri.IsAbs() || uri.Fragment != "" {
+		return false
+	}
+	switch uri.Scheme {
+	case "https":
+		return uri.Host != ""
+	case "http":
+		host := uri.Hostname()
+		return host == "localhost" || net.ParseIP(host).IsLoopback()
+	}
+	return strings.Contains(uri.Scheme, ".")
+}
+
+// isGrantError returns true if and only if err signals that a grant is not
+// valid, as opposed to a failure to check it.
+func isGrantError(err error) bool {
+	return errors.Is(err, ErrInvalidToken) ||
+		errors.Is(err, ErrTokenExpired) ||
+		errors.Is(err, ErrTokenReused) ||
+		errors.Is(err, ErrWrongTokenType) ||
+		errors.Is(err, ErrWrongIssuer) ||
+		errors.Is(err, ErrWrongAudience) ||
+		errors.Is(err, ErrWrongClient) ||
+		errors.Is(err, ErrSessionRevoked) ||
+		errors.Is(err, ErrSessionNotFound)
+}
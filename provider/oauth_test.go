@@ -0,0 +1,530 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// testRedirectURI is the redirect URI test clients are registered with.
+const testRedirectURI = "https://client.example/callback"
+
+// testVerifier is the PKCE code verifier of the tests.
+var testVerifier = strings.Repeat("v", 43)
+
+// testChallenge returns the S256 code challenge of verifier.
+func testChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// firstPartyCredential is the credential of a first party session granted
+// every scope.
+var firstPartyCredential = Credential{
+	SessionID: "session",
+	Scopes:    AllScopes(),
+}
+
+// newOAuthTestUser returns a new user named username.
+func newOAuthTestUser(t *testing.T, db *gorm.DB, username string) model.User {
+	t.Helper()
+	user := model.User{Username: username, Email: username + "@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newOAuthTestClient registers a client owned by user along with its secret,
+// which is empty unless the client is confidential.
+func newOAuthTestClient(
+	t *testing.T,
+	m UserAuthManager,
+	user model.User,
+	confidential bool,
+) (model.OAuthClient, string) {
+	t.Helper()
+	c, _ := newTestContext(http.MethodPost, "/oauth/clients", nil, nil)
+	client, secret, err := m.RegisterOAuthClient(
+		user,
+		firstPartyCredential,
+		schema.OAuthClientForm{
+			Name:         "client",
+			RedirectURIs: []string{testRedirectURI},
+			Scopes:       []string{ScopeUserRead, ScopeSessionRead},
+			Confidential: confidential,
+		},
+		c,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, secret
+}
+
+// authorizeTestClient returns an authorization code issued to client for
+// user, bound to the PKCE challenge if not empty.
+func authorizeTestClient(
+	t *testing.T,
+	m UserAuthManager,
+	user model.User,
+	client model.OAuthClient,
+	challenge string,
+) string {
+	t.Helper()
+	c, _ := newTestContext(http.MethodPost, "/oauth/authorize", nil, nil)
+	form := schema.OAuthAuthorizeForm{
+		ResponseType:  "code",
+		ClientID:      client.ID,
+		RedirectURI:   testRedirectURI,
+		CodeChallenge: challenge,
+	}
+	if challenge != "" {
+		form.CodeChallengeMethod = "S256"
+	}
+	auth, err := m.AuthorizationRequest(firstPartyCredential, form, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := m.ApproveAuthorization(user, auth, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link.Query().Get("code")
+}
+
+// requestTestToken sends the token request in form on behalf of client
+// authenticated with secret.
+func requestTestToken(
+	m UserAuthManager,
+	client model.OAuthClient,
+	secret string,
+	form schema.OAuthTokenForm,
+) (SessionTokens, error) {
+	c, _ := newTestContext(http.MethodPost, "/oauth/token", nil, nil)
+	return m.OAuthToken(client.ID, secret, form, c)
+}
+
+// codeTestTokens returns the tokens issued to the public client for a new
+// authorization code of user.
+func codeTestTokens(
+	t *testing.T,
+	m UserAuthManager,
+	user model.User,
+	client model.OAuthClient,
+) SessionTokens {
+	t.Helper()
+	code := authorizeTestClient(t, m, user, client, testChallenge(testVerifier))
+	tokens, err := requestTestToken(m, client, "", schema.OAuthTokenForm{
+		GrantType:    GrantAuthorizationCode,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testVerifier,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+// checkSessionRevoked fails t unless the session with identifier id is
+// revoked as expected.
+func checkSessionRevoked(
+	t *testing.T,
+	m UserAuthManager,
+	id string,
+	revoked bool,
+) {
+	t.Helper()
+	c, _ := newTestContext(http.MethodGet, "/auth/sessions", nil, nil)
+	session, err := m.stores.Sessions.Get(c.Request.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (session.RevokedAt != nil) != revoked {
+		t.Fatalf("got revoked at %v, want revoked %t", session.RevokedAt, revoked)
+	}
+}
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	m, db, _ := newTestManager(t, nil)
+	user := newOAuthTestUser(t, db, "alice")
+	tests := []struct {
+		name         string
+		confidential bool
+		challenge    string
+		verifier     string
+		redirectURI  string
+		err          error
+	}{
+		{
+			name:        "pkce",
+			challenge:   testChallenge(testVerifier),
+			verifier:    testVerifier,
+			redirectURI: testRedirectURI,
+		},
+		{
+			name:        "wrong verifier",
+			challenge:   testChallenge(testVerifier),
+			verifier:    strings.Repeat("w", 43),
+			redirectURI: testRedirectURI,
+			err:         ErrInvalidGrant,
+		},
+		{
+			name:        "missing verifier",
+			challenge:   testChallenge(testVerifier),
+			redirectURI: testRedirectURI,
+			err:         ErrInvalidGrant,
+		},
+		{
+			name:         "confidential without pkce",
+			confidential: true,
+			redirectURI:  testRedirectURI,
+		},
+		{
+			name:         "verifier without challenge",
+			confidential: true,
+			verifier:     testVerifier,
+			redirectURI:  testRedirectURI,
+			err:          ErrInvalidGrant,
+		},
+		{
+			name:        "redirect uri mismatch",
+			challenge:   testChallenge(testVerifier),
+			verifier:    testVerifier,
+			redirectURI: "https://client.example/other",
+			err:         ErrInvalidGrant,
+		},
+		{
+			name:      "redirect uri omitted",
+			challenge: testChallenge(testVerifier),
+			verifier:  testVerifier,
+			err:       ErrInvalidGrant,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, secret := newOAuthTestClient(t, m, user, tt.confidential)
+			code := authorizeTestClient(t, m, user, client, tt.challenge)
+			tokens, err := requestTestToken(
+				m,
+				client,
+				secret,
+				schema.OAuthTokenForm{
+					GrantType:    GrantAuthorizationCode,
+					Code:         code,
+					RedirectURI:  tt.redirectURI,
+					CodeVerifier: tt.verifier,
+				},
+			)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if tokens.Access == "" || tokens.Refresh == "" {
+				t.Fatalf("got tokens %+v, want access and refresh", tokens)
+			}
+		})
+	}
+}
+
+func TestOAuthAuthorizationCodeReplay(t *testing.T) {
+	for name, inMemory := range map[string]bool{
+		"memory":   true,
+		"database": false,
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, db, _ := newTestManager(t, func(conf *config.Config) {
+				conf.Testing = inMemory
+			})
+			user := newOAuthTestUser(t, db, "alice")
+			client, _ := newOAuthTestClient(t, m, user, false)
+			code := authorizeTestClient(
+				t,
+				m,
+				user,
+				client,
+				testChallenge(testVerifier),
+			)
+			form := schema.OAuthTokenForm{
+				GrantType:    GrantAuthorizationCode,
+				Code:         code,
+				RedirectURI:  testRedirectURI,
+				CodeVerifier: testVerifier,
+			}
+			tokens, err := requestTestToken(m, client, "", form)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSessionRevoked(t, m, tokens.sessionID, false)
+			_, err = requestTestToken(m, client, "", form)
+			if !errors.Is(err, ErrInvalidGrant) ||
+				!errors.Is(err, ErrTokenReused) {
+				t.Fatalf(
+					"got %v, want %v and %v",
+					err,
+					ErrInvalidGrant,
+					ErrTokenReused,
+				)
+			}
+			// The session first issued for the code is revoked.
+			checkSessionRevoked(t, m, tokens.sessionID, true)
+			_, err = requestTestToken(m, client, "", schema.OAuthTokenForm{
+				GrantType:    GrantRefreshToken,
+				RefreshToken: tokens.Refresh,
+			})
+			if !errors.Is(err, ErrSessionRevoked) {
+				t.Fatalf("got %v, want %v", err, ErrSessionRevoked)
+			}
+		})
+	}
+}
+
+func TestOAuthClientAuthentication(t *testing.T) {
+	m, db, _ := newTestManager(t, nil)
+	user := newOAuthTestUser(t, db, "alice")
+	public, _ := newOAuthTestClient(t, m, user, false)
+	confidential, secret := newOAuthTestClient(t, m, user, true)
+	revoked, revokedSecret := newOAuthTestClient(t, m, user, true)
+	c, _ := newTestContext(http.MethodDelete, "/oauth/clients", nil, nil)
+	if err := m.RevokeOAuthClient(user, revoked.ID, c); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		client model.OAuthClient
+		secret string
+		err    error
+	}{
+		{name: "confidential", client: confidential, secret: secret},
+		{
+			name:   "confidential with wrong secret",
+			client: confidential,
+			secret: "wrong",
+			err:    ErrInvalidClient,
+		},
+		{
+			name:   "confidential without secret",
+			client: confidential,
+			err:    ErrInvalidClient,
+		},
+		{
+			name:   "public with secret",
+			client: public,
+			secret: secret,
+			err:    ErrInvalidClient,
+		},
+		{
+			name:   "public client credentials",
+			client: public,
+			err:    ErrUnauthorizedClient,
+		},
+		{
+			name:   "revoked",
+			client: revoked,
+			secret: revokedSecret,
+			err:    ErrInvalidClient,
+		},
+		{
+			name:   "unknown",
+			client: model.OAuthClient{ID: "unknown"},
+			secret: secret,
+			err:    ErrInvalidClient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := requestTestToken(
+				m,
+				tt.client,
+				tt.secret,
+				schema.OAuthTokenForm{GrantType: GrantClientCredentials},
+			)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestOAuthRevokedClientSessions(t *testing.T) {
+	m, db, _ := newTestManager(t, nil)
+	user := newOAuthTestUser(t, db, "alice")
+	client, _ := newOAuthTestClient(t, m, user, false)
+	tokens := codeTestTokens(t, m, user, client)
+	c, _ := newTestContext(http.MethodDelete, "/oauth/clients", nil, nil)
+	if err := m.RevokeOAuthClient(user, client.ID, c); err != nil {
+		t.Fatal(err)
+	}
+	checkSessionRevoked(t, m, tokens.sessionID, true)
+	_, err := requestTestToken(m, client, "", schema.OAuthTokenForm{
+		GrantType:    GrantRefreshToken,
+		RefreshToken: tokens.Refresh,
+	})
+	if !errors.Is(err, ErrInvalidClient) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidClient)
+	}
+}
+
+func TestOAuthRefreshWrongClient(t *testing.T) {
+	m, db, _ := newTestManager(t, nil)
+	user := newOAuthTestUser(t, db, "alice")
+	client, _ := newOAuthTestClient(t, m, user, false)
+	other, _ := newOAuthTestClient(t, m, user, false)
+	tokens := codeTestTokens(t, m, user, client)
+	form := schema.OAuthTokenForm{
+		GrantType:    GrantRefreshToken,
+		RefreshToken: tokens.Refresh,
+	}
+	_, err := requestTestToken(m, other, "", form)
+	if !errors.Is(err, ErrInvalidGrant) || !errors.Is(err, ErrWrongClient) {
+		t.Fatalf("got %v, want %v and %v", err, ErrInvalidGrant, ErrWrongClient)
+	}
+	// The refresh token is left usable by its client.
+	if _, err = requestTestToken(m, client, "", form); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOAuthTokenOfOtherClient(t *testing.T) {
+	m, db, _ := newTestManager(t, nil)
+	user := newOAuthTestUser(t, db, "alice")
+	client, secret := newOAuthTestClient(t, m, user, true)
+	other, otherSecret := newOAuthTestClient(t, m, user, true)
+	tokens, err := requestTestToken(m, client, secret, schema.OAuthTokenForm{
+		GrantType: GrantClientCredentials,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := newTestContext(http.MethodPost, "/oauth/introspect", nil, nil)
+	desc, err := m.IntrospectOAuthToken(other.ID, otherSecret, tokens.Access, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Active {
+		t.Fatal("token of another client reported as active")
+	}
+	err = m.RevokeOAuthToken(other.ID, otherSecret, tokens.Access, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSessionRevoked(t, m, tokens.sessionID, false)
+
+	desc, err = m.IntrospectOAuthToken(client.ID, secret, tokens.Access, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !desc.Active || desc.ClientID != client.ID || desc.UserID != user.ID {
+		t.Fatalf("got %+v, want the active token of the client", desc)
+	}
+	if err = m.RevokeOAuthToken(client.ID, secret, tokens.Access, c); err != nil {
+		t.Fatal(err)
+	}
+	checkSessionRevoked(t, m, tokens.sessionID, true)
+}
+
+func TestOAuthClientCredentialsOwner(t *testing.T) {
+	m, db, _ := newTestManager(t, func(conf *config.Config) {
+		conf.Auth.Throttle = testThrottle
+	})
+	user := newOAuthTestUser(t, db, "alice")
+	client, secret := newOAuthTestClient(t, m, user, true)
+	form := schema.OAuthTokenForm{GrantType: GrantClientCredentials}
+	c, _ := newTestContext(http.MethodPost, "/auth", nil, nil)
+	for range testThrottle.UserLockoutThreshold {
+		if err := m.failAttempt(c, m.userKey(user.Username)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var throttleErr ThrottleError
+	_, err := requestTestToken(m, client, secret, form)
+	if !errors.As(err, &throttleErr) {
+		t.Fatalf("got %v, want a ThrottleError", err)
+	}
+	if err = m.UnlockUser(user, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = requestTestToken(m, client, secret, form); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Delete(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, err = requestTestToken(m, client, secret, form)
+	if !errors.Is(err, ErrInvalidClient) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidClient)
+	}
+}
+
+func TestOAuthIntrospectPublicClient(t *testing.T) {
+	m, db, _ := newTestManager(t, nil)
+	user := newOAuthTestUser(t, db, "alice")
+	client, _ := newOAuthTestClient(t, m, user, false)
+	tokens := codeTestTokens(t, m, user, client)
+	c, _ := newTestContext(http.MethodPost, "/oauth/introspect", nil, nil)
+	_, err := m.IntrospectOAuthToken(client.ID, "", tokens.Access, c)
+	if !errors.Is(err, ErrUnauthorizedClient) {
+		t.Fatalf("got %v, want %v", err, ErrUnauthorizedClient)
+	}
+	// Public clients can still revoke their own tokens.
+	if err = m.RevokeOAuthToken(client.ID, "", tokens.Access, c); err != nil {
+		t.Fatal(err)
+	}
+	checkSessionRevoked(t, m, tokens.sessionID, true)
+}
+
+func TestOAuthClientCredentialsPurge(t *testing.T) {
+	for name, inMemory := range map[string]bool{
+		"memory":   true,
+		"database": false,
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, db, _ := newTestManager(t, func(conf *config.Config) {
+				conf.Testing = inMemory
+			})
+			user := newOAuthTestUser(t, db, "alice")
+			client, secret := newOAuthTestClient(t, m, user, true)
+			c, _ := newTestContext(http.MethodPost, "/oauth/token", nil, nil)
+			ctx := c.Request.Context()
+			if err := m.stores.Sessions.Create(ctx, model.Session{
+				ID:        "expired",
+				UserID:    user.ID,
+				ClientID:  client.ID,
+				ExpiresAt: time.Now().Add(-time.Minute),
+			}); err != nil {
+				t.Fatal(err)
+			}
+			form := schema.OAuthTokenForm{GrantType: GrantClientCredentials}
+			first, err := requestTestToken(m, client, secret, form)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = requestTestToken(m, client, secret, form); err != nil {
+				t.Fatal(err)
+			}
+			_, err = m.stores.Sessions.Get(ctx, "expired")
+			if !errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("got %v, want %v", err, ErrSessionNotFound)
+			}
+			// Active sessions are kept.
+			checkSessionRevoked(t, m, first.sessionID, false)
+		})
+	}
+}
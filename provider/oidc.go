@@ -0,0 +1,645 @@
+package provider
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	// oidcScopes are requested from every identity provider.
+	oidcScopes = "openid email profile"
+	// oidcMaxResponse bounds the size of the responses read from identity
+	// providers.
+	oidcMaxResponse = 1 << 20
+	// oidcKeysRefresh is how often the keys of a provider may be fetched
+	// again when an ID token names one that is not known.
+	oidcKeysRefresh = time.Minute
+)
+
+// oidcAlgorithms are the ID token signing algorithms that are accepted.
+var oidcAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// An oidcClient logs users in through the OpenID Connect authorization code
+// flow with PKCE at the providers given by config.OIDCConfig.
+type oidcClient struct {
+	providers   map[string]*oidcProvider
+	redirectURL string
+	flowTTL     time.Duration
+	http        *http.Client
+}
+
+// newOIDCClient returns the oidcClient described by conf. Providers are only
+// contacted once they are used.
+func newOIDCClient(conf config.OIDCConfig) oidcClient {
+	client := oidcClient{
+		providers:   make(map[string]*oidcProvider, len(conf.Issuers)),
+		redirectURL: conf.RedirectURL,
+		flowTTL:     conf.FlowTTL,
+		http:        &http.Client{Timeout: 10 * time.Second},
+	}
+	for name, issuer := range conf.Issuers {
+		client.providers[name] = &oidcProvider{
+			issuer:       strings.TrimSuffix(issuer, "/"),
+			clientID:     conf.ClientIDs[name],
+			clientSecret: conf.ClientSecrets[name],
+		}
+	}
+	return client
+}
+
+// An oidcProvider is an identity provider along with its discovery document
+// and keys, which are cached once fetched.
+type oidcProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+
+	mu        sync.Mutex
+	meta      *oidcMetadata
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+// oidcMetadata is the part of an OpenID Connect discovery document that is
+// used.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcClaims are the claims of an ID token that are used.
+type oidcClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// metadata returns the discovery document of p, fetching it if needed.
+func (p *oidcProvider) metadata(
+	ctx context.Context,
+	client *http.Client,
+) (oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return *p.meta, nil
+	}
+	var meta oidcMetadata
+	err := getJSON(
+		ctx,
+		client,
+		p.issuer+"/.well-known/openid-configuration",
+		&meta,
+	)
+	if err != nil {
+		return meta, err
+	}
+	// As required by OpenID Connect Discovery section 4.3.
+	if strings.TrimSuffix(meta.Issuer, "/") != p.issuer {
+		return meta, fmt.Errorf(
+			"%w: issuer %q does not match",
+			ErrIdentityProvider,
+			meta.Issuer,
+		)
+	}
+	p.meta = &meta
+	return meta, nil
+}
+
+// key returns the key named id that signs the ID tokens of p. The keys are
+// fetched again if id is not known, at most once every oidcKeysRefresh.
+func (p *oidcProvider) key(
+	ctx context.Context,
+	client *http.Client,
+	id string,
+) (any, error) {
+	meta, err := p.metadata(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[id]; ok {
+		return key, nil
+	}
+	if time.Since(p.fetchedAt) < oidcKeysRefresh {
+		return nil, ErrUnknownKey
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = getJSON(ctx, client, meta.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	p.fetchedAt = time.Now()
+	p.keys = make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if key, err := jwk.publicKey(); err == nil {
+			p.keys[jwk.KeyID] = key
+		}
+	}
+	if key, ok := p.keys[id]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// A jsonWebKey is a public key as published by identity providers, described
+// by RFC 7517 and RFC 7518 section 6.
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// publicKey returns the key described by k.
+func (k jsonWebKey) publicKey() (any, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, ErrInvalidAlgorithm
+	}
+	enc := base64.RawURLEncoding
+	switch {
+	case k.KeyType == "RSA":
+		n, err := enc.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := enc.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return nil, ErrInvalidAlgorithm
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exp.Int64()),
+		}, nil
+	case k.KeyType == "EC" && k.Curve == "P-256":
+		x, err := enc.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := enc.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// Uncompressed point: 0x04 || X || Y.
+		point := append(append([]byte{4}, x...), y...)
+		if _, err = ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, err // Not on the curve.
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case k.KeyType == "OKP" && k.Curve == "Ed25519":
+		x, err := enc.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidAlgorithm
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrInvalidAlgorithm
+}
+
+// authorizationURL returns the URL users are sent to in order to log in at p
+// and grant the code exchanged by exchange. The code is bound to the PKCE
+// verifier and the ID token to nonce.
+func (p *oidcProvider) authorizationURL(
+	meta oidcMetadata,
+	redirectURL, state, nonce, verifier string,
+) (string, error) {
+	link, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := link.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("scope", oidcScopes)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set(
+		"code_challenge",
+		base64.RawURLEncoding.EncodeToString(challenge[:]),
+	)
+	query.Set("code_challenge_method", "S256")
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// exchange redeems code at the token endpoint of p and returns the ID token
+// it is exchanged for.
+func (p *oidcProvider) exchange(
+	ctx context.Context,
+	client *http.Client,
+	redirectURL, code, verifier string,
+) (string, error) {
+	meta, err := p.metadata(ctx, client)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		meta.TokenEndpoint,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// As described in RFC 6749 section 2.3.1.
+	req.SetBasicAuth(
+		url.QueryEscape(p.clientID),
+		url.QueryEscape(p.clientSecret),
+	)
+	var out struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = doJSON(client, req, &out); err != nil {
+		return "", err
+	}
+	if out.IDToken == "" {
+		return "", fmt.Errorf("%w: no id token", ErrIdentityProvider)
+	}
+	return out.IDToken, nil
+}
+
+// verify returns the claims of the ID token s provided that it was signed by
+// p for this service, in response to the request that carried nonce, and has
+// not expired.
+func (p *oidcProvider) verify(
+	ctx context.Context,
+	client *http.Client,
+	s, nonce string,
+) (oidcClaims, error) {
+	meta, err := p.metadata(ctx, client)
+	if err != nil {
+		return oidcClaims{}, err
+	}
+	var claims oidcClaims
+	_, err = jwt.ParseWithClaims(
+		s,
+		&claims,
+		func(token *jwt.Token) (any, error) {
+			id, _ := token.Header["kid"].(string)
+			return p.key(ctx, client, id)
+		},
+		jwt.WithValidMethods(oidcAlgorithms),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return claims, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	if claims.Subject == "" ||
+		subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return claims, ErrInvalidIDToken
+	}
+	// As required by OpenID Connect Core section 3.1.3.7.
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID {
+		return claims, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+// getJSON decodes the JSON document at u into v.
+func getJSON(ctx context.Context, client *http.Client, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return doJSON(client, req, v)
+}
+
+// doJSON sends req and decodes the JSON document it is answered with into v.
+func doJSON(client *http.Client, req *http.Request, v any) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrIdentityProvider, err)
+	}
+	defer res.Body.Close()
+	body := io.LimitReader(res.Body, oidcMaxResponse)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf(
+			"%w: %s responded %s",
+			ErrIdentityProvider,
+			req.URL.Redacted(),
+			res.Status,
+		)
+	}
+	if err = json.NewDecoder(body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %w", ErrIdentityProvider, err)
+	}
+	return nil
+}
+
+// names returns the names of the providers of o in order.
+func (o oidcClient) names() []string {
+	names := make([]string, 0, len(o.providers))
+	for name := range o.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// OIDCProviders returns the names of the identity providers users can log in
+// with.
+func (m UserAuthManager) OIDCProviders() []string {
+	return m.oidc.names()
+}
+
+// StartOIDC starts a login at the identity provider named name and returns
+// the URL the user must be sent to. The state of the login is kept in a
+// cookie that CompleteOIDC requires.
+func (m UserAuthManager) StartOIDC(
+	name string,
+	c *gin.Context,
+) (link string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to start oidc login: %w", err)
+		}
+	}()
+
+	p, ok := m.oidc.providers[name]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+	meta, err := p.metadata(c.Request.Context(), m.oidc.http)
+	if err != nil {
+		return "", err
+	}
+	info := newTokenInfo(0, oidcFlowToken, m.oidc.flowTTL)
+	info.Provider = name
+	for _, v := range []*string{&info.State, &info.Nonce, &info.Verifier} {
+		if *v, err = randomString(32); err != nil {
+			return "", err
+		}
+	}
+	flow, err := m.encodedToken(info)
+	if err != nil {
+		return "", err
+	}
+	if err = m.cookies.set(c, m.cookies.flow, flow, m.oidc.flowTTL); err != nil {
+		return "", err
+	}
+	return p.authorizationURL(
+		meta,
+		m.oidc.redirectURL,
+		info.State,
+		info.Nonce,
+		info.Verifier,
+	)
+}
+
+// CompleteOIDC finishes the login started by StartOIDC on the same client
+// once the identity provider redirects it back with state and code, and
+// returns the user linked to the identity it vouches for, which can then be
+// passed to RegisterSession.
+//
+// Identities that are not linked yet are linked to the user with the same
+// email address if both the provider and the user have verified it, and to a
+// new user otherwise. If the address belongs to a user that can not be linked
+// ErrDuplicateUser is returned. Logins as users that were deleted fail with
+// ErrInvalidCredentials and those locked out by failed attempts with a
+// ThrottleError.
+func (m UserAuthManager) CompleteOIDC(
+	state, code string,
+	c *gin.Context,
+) (user model.User, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to complete oidc login: %w", err)
+		}
+	}()
+
+	s, err := m.cookies.get(c, m.cookies.flow)
+	if err != nil {
+		return user, ErrInvalidOIDCState
+	}
+	// Each login can only be completed once.
+	m.cookies.clear(c, m.cookies.flow)
+	token, err := m.parseToken(s, oidcFlowToken)
+	if err != nil {
+		return user, err
+	}
+	info := token.Info
+	if subtle.ConstantTimeCompare([]byte(state), []byte(info.State)) != 1 {
+		return user, ErrInvalidOIDCState
+	}
+	p, ok := m.oidc.providers[info.Provider]
+	if !ok {
+		return user, ErrUnknownProvider
+	}
+	ctx := c.Request.Context()
+	idToken, err := p.exchange(
+		ctx,
+		m.oidc.http,
+		m.oidc.redirectURL,
+		code,
+		info.Verifier,
+	)
+	if err != nil {
+		return user, err
+	}
+	claims, err := p.verify(ctx, m.oidc.http, idToken, info.Nonce)
+	if err != nil {
+		return user, err
+	}
+	user, err = m.oidcUser(info.Provider, claims, c)
+	if err != nil {
+		return model.User{}, err
+	}
+	if err = m.checkAttempts(c, m.userKey(user.Username)); err != nil {
+		return model.User{}, err
+	}
+	if m.mustVerify && !user.EmailVerified() {
+		return model.User{}, ErrEmailNotVerified
+	}
+	return user, nil
+}
+
+// oidcUser returns the user linked to the identity described by claims at the
+// provider named provider, linking it first if needed as described by
+// CompleteOIDC.
+func (m UserAuthManager) oidcUser(
+	provider string,
+	claims oidcClaims,
+	c *gin.Context,
+) (user model.User, err error) {
+	db := m.db.WithContext(c.Request.Context())
+	var identity model.UserIdentity
+	r := db.Where(
+		"provider = ? AND subject = ?",
+		provider,
+		claims.Subject,
+	).Limit(1).Find(&identity)
+	if r.Error != nil {
+		return user, r.Error
+	}
+	if r.RowsAffected > 0 {
+		r = db.First(&user, identity.UserID)
+		if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+			// The user was deleted, identities are kept so that they
+			// are not linked again.
+			return user, ErrInvalidCredentials
+		}
+		return user, r.Error
+	}
+	if claims.Email == "" {
+		return user, fmt.Errorf("%w: no email", ErrInvalidIDToken)
+	}
+	identity = model.UserIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	r = db.Where("email = ?", claims.Email).Limit(1).Find(&user)
+	if r.Error != nil {
+		return user, r.Error
+	}
+	if r.RowsAffected > 0 {
+		// Otherwise whoever controls the address at either end could take
+		// over the account at the other. Users managed by a directory
+		// must keep logging in through it.
+		if !claims.EmailVerified || !user.EmailVerified() || user.Managed() {
+			return model.User{}, ErrDuplicateUser
+		}
+		identity.UserID = user.ID
+		return user, m.linkIdentity(db, identity)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if user, err = m.oidcNewUser(tx, claims); err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return m.linkIdentity(tx, identity)
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// linkIdentity stores identity. If the identity was linked concurrently
+// ErrDuplicateUser is returned.
+func (m UserAuthManager) linkIdentity(
+	db *gorm.DB,
+	identity model.UserIdentity,
+) error {
+	r := db.Create(&identity)
+	if errors.Is(r.Error, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateUser
+	}
+	return r.Error
+}
+
+// oidcNewUser creates a user without a password for the identity described by
+// claims. Its username is derived from the one at the provider, or from its
+// email address, and made unique if taken.
+func (m UserAuthManager) oidcNewUser(
+	db *gorm.DB,
+	claims oidcClaims,
+) (user model.User, err error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return -1
+		}
+		return r
+	}, base)
+	if len(base) < 4 {
+		base += "user"
+	}
+	// Leaves room for a suffix within the 16 characters of usernames.
+	base = base[:min(len(base), 10)]
+	username := base
+	for i := 0; ; i++ {
+		var count int64
+		// Deleted users keep their usernames.
+		if r := db.Unscoped().Model(&model.User{}).Where(
+			"username = ?",
+			username,
+		).Count(&count); r.Error != nil {
+			return user, r.Error
+		}
+		if count == 0 {
+			break
+		}
+		if i == 5 {
+			return user, ErrDuplicateUser
+		}
+		suffix, err := rand.Int(rand.Reader, big.NewInt(1e6))
+		if err != nil {
+			return user, err
+		}
+		username = fmt.Sprintf("%s%06d", base, suffix)
+	}
+	user = model.User{Username: username, Email: claims.Email}
+	if claims.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	r := db.Create(&user)
+	if errors.Is(r.Error, gorm.ErrDuplicatedKey) {
+		return model.User{}, ErrDuplicateUser
+	}
+	return user, r.Error
+}
@@ -0,0 +1,415 @@
+package provider
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	testClientID     = "client"
+	testClientSecret = "secret"
+	testCode         = "code"
+)
+
+// testIdP is an OpenID Connect identity provider that serves its discovery
+// document, its keys and a token endpoint answering with the ID token of a
+// single user.
+type testIdP struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	nonce     string
+	challenge string
+	// claims are added to the ID tokens issued, overriding the defaults.
+	claims jwt.MapClaims
+	// kid is the key identifier of the ID tokens issued.
+	kid string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testIdP{key: key, kid: "k1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc(
+		"/.well-known/openid-configuration",
+		func(w http.ResponseWriter, _ *http.Request) {
+			writeJSON(w, oidcMetadata{
+				Issuer:                p.srv.URL,
+				AuthorizationEndpoint: p.srv.URL + "/authorize",
+				TokenEndpoint:         p.srv.URL + "/token",
+				JWKSURI:               p.srv.URL + "/jwks",
+			})
+		},
+	)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		enc := base64.RawURLEncoding
+		writeJSON(w, map[string][]jsonWebKey{"keys": {{
+			KeyType: "RSA",
+			KeyID:   "k1",
+			Use:     "sig",
+			N:       enc.EncodeToString(key.N.Bytes()),
+			E:       enc.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+// token redeems the code of the last authorization, provided that the
+// client authenticates and presents its PKCE verifier.
+func (p *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, secret, _ := r.BasicAuth()
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	challenge := base64.RawURLEncoding.EncodeToString(verifier[:])
+	if id != testClientID || secret != testClientSecret ||
+		r.PostFormValue("code") != testCode || challenge != p.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                p.srv.URL,
+		"sub":                "subject",
+		"aud":                testClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Minute).Unix(),
+		"nonce":              p.nonce,
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kid
+	s, err := token.SignedString(p.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"id_token": s, "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// newOIDCTestManager returns a test UserAuthManager that logs users in at p
+// under the name "stub".
+func newOIDCTestManager(
+	t *testing.T,
+	p *testIdP,
+) (UserAuthManager, *gorm.DB) {
+	t.Helper()
+	m, db, _ := newTestManager(t, func(conf *config.Config) {
+		conf.Auth.OIDC = config.OIDCConfig{
+			Issuers:       map[string]string{"stub": p.srv.URL},
+			ClientIDs:     map[string]string{"stub": testClientID},
+			ClientSecrets: map[string]string{"stub": testClientSecret},
+			RedirectURL:   "http://localhost/auth/oidc/callback",
+			FlowTTL:       time.Minute,
+		}
+	})
+	return m, db
+}
+
+// oidcLogin logs in through p, completing the login with state unless empty
+// in which case the one the login was started with is used.
+func oidcLogin(
+	t *testing.T,
+	m UserAuthManager,
+	p *testIdP,
+	state string,
+) (model.User, error) {
+	t.Helper()
+	c, w := newTestContext(http.MethodGet, "/auth/oidc/stub", nil, nil)
+	link, err := m.StartOIDC("stub", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	p.mu.Lock()
+	p.nonce = query.Get("nonce")
+	p.challenge = query.Get("code_challenge")
+	p.mu.Unlock()
+	if state == "" {
+		state = query.Get("state")
+	}
+	c, _ = newTestContext(http.MethodGet, "/auth/oidc/callback", nil, w)
+	return m.CompleteOIDC(state, testCode, c)
+}
+
+func TestCompleteOIDC(t *testing.T) {
+	verified := time.Now()
+	tests := []struct {
+		name   string
+		state  string
+		claims jwt.MapClaims
+		kid    string
+		// existing is created before logging in, unless its username is
+		// empty.
+		existing model.User
+		// linked links the identity to existing beforehand.
+		linked bool
+		err    error
+	}{
+		{
+			name: "new user",
+		},
+		{
+			name:  "wrong state",
+			state: "wrong",
+			err:   ErrInvalidOIDCState,
+		},
+		{
+			name:   "wrong nonce",
+			claims: jwt.MapClaims{"nonce": "wrong"},
+			err:    ErrInvalidIDToken,
+		},
+		{
+			name:   "wrong audience",
+			claims: jwt.MapClaims{"aud": "other"},
+			err:    ErrInvalidIDToken,
+		},
+		{
+			name:   "wrong issuer",
+			claims: jwt.MapClaims{"iss": "https://other.example.com"},
+			err:    ErrInvalidIDToken,
+		},
+		{
+			name: "several audiences authorizing this client",
+			claims: jwt.MapClaims{
+				"aud": []string{testClientID, "other"},
+				"azp": testClientID,
+			},
+		},
+		{
+			name: "several audiences authorizing another client",
+			claims: jwt.MapClaims{
+				"aud": []string{testClientID, "other"},
+				"azp": "other",
+			},
+			err: ErrInvalidIDToken,
+		},
+		{
+			name:   "several audiences without authorized party",
+			claims: jwt.MapClaims{"aud": []string{testClientID, "other"}},
+			err:    ErrInvalidIDToken,
+		},
+		{
+			name: "unknown key",
+			kid:  "k2",
+			err:  ErrInvalidIDToken,
+		},
+		{
+			name: "expired",
+			claims: jwt.MapClaims{
+				"exp": time.Now().Add(-time.Minute).Unix(),
+			},
+			err: ErrInvalidIDToken,
+		},
+		{
+			name: "existing verified email",
+			existing: model.User{
+				Username:        "existing",
+				Email:           "alice@example.com",
+				EmailVerifiedAt: &verified,
+			},
+		},
+		{
+			name:   "existing email unverified by provider",
+			claims: jwt.MapClaims{"email_verified": false},
+			existing: model.User{
+				Username:        "existing",
+				Email:           "alice@example.com",
+				EmailVerifiedAt: &verified,
+			},
+			err: ErrDuplicateUser,
+		},
+		{
+			name: "existing email unverified by user",
+			existing: model.User{
+				Username: "existing",
+				Email:    "alice@example.com",
+			},
+			err: ErrDuplicateUser,
+		},
+		{
+			name: "existing managed user",
+			existing: model.User{
+				Username:        "existing",
+				Email:           "alice@example.com",
+				EmailVerifiedAt: &verified,
+				Directory:       "ldap",
+			},
+			err: ErrDuplicateUser,
+		},
+		{
+			name: "linked unverified user",
+			existing: model.User{
+				Username: "existing",
+				Email:    "bob@example.com",
+			},
+			linked: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestIdP(t)
+			p.claims = tt.claims
+			if tt.kid != "" {
+				p.kid = tt.kid
+			}
+			m, db := newOIDCTestManager(t, p)
+			existing := tt.existing
+			if existing.Username != "" {
+				if err := db.Create(&existing).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.linked {
+				if err := db.Create(&model.UserIdentity{
+					UserID:   existing.ID,
+					Provider: "stub",
+					Subject:  "subject",
+					Email:    existing.Email,
+				}).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			user, err := oidcLogin(t, m, p, tt.state)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if existing.ID != 0 && user.ID != existing.ID {
+				t.Fatalf("got user %d, want %d", user.ID, existing.ID)
+			}
+			if existing.ID == 0 && user.Username != "alice" {
+				t.Fatalf("got username %q, want alice", user.Username)
+			}
+			var count int64
+			if err = db.Model(&model.UserIdentity{}).Where(
+				"user_id = ? AND provider = ? AND subject = ?",
+				user.ID,
+				"stub",
+				"subject",
+			).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != 1 {
+				t.Fatalf("got %d linked identities, want 1", count)
+			}
+			// Later logins find the same user.
+			again, err := oidcLogin(t, m, p, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.ID != user.ID {
+				t.Fatalf("got user %d, want %d", again.ID, user.ID)
+			}
+		})
+	}
+}
+
+func TestCompleteOIDCReusedFlow(t *testing.T) {
+	p := newTestIdP(t)
+	m, _ := newOIDCTestManager(t, p)
+	c, w := newTestContext(http.MethodGet, "/auth/oidc/stub", nil, nil)
+	link, err := m.StartOIDC("stub", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.nonce = u.Query().Get("nonce")
+	p.challenge = u.Query().Get("code_challenge")
+	state := u.Query().Get("state")
+	c, cw := newTestContext(http.MethodGet, "/auth/oidc/callback", nil, w)
+	if _, err = m.CompleteOIDC(state, testCode, c); err != nil {
+		t.Fatal(err)
+	}
+	// The flow cookie is cleared, so only a stolen copy could be replayed.
+	for _, cookie := range cw.Result().Cookies() {
+		if cookie.Name == m.cookies.flow && cookie.MaxAge >= 0 {
+			t.Fatalf("flow cookie %q not cleared", cookie.Name)
+		}
+	}
+	c, _ = newTestContext(http.MethodGet, "/auth/oidc/callback", nil, cw)
+	_, err = m.CompleteOIDC(state, testCode, c)
+	if !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidOIDCState)
+	}
+}
+
+func TestCompleteOIDCDeletedUser(t *testing.T) {
+	p := newTestIdP(t)
+	m, db := newOIDCTestManager(t, p)
+	user, err := oidcLogin(t, m, p, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Delete(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, err = oidcLogin(t, m, p, "")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestCompleteOIDCLockedOut(t *testing.T) {
+	p := newTestIdP(t)
+	m, _ := newOIDCTestManager(t, p)
+	user, err := oidcLogin(t, m, p, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := newTestContext(http.MethodPost, "/auth", nil, nil)
+	for range m.throttle.UserLockoutThreshold {
+		if err = m.failAttempt(c, m.userKey(user.Username)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = oidcLogin(t, m, p, "")
+	var throttleErr ThrottleError
+	if !errors.As(err, &throttleErr) {
+		t.Fatalf("got %v, want a ThrottleError", err)
+	}
+}
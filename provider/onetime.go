@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"gin-gorm-api/model"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A TokenStore persists the one time tokens issued to users so that each can
+// be consumed only once.
+type TokenStore interface {
+	// Create stores the token t. If a token with the same identifier exists
+	// ErrDuplicateToken is returned.
+	Create(c context.Context, t model.OneTimeToken) error
+	// Consume marks the token with identifier id as used and returns it. If
+	// it was already used ErrTokenReused is returned and if it does not
+	// exist or has expired ErrInvalidToken is returned.
+	Consume(c context.Context, id string) (model.OneTimeToken, error)
+	// SetSession records that the token with identifier id was exchanged for
+	// the session with identifier sessionID.
+	SetSession(c context.Context, id, sessionID string) error
+	// RevokeUser discards the unused tokens issued to the user with
+	// identifier userID for purpose.
+	RevokeUser(c context.Context, userID uint, purpose string) error
+}
+
+// DBTokenStore is a TokenStore backed by a database.
+type DBTokenStore struct {
+	db *gorm.DB
+}
+
+// NewDBTokenStore returns a DBTokenStore that uses db for persistence.
+func NewDBTokenStore(db *gorm.DB) DBTokenStore {
+	return DBTokenStore{db}
+}
+
+func (s DBTokenStore) Create(c context.Context, t model.OneTimeToken) error {
+	err := s.db.WithContext(c).Create(&t).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateToken
+	}
+	return err
+}
+
+func (s DBTokenStore) Consume(
+	c context.Context,
+	id string,
+) (model.OneTimeToken, error) {
+	var t model.OneTimeToken
+	db := s.db.WithContext(c)
+	now := time.Now()
+	// The update is conditional so concurrent consumers can not both win.
+	r := db.Model(&model.OneTimeToken{}).Where(
+		"id = ? AND used_at IS NULL AND expires_at > ?",
+		id,
+		now,
+	).Update("used_at", now)
+	if r.Error != nil {
+		return t, r.Error
+	}
+	err := db.First(&t, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return t, ErrInvalidToken
+	}
+	if err != nil {
+		return t, err
+	}
+	if r.RowsAffected == 0 {
+		if t.UsedAt != nil {
+			return t, ErrTokenReused
+		}
+		return t, ErrInvalidToken
+	}
+	return t, nil
+}
+
+func (s DBTokenStore) SetSession(
+	c context.Context,
+	id, sessionID string,
+) error {
+	return s.db.WithContext(c).Model(&model.OneTimeToken{}).Where(
+		"id = ?",
+		id,
+	).Update("session_id", sessionID).Error
+}
+
+func (s DBTokenStore) RevokeUser(
+	c context.Context,
+	userID uint,
+	purpose string,
+) error {
+	return s.db.WithContext(c).Where(
+		"user_id = ? AND purpose = ? AND used_at IS NULL",
+		userID,
+		purpose,
+	).Delete(&model.OneTimeToken{}).Error
+}
+
+// MemoryTokenStore is a TokenStore that keeps tokens in memory. It is meant
+// for testing and single instance deployments.
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]model.OneTimeToken
+}
+
+// NewMemoryTokenStore returns an empty MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]model.OneTimeToken)}
+}
+
+func (s *MemoryTokenStore) Create(
+	_ context.Context,
+	t model.OneTimeToken,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[t.ID]; ok {
+		return ErrDuplicateToken
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	s.tokens[t.ID] = t
+	return nil
+}
+
+func (s *MemoryTokenStore) Consume(
+	_ context.Context,
+	id string,
+) (model.OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return t, ErrInvalidToken
+	}
+	if t.UsedAt != nil {
+		return t, ErrTokenReused
+	}
+	if !t.Usable() {
+		return t, ErrInvalidToken
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	s.tokens[id] = t
+	return t, nil
+}
+
+func (s *MemoryTokenStore) SetSession(
+	_ context.Context,
+	id, sessionID string,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[id]; ok {
+		t.SessionID = sessionID
+		s.tokens[id] = t
+	}
+	return nil
+}
+
+func (s *MemoryTokenStore) RevokeUser(
+	_ context.Context,
+	userID uint,
+	purpose string,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.tokens {
+		if t.UserID == userID && t.Purpose == purpose && t.UsedAt == nil {
+			delete(s.tokens, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testSecret is the base64 encoded 64 byte key tests sign tokens with.
+var testSecret = base64.StdEncoding.EncodeToString(
+	[]byte(strings.Repeat("k", 64)),
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// A testMail is a message sent through a testMailer.
+type testMail struct {
+	addr, subj, msg string
+}
+
+// testMailer is a Mailer that keeps the messages it sends.
+type testMailer struct {
+	mu   sync.Mutex
+	sent []testMail
+}
+
+func (m *testMailer) Send(_ context.Context, addr, subj, msg string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, testMail{addr, subj, msg})
+	return nil
+}
+
+// newTestDB returns a migrated in memory database that is closed once t
+// ends.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would open a database of its own.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err = model.RunMigration(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestManager returns a UserAuthManager backed by an in memory database
+// and stores, along with the database and the mailer it uses. Its
+// configuration holds the defaults updated by configure, if not nil.
+func newTestManager(
+	t *testing.T,
+	configure func(conf *config.Config),
+) (UserAuthManager, *gorm.DB, *testMailer) {
+	t.Helper()
+	conf, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Testing = true
+	conf.Secret = testSecret
+	if configure != nil {
+		configure(&conf)
+	}
+	db := newTestDB(t)
+	mailer := &testMailer{}
+	m, err := NewUserAuthManager(
+		db,
+		mailer,
+		NewStores(db, conf),
+		conf,
+		"user",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, db, mailer
+}
+
+// newTestContext returns the context of a request with method to target
+// carrying body, along with the recorder of its response. The cookies set in
+// the response recorded by prev, if not nil, are sent along unless they were
+// deleted.
+func newTestContext(
+	method, target string,
+	body io.Reader,
+	prev *httptest.ResponseRecorder,
+) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, body)
+	c.Request.Header.Set("Content-Type", "application/json")
+	if prev != nil {
+		for _, cookie := range prev.Result().Cookies() {
+			if cookie.MaxAge >= 0 {
+				c.Request.AddCookie(cookie)
+			}
+		}
+	}
+	return c, w
+}
@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reauthenticate checks the password and, if user has one, the second factor
+// in form and if they are valid records that the session of cred proved its
+// user's identity, allowing it to pass CheckReauthentication for a while.
+// Failures count against the same limits as those of Authenticate. API keys
+// can not reauthenticate.
+func (m UserAuthManager) Reauthenticate(
+	user model.User,
+	cred Credential,
+	form schema.ReauthenticationForm,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to reauthenticate: %w", err)
+		}
+	}()
+
+	if cred.SessionID == "" {
+		return ErrInvalidCredentials
+	}
+	if err = m.checkPassword(user, form.Password, c); err != nil {
+		return err
+	}
+	if user.MFAEnabled() {
+		key := m.userKey(user.Username)
+		db := m.db.WithContext(c.Request.Context())
+		err = m.useSecondFactor(db, user, form.Code)
+		if errors.Is(err, ErrInvalidCredentials) {
+			if failErr := m.failAttempt(c, key); failErr != nil {
+				return failErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return m.stores.Sessions.Reauthenticate(
+		c.Request.Context(),
+		cred.SessionID,
+		time.Now(),
+	)
+}
+
+// CheckReauthentication returns ErrReauthenticationRequired unless the user
+// of cred proved its identity on its session within the reauthentication
+// window, as required before sensitive actions.
+func (m UserAuthManager) CheckReauthentication(cred Credential) error {
+	if time.Since(cred.AuthenticatedAt) > m.reauthTTL {
+		return ErrReauthenticationRequired
+	}
+	return nil
+}
+
+// checkPassword returns ErrInvalidCredentials unless pw is the password of
+// user, as vouched for by the configured authenticators. Failures count
+// against the same limits as those of Authenticate.
+func (m UserAuthManager) checkPassword(
+	user model.User,
+	pw string,
+	c *gin.Context,
+) error {
+	key := m.userKey(user.Username)
+	if err := m.checkAttempts(c, key); err != nil {
+		return err
+	}
+	authenticated, err := m.authenticate(c, user.Username, pw)
+	if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+		return err
+	}
+	if err != nil || authenticated.ID != user.ID {
+		if err := m.failAttempt(c, key); err != nil {
+			return err
+		}
+		return ErrInvalidCredentials
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package provider
+
+import "strings"
+
+// Scopes limit what a credential can be used for.
+const (
+	// ScopeUserRead allows reading user accounts.
+	ScopeUserRead = "user:read"
+	// ScopeUserWrite allows modifying user accounts.
+	ScopeUserWrite = "user:write"
+	// ScopeSessionRead allows listing sessions.
+	ScopeSessionRead = "session:read"
+	// ScopeSessionWrite allows revoking sessions.
+	ScopeSessionWrite = "session:write"
+	// ScopeAPIKeyRead allows listing API keys.
+	ScopeAPIKeyRead = "api_key:read"
+	// ScopeAPIKeyWrite allows creating, modifying and revoking API keys.
+	ScopeAPIKeyWrite = "api_key:write"
+	// ScopeClientRead allows listing OAuth clients.
+	ScopeClientRead = "client:read"
+	// ScopeClientWrite allows registering and revoking OAuth clients.
+	ScopeClientWrite = "client:write"
+	// ScopeAdmin allows using the permissions granted by the user's roles
+	// on administrative endpoints.
+	ScopeAdmin = "admin"
+)
+
+// AllScopes returns every known scope.
+func AllScopes() []string {
+	return []string{
+		ScopeUserRead,
+		ScopeUserWrite,
+		ScopeSessionRead,
+		ScopeSessionWrite,
+		ScopeAPIKeyRead,
+		ScopeAPIKeyWrite,
+		ScopeClientRead,
+		ScopeClientWrite,
+		ScopeAdmin,
+	}
+}
+
+// joinScopes returns the space separated representation of scopes used for
+// storage.
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// splitScopes is the inverse of joinScopes.
+func splitScopes(s string) []string {
+	return strings.Fields(s)
+}
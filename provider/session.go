@@ -0,0 +1,338 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"gin-gorm-api/model"
+	"slices"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A SessionStore persists the server side state of user sessions.
+type SessionStore interface {
+	// Create stores the session s.
+	Create(c context.Context, s model.Session) error
+	// Get returns the session with identifier id.
+	Get(c context.Context, id string) (model.Session, error)
+	// ListUser returns the active sessions of the user with identifier userID
+	// ordered from most to least recently used.
+	ListUser(c context.Context, userID uint) ([]model.Session, error)
+	// Touch records activity on the session with identifier id from the
+	// client with address ip.
+	Touch(c context.Context, id, ip string) error
+	// Reauthenticate records that the user of the session with identifier id
+	// proved its identity at time at.
+	Reauthenticate(c context.Context, id string, at time.Time) error
+	// Revoke marks the session with identifier id as revoked.
+	Revoke(c context.Context, id string) error
+	// RevokeUser marks every session of the user with identifier userID as
+	// revoked.
+	RevokeUser(c context.Context, userID uint) error
+	// RevokeClient marks every session granted to the OAuth client with
+	// identifier clientID as revoked.
+	RevokeClient(c context.Context, clientID string) error
+	// PurgeClient deletes the expired sessions granted to the OAuth client
+	// with identifier clientID.
+	PurgeClient(c context.Context, clientID string) error
+	// Rotate replaces the refresh nonce of the session with identifier id and
+	// extends its expiration to expiresAt. If the current nonce does not match
+	// old then ErrTokenReused is returned and the session is left untouched.
+	Rotate(
+		c context.Context,
+		id, old, nonce string,
+		expiresAt time.Time,
+	) error
+}
+
+// DBSessionStore is a SessionStore backed by a database.
+type DBSessionStore struct {
+	db *gorm.DB
+}
+
+// NewDBSessionStore returns a DBSessionStore that uses db for persistence.
+func NewDBSessionStore(db *gorm.DB) DBSessionStore {
+	return DBSessionStore{db}
+}
+
+func (s DBSessionStore) Create(
+	c context.Context,
+	session model.Session,
+) error {
+	return s.db.WithContext(c).Create(&session).Error
+}
+
+func (s DBSessionStore) Get(
+	c context.Context,
+	id string,
+) (model.Session, error) {
+	var session model.Session
+	r := s.db.WithContext(c).First(&session, "id = ?", id)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return session, ErrSessionNotFound
+	}
+	return session, r.Error
+}
+
+func (s DBSessionStore) ListUser(
+	c context.Context,
+	userID uint,
+) ([]model.Session, error) {
+	var sessions []model.Session
+	r := s.db.WithContext(c).Where(
+		"user_id = ? AND revoked_at IS NULL AND expires_at > ?",
+		userID,
+		time.Now(),
+	).Order("last_seen_at DESC").Find(&sessions)
+	return sessions, r.Error
+}
+
+func (s DBSessionStore) Touch(c context.Context, id, ip string) error {
+	return s.db.WithContext(c).Model(&model.Session{}).Where(
+		"id = ?",
+		id,
+	).Updates(map[string]any{"last_seen_at": time.Now(), "ip": ip}).Error
+}
+
+func (s DBSessionStore) Reauthenticate(
+	c context.Context,
+	id string,
+	at time.Time,
+) error {
+	r := s.db.WithContext(c).Model(&model.Session{}).Where(
+		"id = ? AND revoked_at IS NULL",
+		id,
+	).Update("authenticated_at", at)
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.RowsAffected == 0 {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func (s DBSessionStore) Revoke(c context.Context, id string) error {
+	return s.db.WithContext(c).Model(&model.Session{}).Where(
+		"id = ? AND revoked_at IS NULL",
+		id,
+	).Update("revoked_at", time.Now()).Error
+}
+
+func (s DBSessionStore) RevokeUser(c context.Context, userID uint) error {
+	return s.db.WithContext(c).Model(&model.Session{}).Where(
+		"user_id = ? AND revoked_at IS NULL",
+		userID,
+	).Update("revoked_at", time.Now()).Error
+}
+
+func (s DBSessionStore) RevokeClient(
+	c context.Context,
+	clientID string,
+) error {
+	return s.db.WithContext(c).Model(&model.Session{}).Where(
+		"client_id = ? AND revoked_at IS NULL",
+		clientID,
+	).Update("revoked_at", time.Now()).Error
+}
+
+func (s DBSessionStore) PurgeClient(
+	c context.Context,
+	clientID string,
+) error {
+	return s.db.WithContext(c).Where(
+		"client_id = ? AND expires_at <= ?",
+		clientID,
+		time.Now(),
+	).Delete(&model.Session{}).Error
+}
+
+func (s DBSessionStore) Rotate(
+	c context.Context,
+	id, old, nonce string,
+	expiresAt time.Time,
+) error {
+	r := s.db.WithContext(c).Model(&model.Session{}).Where(
+		"id = ? AND refresh_nonce = ? AND revoked_at IS NULL",
+		id,
+		old,
+	).Updates(map[string]any{
+		"refresh_nonce": nonce,
+		"expires_at":    expiresAt,
+		"last_seen_at":  time.Now(),
+	})
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.RowsAffected == 0 {
+		return ErrTokenReused
+	}
+	return nil
+}
+
+// MemorySessionStore is a SessionStore that keeps sessions in memory. It is
+// meant for testing and single instance deployments.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]model.Session
+}
+
+// NewMemorySessionStore returns an empty MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]model.Session)}
+}
+
+func (s *MemorySessionStore) Create(
+	_ context.Context,
+	session model.Session,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[session.ID]; ok {
+		return ErrDuplicateSession
+	}
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *MemorySessionStore) Get(
+	_ context.Context,
+	id string,
+) (model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return session, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *MemorySessionStore) ListUser(
+	_ context.Context,
+	userID uint,
+) ([]model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessions []model.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.Active() {
+			sessions = append(sessions, session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b model.Session) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) Touch(_ context.Context, id, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	session.LastSeenAt = time.Now()
+	session.IP = ip
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *MemorySessionStore) Reauthenticate(
+	_ context.Context,
+	id string,
+	at time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || session.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+	session.AuthenticatedAt = &at
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *MemorySessionStore) Revoke(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || !session.Active() {
+		return nil
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *MemorySessionStore) RevokeUser(_ context.Context, userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, session := range s.sessions {
+		if session.UserID != userID || !session.Active() {
+			continue
+		}
+		session.RevokedAt = &now
+		s.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) RevokeClient(
+	_ context.Context,
+	clientID string,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, session := range s.sessions {
+		if session.ClientID != clientID || !session.Active() {
+			continue
+		}
+		session.RevokedAt = &now
+		s.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) PurgeClient(
+	_ context.Context,
+	clientID string,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, session := range s.sessions {
+		if session.ClientID == clientID && !now.Before(session.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) Rotate(
+	_ context.Context,
+	id, old, nonce string,
+	expiresAt time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if session.RefreshNonce != old || session.RevokedAt != nil {
+		return ErrTokenReused
+	}
+	session.RefreshNonce = nonce
+	session.ExpiresAt = expiresAt
+	session.LastSeenAt = time.Now()
+	s.sessions[id] = session
+	return nil
+}
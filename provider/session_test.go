@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"errors"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"net/http"
+	"testing"
+)
+
+func TestRefreshBearerSessionReuse(t *testing.T) {
+	stores := map[string]bool{"memory": true, "database": false}
+	for name, inMemory := range stores {
+		t.Run(name, func(t *testing.T) {
+			m, db, _ := newTestManager(t, func(conf *config.Config) {
+				conf.Testing = inMemory
+			})
+			user := model.User{Username: "alice", Email: "alice@example.com"}
+			if err := db.Create(&user).Error; err != nil {
+				t.Fatal(err)
+			}
+			c, _ := newTestContext(http.MethodPost, "/auth/token", nil, nil)
+			tokens, err := m.RegisterBearerSession(user, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			form := schema.RefreshForm{RefreshToken: tokens.Refresh}
+			c, _ = newTestContext(http.MethodPost, "/auth/token/refresh", nil, nil)
+			rotated, err := m.RefreshBearerSession(form, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rotated.Refresh == tokens.Refresh {
+				t.Fatal("refresh token not rotated")
+			}
+			c, _ = newTestContext(http.MethodPost, "/auth/token/refresh", nil, nil)
+			_, err = m.RefreshBearerSession(form, c)
+			if !errors.Is(err, ErrTokenReused) {
+				t.Fatalf("got %v, want %v", err, ErrTokenReused)
+			}
+			session, err := m.stores.Sessions.Get(
+				c.Request.Context(),
+				tokens.sessionID,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.RevokedAt == nil {
+				t.Fatal("session not revoked")
+			}
+			// The reuse may be the legitimate client's, so the tokens issued
+			// by the refresh are revoked along with the session.
+			c, _ = newTestContext(http.MethodPost, "/auth/token/refresh", nil, nil)
+			_, err = m.RefreshBearerSession(
+				schema.RefreshForm{RefreshToken: rotated.Refresh},
+				c,
+			)
+			if !errors.Is(err, ErrSessionRevoked) {
+				t.Fatalf("got %v, want %v", err, ErrSessionRevoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"gin-gorm-api/config"
+
+	"gorm.io/gorm"
+)
+
+// Stores groups the persistence backends used by a UserAuthManager.
+type Stores struct {
+	Sessions SessionStore
+	Attempts AttemptStore
+	Tokens   TokenStore
+}
+
+// NewStores returns the Stores specified by config. Database backed stores
+// are used unless config.Testing is set, in which case they are kept in
+// memory.
+func NewStores(db *gorm.DB, config config.Config) Stores {
+	if config.Testing {
+		return Stores{
+			Sessions: NewMemorySessionStore(),
+			Attempts: NewMemoryAttemptStore(),
+			Tokens:   NewMemoryTokenStore(),
+		}
+	}
+	return Stores{
+		Sessions: NewDBSessionStore(db),
+		Attempts: NewDBAttemptStore(db),
+		Tokens:   NewDBTokenStore(db),
+	}
+}
@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"fmt"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// An attemptKey identifies who failed attempts are counted against along with
+// how many failures they are allowed.
+type attemptKey struct {
+	key          string
+	backoffAfter int
+	threshold    int
+}
+
+// loginKeys returns the keys that attempts to log in as username from the
+// client of c count against.
+func (m UserAuthManager) loginKeys(
+	username string,
+	c *gin.Context,
+) []attemptKey {
+	return []attemptKey{
+		m.userKey(username),
+		{
+			key:          "ip:" + c.ClientIP(),
+			backoffAfter: m.throttle.IPBackoffAfter,
+			threshold:    m.throttle.IPLockoutThreshold,
+		},
+	}
+}
+
+// userKey returns the key that attempts to log in as username count against.
+func (m UserAuthManager) userKey(username string) attemptKey {
+	return attemptKey{
+		key:          "user:" + username,
+		backoffAfter: m.throttle.UserBackoffAfter,
+		threshold:    m.throttle.UserLockoutThreshold,
+	}
+}
+
+// mailKeys returns the keys that requests for emails sent to addr from the
+// client of c count against.
+func (m UserAuthManager) mailKeys(addr string, c *gin.Context) []attemptKey {
+	return []attemptKey{
+		{
+			key:          "mail:" + strings.ToLower(addr),
+			backoffAfter: m.throttle.MailBackoffAfter,
+			threshold:    m.throttle.MailLockoutThreshold,
+		},
+		{
+			key:          "mail-ip:" + c.ClientIP(),
+			backoffAfter: m.throttle.IPBackoffAfter,
+			threshold:    m.throttle.IPLockoutThreshold,
+		},
+	}
+}
+
+// throttleMail returns a ThrottleError if requests for emails sent to addr
+// from the client of c are blocked and otherwise counts this one. Every
+// request is counted whether or not addr belongs to a user so that the limits
+// do not disclose it.
+func (m UserAuthManager) throttleMail(addr string, c *gin.Context) error {
+	keys := m.mailKeys(addr, c)
+	if err := m.checkAttempts(c, keys...); err != nil {
+		return err
+	}
+	return m.failAttempt(c, keys...)
+}
+
+// checkAttempts returns a ThrottleError if attempts under any of keys are
+// blocked.
+func (m UserAuthManager) checkAttempts(
+	c *gin.Context,
+	keys ...attemptKey,
+) error {
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, k := range keys {
+		attempt, err := m.stores.Attempts.Get(c.Request.Context(), k.key)
+		if err != nil {
+			return fmt.Errorf("failed to check attempts: %w", err)
+		}
+		if attempt.Locked(now) {
+			retryAfter = max(retryAfter, attempt.LockedUntil.Sub(now))
+		}
+	}
+	if retryAfter > 0 {
+		return ThrottleError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// failAttempt records a failed attempt under each of keys and blocks further
+// attempts under those that went past their limits.
+func (m UserAuthManager) failAttempt(
+	c *gin.Context,
+	keys ...attemptKey,
+) error {
+	ctx := c.Request.Context()
+	for _, k := range keys {
+		attempt, err := m.stores.Attempts.Fail(ctx, k.key, m.throttle.Window)
+		if err != nil {
+			return fmt.Errorf("failed to record attempt: %w", err)
+		}
+		delay := lockDuration(m.throttle, k, attempt.Failures)
+		if delay == 0 {
+			continue
+		}
+		err = m.stores.Attempts.Lock(ctx, k.key, time.Now().Add(delay))
+		if err != nil {
+			return fmt.Errorf("failed to record attempt: %w", err)
+		}
+	}
+	return nil
+}
+
+// lockDuration returns for how long attempts under k are blocked after the
+// given number of failures.
+func lockDuration(
+	conf config.ThrottleConfig,
+	k attemptKey,
+	failures int,
+) time.Duration {
+	if k.threshold > 0 && failures >= k.threshold {
+		return conf.LockoutDuration
+	}
+	if failures <= k.backoffAfter {
+		return 0
+	}
+	delay := conf.BackoffBase
+	for i := k.backoffAfter + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= conf.LockoutDuration {
+			return conf.LockoutDuration
+		}
+	}
+	return delay
+}
+
+// UnlockUser forgets the failed login attempts made as user, lifting any
+// lockout on them.
+func (m UserAuthManager) UnlockUser(user model.User, c *gin.Context) error {
+	err := m.stores.Attempts.Reset(
+		c.Request.Context(),
+		m.userKey(user.Username).key,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to unlock user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package provider
+
+import (
+	"errors"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// testThrottle is the throttling configuration of the tests.
+var testThrottle = config.ThrottleConfig{
+	Window:               time.Hour,
+	BackoffBase:          time.Second,
+	LockoutDuration:      time.Minute,
+	UserBackoffAfter:     3,
+	UserLockoutThreshold: 10,
+	IPBackoffAfter:       20,
+	IPLockoutThreshold:   100,
+}
+
+// newThrottleTestManager returns a test UserAuthManager throttling logins as
+// configured by testThrottle.
+func newThrottleTestManager(t *testing.T) UserAuthManager {
+	t.Helper()
+	m, _, _ := newTestManager(t, func(conf *config.Config) {
+		conf.Auth.Throttle = testThrottle
+	})
+	return m
+}
+
+func TestLockDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		failures  int
+		delay     time.Duration
+	}{
+		{name: "no failures", threshold: 10},
+		{name: "up to backoff", threshold: 10, failures: 3},
+		{name: "first backoff", threshold: 10, failures: 4, delay: time.Second},
+		{
+			name:      "doubled backoff",
+			threshold: 10,
+			failures:  6,
+			delay:     4 * time.Second,
+		},
+		{
+			name:      "longest backoff",
+			threshold: 10,
+			failures:  9,
+			delay:     32 * time.Second,
+		},
+		{
+			name:      "lockout threshold",
+			threshold: 10,
+			failures:  10,
+			delay:     time.Minute,
+		},
+		{
+			name:      "past lockout threshold",
+			threshold: 10,
+			failures:  25,
+			delay:     time.Minute,
+		},
+		{
+			name:     "backoff capped without threshold",
+			failures: 12,
+			delay:    time.Minute,
+		},
+		{
+			name:     "backoff below cap without threshold",
+			failures: 8,
+			delay:    16 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := attemptKey{
+				key:          "user:alice",
+				backoffAfter: 3,
+				threshold:    tt.threshold,
+			}
+			delay := lockDuration(testThrottle, k, tt.failures)
+			if delay != tt.delay {
+				t.Fatalf("got %s, want %s", delay, tt.delay)
+			}
+		})
+	}
+}
+
+func TestFailAttempt(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		// retryAfter is the longest wait expected, none if zero.
+		retryAfter time.Duration
+	}{
+		{name: "below backoff", failures: 3},
+		{name: "backoff", failures: 4, retryAfter: time.Second},
+		{name: "longer backoff", failures: 7, retryAfter: 8 * time.Second},
+		{name: "lockout", failures: 10, retryAfter: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newThrottleTestManager(t)
+			c, _ := newTestContext(http.MethodPost, "/auth", nil, nil)
+			key := m.userKey("alice")
+			for range tt.failures {
+				if err := m.failAttempt(c, key); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := m.checkAttempts(c, key)
+			if tt.retryAfter == 0 {
+				if err != nil {
+					t.Fatalf("got %v, want no error", err)
+				}
+				return
+			}
+			var throttleErr ThrottleError
+			if !errors.As(err, &throttleErr) {
+				t.Fatalf("got %v, want a ThrottleError", err)
+			}
+			if throttleErr.RetryAfter > tt.retryAfter ||
+				throttleErr.RetryAfter < tt.retryAfter-time.Second {
+				t.Fatalf(
+					"got retry after %s, want about %s",
+					throttleErr.RetryAfter,
+					tt.retryAfter,
+				)
+			}
+			// Other keys are not affected.
+			if err = m.checkAttempts(c, m.userKey("bob")); err != nil {
+				t.Fatalf("got %v, want no error", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateThrottled(t *testing.T) {
+	m, db, _ := newTestManager(t, func(conf *config.Config) {
+		conf.Auth.Throttle = testThrottle
+	})
+	user := model.User{Username: "alice", Email: "alice@example.com"}
+	if err := user.SetPassword("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	login := func(password string) error {
+		c, _ := newTestContext(http.MethodPost, "/auth", nil, nil)
+		_, err := m.Authenticate(
+			schema.LoginForm{Username: "alice", Password: password},
+			c,
+		)
+		return err
+	}
+	for range testThrottle.UserBackoffAfter {
+		if err := login("wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("got %v, want %v", err, ErrInvalidCredentials)
+		}
+	}
+	// The next failure starts backing off, even the right password.
+	if err := login("wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidCredentials)
+	}
+	var throttleErr ThrottleError
+	if err := login("correct horse"); !errors.As(err, &throttleErr) {
+		t.Fatalf("got %v, want a ThrottleError", err)
+	}
+	// Unlocking the user lifts the block and forgets its failures.
+	c, _ := newTestContext(http.MethodDelete, "/admin", nil, nil)
+	if err := m.UnlockUser(user, c); err != nil {
+		t.Fatal(err)
+	}
+	attempt, err := m.stores.Attempts.Get(
+		c.Request.Context(),
+		m.userKey(user.Username).key,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Failures != 0 {
+		t.Fatalf("got %d failures, want 0", attempt.Failures)
+	}
+	if err = login("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	m := newThrottleTestManager(t)
+	c, _ := newTestContext(http.MethodPost, "/auth", nil, nil)
+	user := model.User{Username: "alice"}
+	keys := m.loginKeys(user.Username, c)
+	for range testThrottle.UserLockoutThreshold {
+		if err := m.failAttempt(c, keys...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var throttleErr ThrottleError
+	if err := m.checkAttempts(c, keys[0]); !errors.As(err, &throttleErr) {
+		t.Fatalf("got %v, want a ThrottleError", err)
+	}
+	if err := m.UnlockUser(user, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.checkAttempts(c, keys[0]); err != nil {
+		t.Fatalf("got %v, want no error", err)
+	}
+	// The client address keeps its failures.
+	attempt, err := m.stores.Attempts.Get(c.Request.Context(), keys[1].key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Failures != testThrottle.UserLockoutThreshold {
+		t.Fatalf(
+			"got %d address failures, want %d",
+			attempt.Failures,
+			testThrottle.UserLockoutThreshold,
+		)
+	}
+}
@@ -0,0 +1,354 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // Required by RFC 6238 and authenticator apps.
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TOTP parameters as recommended by RFC 6238 and supported by most
+// authenticator apps.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is the number of time steps a code is accepted before and
+	// after its own to account for clock drift.
+	totpSkew          = 1
+	totpSecretSize    = 20
+	recoveryCodeCount = 10
+	mfaTokenTTL       = 5 * time.Minute
+)
+
+// TOTPEnrollment holds the information needed to add a TOTP secret to an
+// authenticator app.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// EnrollTOTP generates and stores a new TOTP secret for user. The secret is
+// not used for authentication until confirmed through ConfirmTOTP.
+func (m UserAuthManager) EnrollTOTP(
+	user model.User,
+	c *gin.Context,
+) (enrollment TOTPEnrollment, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to enroll totp: %w", err)
+		}
+	}()
+
+	if user.MFAEnabled() {
+		return enrollment, ErrMFAEnabled
+	}
+	secret := make([]byte, totpSecretSize)
+	if _, err = rand.Read(secret); err != nil {
+		return enrollment, err
+	}
+	if r := m.db.WithContext(c.Request.Context()).Model(&user).Updates(
+		map[string]any{"totp_secret": secret, "totp_last_step": 0},
+	); r.Error != nil {
+		return enrollment, r.Error
+	}
+	encSecret := base32.StdEncoding.WithPadding(base32.NoPadding).
+		EncodeToString(secret)
+	label := url.PathEscape(m.totpIssuer + ":" + user.Username)
+	query := url.Values{
+		"secret":    {encSecret},
+		"issuer":    {m.totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {strconv.Itoa(totpDigits)},
+		"period":    {strconv.Itoa(totpPeriod)},
+	}
+	return TOTPEnrollment{
+		Secret: encSecret,
+		URI:    "otpauth://totp/" + label + "?" + query.Encode(),
+	}, nil
+}
+
+// ConfirmTOTP enables the TOTP secret of user provided that form holds a
+// valid code for it and returns a new set of recovery codes. The codes are
+// stored hashed so they can not be recovered afterwards.
+func (m UserAuthManager) ConfirmTOTP(
+	user model.User,
+	form schema.TOTPCodeForm,
+	c *gin.Context,
+) (codes []string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to confirm totp: %w", err)
+		}
+	}()
+
+	if user.MFAEnabled() {
+		return nil, ErrMFAEnabled
+	}
+	if len(user.TOTPSecret) == 0 {
+		return nil, ErrMFANotEnrolled
+	}
+	db := m.db.WithContext(c.Request.Context())
+	if err = m.useTOTPCode(db, user, form.Code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if r := tx.Where("user_id = ?", user.ID).Delete(
+			&model.RecoveryCode{},
+		); r.Error != nil {
+			return r.Error
+		}
+		for _, hash := range hashes {
+			if r := tx.Create(&model.RecoveryCode{
+				UserID: user.ID,
+				Hash:   hash,
+			}); r.Error != nil {
+				return r.Error
+			}
+		}
+		return tx.Model(&user).Update("totp_enabled_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP removes the TOTP secret and recovery codes of user provided that
+// form holds a valid TOTP or recovery code.
+func (m UserAuthManager) DisableTOTP(
+	user model.User,
+	form schema.TOTPCodeForm,
+	c *gin.Context,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to disable totp: %w", err)
+		}
+	}()
+
+	if !user.MFAEnabled() {
+		return ErrMFANotEnrolled
+	}
+	db := m.db.WithContext(c.Request.Context())
+	if err = m.useSecondFactor(db, user, form.Code); err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if r := tx.Where("user_id = ?", user.ID).Delete(
+			&model.RecoveryCode{},
+		); r.Error != nil {
+			return r.Error
+		}
+		return tx.Model(&user).Updates(map[string]any{
+			"totp_secret":     nil,
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error
+	})
+}
+
+// RequestMFA returns a short lived single use token that can be exchanged,
+// along with a valid second factor, for a session of user through
+// CompleteMFA. It is meant to be issued after user passes Authenticate.
+func (m UserAuthManager) RequestMFA(user model.User) (string, error) {
+	token, err := m.statelessToken(newTokenInfo(user.ID, mfaToken, mfaTokenTTL))
+	if err != nil {
+		return "", fmt.Errorf("failed to request mfa: %w", err)
+	}
+	return token, nil
+}
+
+// CompleteMFA validates the token and second factor in form and if they are
+// valid returns the corresponding user, which can then be passed to
+// RegisterSession. The second factor may be a TOTP or a recovery code.
+// Failures count against the same limits as those of Authenticate. The token
+// is only used up once the second factor passes, after which it fails with
+// ErrTokenReused.
+func (m UserAuthManager) CompleteMFA(
+	form schema.MFAForm,
+	c *gin.Context,
+) (user model.User, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to complete mfa: %w", err)
+		}
+	}()
+
+	token, err := m.parseToken(form.Token, mfaToken)
+	if err != nil {
+		return user, err
+	}
+	db := m.db.WithContext(c.Request.Context())
+	if r := db.First(&user, token.Info.UserID); r.Error != nil {
+		return user, r.Error
+	}
+	if !user.MFAEnabled() {
+		return user, ErrMFANotEnrolled
+	}
+	key := m.userKey(user.Username)
+	if err = m.checkAttempts(c, key); err != nil {
+		return model.User{}, err
+	}
+	if err = m.useSecondFactor(db, user, form.Code); err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			if failErr := m.failAttempt(c, key); failErr != nil {
+				return model.User{}, failErr
+			}
+		}
+		return model.User{}, err
+	}
+	if err = m.consumeStatelessToken(token, c); err != nil {
+		return model.User{}, err
+	}
+	if err = m.stores.Attempts.Reset(c.Request.Context(), key.key); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// useSecondFactor consumes code as a TOTP code of user if it is made of
+// digits and as a recovery code otherwise.
+func (m UserAuthManager) useSecondFactor(
+	db *gorm.DB,
+	user model.User,
+	code string,
+) error {
+	if isTOTPCode(code) {
+		return m.useTOTPCode(db, user, code)
+	}
+	return m.useRecoveryCode(db, user, code)
+}
+
+// useTOTPCode validates code against the TOTP secret of user and marks its
+// time step as used so it can not be replayed.
+func (m UserAuthManager) useTOTPCode(
+	db *gorm.DB,
+	user model.User,
+	code string,
+) error {
+	step, ok := validTOTPCode(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return ErrInvalidCredentials
+	}
+	r := db.Model(&model.User{}).Where(
+		"id = ? AND totp_last_step < ?",
+		user.ID,
+		step,
+	).Update("totp_last_step", step)
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.RowsAffected == 0 {
+		return ErrInvalidCredentials // Used concurrently by another request.
+	}
+	return nil
+}
+
+// useRecoveryCode marks the unused recovery code of user matching code as
+// used.
+func (m UserAuthManager) useRecoveryCode(
+	db *gorm.DB,
+	user model.User,
+	code string,
+) error {
+	hash := hashRecoveryCode(code)
+	r := db.Model(&model.RecoveryCode{}).Where(
+		"user_id = ? AND hash = ? AND used_at IS NULL",
+		user.ID,
+		hash,
+	).Update("used_at", time.Now())
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.RowsAffected == 0 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// totpCode returns the TOTP code of secret for the given time step as
+// described in RFC 4226 section 5.
+func totpCode(secret []byte, step int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step)) //nolint:gosec // Positive.
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// validTOTPCode returns the time step of code and true if code is a valid
+// TOTP code of secret at time t.
+func validTOTPCode(secret []byte, code string, t time.Time) (int64, bool) {
+	if len(secret) == 0 || !isTOTPCode(code) {
+		return 0, false
+	}
+	current := t.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare(
+			[]byte(totpCode(secret, step)),
+			[]byte(code),
+		) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// isTOTPCode returns true if and only if code has the shape of a TOTP code.
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecoveryCodes returns a new set of recovery codes along with their
+// hashes.
+func newRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(enc.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode returns the hash of code ignoring case and dashes.
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"encoding/base32"
+	"errors"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newMFATestUser returns a user with a confirmed TOTP secret, along with the
+// secret, the user's recovery codes and the TOTP time step used up by the
+// confirmation.
+func newMFATestUser(
+	t *testing.T,
+	m UserAuthManager,
+	db *gorm.DB,
+) (model.User, []byte, []string, int64) {
+	t.Helper()
+	user := model.User{Username: "alice", Email: "alice@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	c, _ := newTestContext(http.MethodPost, "/auth/totp", nil, nil)
+	enrollment, err := m.EnrollTOTP(user, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).
+		DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	step := time.Now().Unix() / totpPeriod
+	codes, err := m.ConfirmTOTP(
+		user,
+		schema.TOTPCodeForm{Code: totpCode(secret, step)},
+		c,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user, secret, codes, step
+}
+
+// completeTestMFA completes a second factor check of user with code, using
+// token if not empty and a new one otherwise.
+func completeTestMFA(
+	t *testing.T,
+	m UserAuthManager,
+	user model.User,
+	token, code string,
+) error {
+	t.Helper()
+	if token == "" {
+		var err error
+		if token, err = m.RequestMFA(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, _ := newTestContext(http.MethodPost, "/auth/mfa", nil, nil)
+	_, err := m.CompleteMFA(schema.MFAForm{Token: token, Code: code}, c)
+	return err
+}
+
+func TestCompleteMFATOTPReplay(t *testing.T) {
+	m, db, _ := newTestManager(t, nil)
+	user, secret, _, step := newMFATestUser(t, m, db)
+	// The steps, relative to the one used by the confirmation, are checked in
+	// order. Those out of range stay so if the clock moves on a step.
+	tests := []struct {
+		name string
+		step int64
+		err  error
+	}{
+		{name: "step used by confirmation", err: ErrInvalidCredentials},
+		{name: "earlier step", step: -1, err: ErrInvalidCredentials},
+		{name: "next step", step: 1},
+		{name: "next step replayed", step: 1, err: ErrInvalidCredentials},
+		{name: "step out of range", step: 3, err: ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		code := totpCode(secret, step+tt.step)
+		err := completeTestMFA(t, m, user, "", code)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestCompleteMFARecoveryCode(t *testing.T) {
+	m, db, _ := newTestManager(t, nil)
+	user, _, codes, _ := newMFATestUser(t, m, db)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	if err := completeTestMFA(t, m, user, "", codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	err := completeTestMFA(t, m, user, "", codes[0])
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidCredentials)
+	}
+	// Codes are compared ignoring case and dashes.
+	code := strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))
+	if err = completeTestMFA(t, m, user, "", code); err != nil {
+		t.Fatal(err)
+	}
+	var unused int64
+	if err = db.Model(&model.RecoveryCode{}).Where(
+		"user_id = ? AND used_at IS NULL",
+		user.ID,
+	).Count(&unused).Error; err != nil {
+		t.Fatal(err)
+	}
+	if unused != recoveryCodeCount-2 {
+		t.Fatalf("got %d unused codes, want %d", unused, recoveryCodeCount-2)
+	}
+}
+
+func TestCompleteMFAReusedToken(t *testing.T) {
+	m, db, _ := newTestManager(t, nil)
+	user, _, codes, _ := newMFATestUser(t, m, db)
+	token, err := m.RequestMFA(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A wrong second factor leaves the token usable.
+	err = completeTestMFA(t, m, user, token, "wrong-code")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidCredentials)
+	}
+	if err = completeTestMFA(t, m, user, token, codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	err = completeTestMFA(t, m, user, token, codes[1])
+	if !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("got %v, want %v", err, ErrTokenReused)
+	}
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A Transport is a mean by which a client sends its credentials.
+type Transport uint8
+
+const (
+	_ Transport = iota
+	// CookieTransport sends credentials in a cookie.
+	CookieTransport
+	// BearerTransport sends credentials in the authorization header.
+	BearerTransport
+)
+
+// SessionTokens holds the encoded tokens of a session.
+type SessionTokens struct {
+	Access    string
+	Refresh   string
+	ExpiresIn time.Duration
+	Scopes    []string
+	sessionID string
+}
+
+// parseTransports returns the transports named in names.
+func parseTransports(names []string) ([]Transport, error) {
+	transports := make([]Transport, len(names))
+	for i, name := range names {
+		switch strings.TrimSpace(name) {
+		case "cookie":
+			transports[i] = CookieTransport
+		case "bearer":
+			transports[i] = BearerTransport
+		default:
+			return nil, fmt.Errorf("%w '%s'", ErrInvalidTransport, name)
+		}
+	}
+	return transports, nil
+}
+
+// requestToken returns the encoded token sent by the client of c and the
+// transport used to send it. The authorization header takes precedence over
+// the session cookie.
+func (m UserAuthManager) requestToken(
+	c *gin.Context,
+) (string, Transport, error) {
+	if m.bearerAuth {
+		header := c.GetHeader("Authorization")
+		if s, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(s), BearerTransport, nil
+		}
+	}
+	if !m.cookieAuth {
+		return "", 0, ErrMissingCredentials
+	}
+	s, err := m.cookies.get(c, m.cookies.session)
+	if err != nil {
+		return "", 0, err
+	}
+	return s, CookieTransport, nil
+}
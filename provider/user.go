@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HidesUsers returns true if and only if m does not disclose whether users
+// exist.
+func (m UserAuthManager) HidesUsers() bool {
+	return m.hideUsers
+}
+
+// Register creates the user described by form and sends it an email
+// verification message. If its username or email address is already in use
+// ErrDuplicateUser is returned, unless users are hidden in which case the
+// owner of the email address is notified instead and an empty user is
+// returned. Messages that fail to be sent are not reported as errors either
+// way, so that a mail outage does not disclose duplicates.
+func (m UserAuthManager) Register(
+	form schema.NewUserForm,
+	c *gin.Context,
+) (user model.User, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to register user: %w", err)
+		}
+	}()
+
+	user = model.User{Username: form.Username, Email: form.Email}
+	// Hashing first keeps duplicates from answering any faster.
+	if err = user.SetPassword(form.Password); err != nil {
+		return model.User{}, err
+	}
+	ctx := c.Request.Context()
+	var existing model.User
+	r := m.db.WithContext(ctx).Where(
+		"username = ? OR email = ?",
+		form.Username,
+		form.Email,
+	).Limit(1).Find(&existing)
+	if r.Error != nil {
+		return model.User{}, r.Error
+	}
+	duplicate := r.RowsAffected > 0
+	if !duplicate {
+		// A concurrent sign up can still win the race.
+		r = m.db.WithContext(ctx).Create(&user)
+		duplicate = errors.Is(r.Error, gorm.ErrDuplicatedKey)
+		if r.Error != nil && !duplicate {
+			return model.User{}, r.Error
+		}
+	}
+	if duplicate {
+		if !m.hideUsers {
+			return model.User{}, ErrDuplicateUser
+		}
+		if err := m.notifyDuplicate(form, c); err != nil {
+			_ = c.Error(err)
+		}
+		return model.User{}, nil
+	}
+	if err := m.SendEmailVerification(user, c); err != nil {
+		// The user exists regardless and can ask for the message again.
+		_ = c.Error(err)
+	}
+	return user, nil
+}
+
+// notifyDuplicate tells the owner of the email address in form that it was
+// used to sign up again. If no user has the address its owner gets the same
+// email verification message as a new user would, whose token verifies
+// nothing, so that whether the username is taken is not disclosed either.
+func (m UserAuthManager) notifyDuplicate(
+	form schema.NewUserForm,
+	c *gin.Context,
+) error {
+	ctx := c.Request.Context()
+	var count int64
+	if r := m.db.WithContext(ctx).Model(&model.User{}).Where(
+		"email = ?",
+		form.Email,
+	).Count(&count); r.Error != nil {
+		return r.Error
+	}
+	if count == 0 {
+		return m.SendEmailVerification(model.User{Email: form.Email}, c)
+	}
+	return m.msm.Send(
+		ctx,
+		form.Email,
+		"Sign up attempt",
+		"Someone tried to sign up with this address, which already has "+
+			"an account. If it was you, log in or reset your password.",
+	)
+}
@@ -0,0 +1,15 @@
+package provider
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// randomString returns a url safe encoding of n random bytes.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,665 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Flags of authenticator data.
+const (
+	authDataUserPresent  = 0x01
+	authDataUserVerified = 0x04
+	authDataAttested     = 0x40
+	authDataExtensions   = 0x80
+)
+
+// aaguidExtension identifies the certificate extension holding the AAGUID of
+// the authenticator an attestation certificate was issued to.
+var aaguidExtension = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// webAuthnParty is the relying party passkeys are registered with. Passkeys
+// are disabled if its id is empty.
+type webAuthnParty struct {
+	id      string
+	name    string
+	origins []string
+	// verify is the user verification requirement of every ceremony.
+	verify  string
+	timeout time.Duration
+}
+
+// newWebAuthnParty returns the webAuthnParty described by conf. Every origin
+// must be a secure context within the relying party's domain.
+func newWebAuthnParty(
+	conf config.WebAuthnConfig,
+) (party webAuthnParty, err error) {
+	if conf.RPID == "" {
+		return party, nil
+	}
+	if !slices.Contains(
+		[]string{"required", "preferred", "discouraged"},
+		conf.UserVerification,
+	) {
+		return party, fmt.Errorf(
+			"%w: user verification '%s'",
+			ErrInvalidWebAuthnConfig,
+			conf.UserVerification,
+		)
+	}
+	if len(conf.Origins) == 0 {
+		return party, fmt.Errorf("%w: no origins", ErrInvalidWebAuthnConfig)
+	}
+	for _, origin := range conf.Origins {
+		u, err := url.Parse(origin)
+		valid := err == nil && u.Scheme+"://"+u.Host == origin &&
+			(u.Scheme == "https" ||
+				u.Scheme == "http" && u.Hostname() == "localhost") &&
+			(u.Hostname() == conf.RPID ||
+				strings.HasSuffix(u.Hostname(), "."+conf.RPID))
+		if !valid {
+			return party, fmt.Errorf(
+				"%w: origin '%s' not within '%s'",
+				ErrInvalidWebAuthnConfig,
+				origin,
+				conf.RPID,
+			)
+		}
+	}
+	return webAuthnParty{
+		id:      conf.RPID,
+		name:    conf.RPName,
+		origins: conf.Origins,
+		verify:  conf.UserVerification,
+		timeout: conf.Timeout,
+	}, nil
+}
+
+// A WebAuthnCeremony holds what a client needs to have an authenticator
+// register or assert a passkey. Token must be sent back along with the
+// authenticator's response.
+type WebAuthnCeremony struct {
+	Token     string
+	Challenge []byte
+	RPID      string
+	RPName    string
+	// UserHandle and Username identify the user registering a passkey.
+	UserHandle []byte
+	Username   string
+	// Credentials are the passkeys the user already has, which must not be
+	// registered again.
+	Credentials      []model.WebAuthnCredential
+	Algorithms       []int
+	UserVerification string
+	Timeout          time.Duration
+}
+
+// BeginWebAuthnRegistration starts the registration of a passkey for user,
+// which is completed by CompleteWebAuthnRegistration.
+func (m UserAuthManager) BeginWebAuthnRegistration(
+	user model.User,
+	c *gin.Context,
+) (ceremony WebAuthnCeremony, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to begin webauthn registration: %w", err)
+		}
+	}()
+
+	if m.webauthn.id == "" {
+		return ceremony, ErrWebAuthnDisabled
+	}
+	// Only the directory can vouch for its users.
+	if user.Managed() {
+		return ceremony, ErrManagedUser
+	}
+	ceremony, err = m.webAuthnCeremony(user.ID, webAuthnCreateToken, c)
+	if err != nil {
+		return ceremony, err
+	}
+	ceremony.UserHandle = webAuthnUserHandle(user.ID)
+	ceremony.Username = user.Username
+	ceremony.Credentials, err = m.ListWebAuthnCredentials(user, c)
+	return ceremony, err
+}
+
+// CompleteWebAuthnRegistration verifies the response of an authenticator to
+// the registration started by BeginWebAuthnRegistration and stores the
+// passkey it created for user. Attestation statements in the none and packed
+// formats are accepted. Packed attestation certificates are checked but not
+// chained to a trusted root since passkeys of any model are accepted.
+func (m UserAuthManager) CompleteWebAuthnRegistration(
+	user model.User,
+	form schema.WebAuthnRegistrationForm,
+	c *gin.Context,
+) (cred model.WebAuthnCredential, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf(
+				"failed to complete webauthn registration: %w",
+				err,
+			)
+		}
+	}()
+
+	if m.webauthn.id == "" {
+		return cred, ErrWebAuthnDisabled
+	}
+	if user.Managed() {
+		return cred, ErrManagedUser
+	}
+	token, err := m.consumeToken(form.Token, webAuthnCreateToken, c)
+	if err != nil {
+		return cred, err
+	}
+	if token.Info.UserID != user.ID {
+		return cred, ErrInvalidToken
+	}
+	rawID, idErr := decodeBase64URL(form.ID)
+	clientData, dataErr := decodeBase64URL(form.ClientDataJSON)
+	attestation, attErr := decodeBase64URL(form.AttestationObject)
+	if err = errors.Join(idErr, dataErr, attErr); err != nil {
+		return cred, fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+	}
+	cred, err = m.webauthn.register(
+		token.Info.Challenge,
+		rawID,
+		clientData,
+		attestation,
+	)
+	if err != nil {
+		return cred, fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+	}
+	cred.UserID = user.ID
+	cred.Name = form.Name
+	cred.Transports = strings.Join(form.Transports, " ")
+	r := m.db.WithContext(c.Request.Context()).Create(&cred)
+	if errors.Is(r.Error, gorm.ErrDuplicatedKey) {
+		return cred, ErrDuplicateWebAuthnCredential
+	}
+	return cred, r.Error
+}
+
+// ListWebAuthnCredentials returns the passkeys of user.
+func (m UserAuthManager) ListWebAuthnCredentials(
+	user model.User,
+	c *gin.Context,
+) ([]model.WebAuthnCredential, error) {
+	var creds []model.WebAuthnCredential
+	if r := m.db.WithContext(c.Request.Context()).Where(
+		"user_id = ?",
+		user.ID,
+	).Order("created_at DESC").Find(&creds); r.Error != nil {
+		return nil, fmt.Errorf(
+			"failed to list webauthn credentials: %w",
+			r.Error,
+		)
+	}
+	return creds, nil
+}
+
+// DeleteWebAuthnCredential deletes the passkey of user with identifier id.
+func (m UserAuthManager) DeleteWebAuthnCredential(
+	user model.User,
+	id uint,
+	c *gin.Context,
+) error {
+	r := m.db.WithContext(c.Request.Context()).Where(
+		"id = ? AND user_id = ?",
+		id,
+		user.ID,
+	).Delete(&model.WebAuthnCredential{})
+	if r.Error != nil {
+		return fmt.Errorf(
+			"failed to delete webauthn credential: %w",
+			r.Error,
+		)
+	}
+	if r.RowsAffected == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// BeginWebAuthnLogin starts a login with a passkey, which is completed by
+// CompleteWebAuthnLogin. No user is named so authenticators offer the
+// passkeys they hold for this service, and whether a user has passkeys is not
+// disclosed. Since anyone can start it, the login is only recorded once
+// completed.
+func (m UserAuthManager) BeginWebAuthnLogin(
+	c *gin.Context,
+) (ceremony WebAuthnCeremony, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to begin webauthn login: %w", err)
+		}
+	}()
+
+	if m.webauthn.id == "" {
+		return ceremony, ErrWebAuthnDisabled
+	}
+	return m.webAuthnCeremony(0, webAuthnGetToken, c)
+}
+
+// CompleteWebAuthnLogin verifies the assertion of a passkey for the login
+// started by BeginWebAuthnLogin and returns the passkey's user, which can
+// then be passed to RegisterSession. Assertions whose signature counter did
+// not grow are refused since their authenticator may have been cloned. Users
+// locked out by failed logins are refused with a ThrottleError.
+func (m UserAuthManager) CompleteWebAuthnLogin(
+	form schema.WebAuthnLoginForm,
+	c *gin.Context,
+) (user model.User, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to complete webauthn login: %w", err)
+		}
+	}()
+
+	if m.webauthn.id == "" {
+		return user, ErrWebAuthnDisabled
+	}
+	token, err := m.parseToken(form.Token, webAuthnGetToken)
+	if err != nil {
+		return user, err
+	}
+	rawID, idErr := decodeBase64URL(form.ID)
+	clientData, dataErr := decodeBase64URL(form.ClientDataJSON)
+	authData, authErr := decodeBase64URL(form.AuthenticatorData)
+	sig, sigErr := decodeBase64URL(form.Signature)
+	handle, handleErr := decodeBase64URL(form.UserHandle)
+	if errors.Join(idErr, dataErr, authErr, sigErr, handleErr) != nil {
+		return user, ErrInvalidCredentials
+	}
+	db := m.db.WithContext(c.Request.Context())
+	var cred model.WebAuthnCredential
+	r := db.First(&cred, "credential_id = ?", rawID)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return user, ErrInvalidCredentials
+	}
+	if r.Error != nil {
+		return user, r.Error
+	}
+	if !bytes.Equal(handle, webAuthnUserHandle(cred.UserID)) {
+		return user, ErrInvalidCredentials
+	}
+	r = db.First(&user, cred.UserID)
+	if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return user, ErrInvalidCredentials
+	}
+	if r.Error != nil {
+		return user, r.Error
+	}
+	if err = m.checkAttempts(c, m.userKey(user.Username)); err != nil {
+		return model.User{}, err
+	}
+	signCount, err := m.webauthn.assert(
+		cred,
+		token.Info.Challenge,
+		clientData,
+		authData,
+		sig,
+	)
+	if err != nil {
+		return model.User{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	// Refused logins leave the ceremony and the passkey untouched.
+	if m.mustVerify && !user.EmailVerified() {
+		return model.User{}, ErrEmailNotVerified
+	}
+	if err = m.consumeStatelessToken(token, c); err != nil {
+		return model.User{}, err
+	}
+	// Concurrent assertions with the same counter only succeed once.
+	r = db.Model(&cred).Where("sign_count = ?", cred.SignCount).Updates(
+		map[string]any{"sign_count": signCount, "last_used_at": time.Now()},
+	)
+	if r.Error != nil {
+		return model.User{}, r.Error
+	}
+	if r.RowsAffected == 0 {
+		return model.User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// webAuthnCeremony returns a ceremony of type t for the user with identifier
+// id, zero if not known yet, whose challenge is bound to its single use
+// token. The tokens of ceremonies for unknown users are stateless.
+func (m UserAuthManager) webAuthnCeremony(
+	id uint,
+	t tokenType,
+	c *gin.Context,
+) (WebAuthnCeremony, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return WebAuthnCeremony{}, err
+	}
+	info := newTokenInfo(id, t, m.webauthn.timeout)
+	info.Challenge = base64.RawURLEncoding.EncodeToString(challenge)
+	var token string
+	var err error
+	if id == 0 {
+		token, err = m.statelessToken(info)
+	} else {
+		token, err = m.oneTimeToken(info, c)
+	}
+	if err != nil {
+		return WebAuthnCeremony{}, err
+	}
+	return WebAuthnCeremony{
+		Token:            token,
+		Challenge:        challenge,
+		RPID:             m.webauthn.id,
+		RPName:           m.webauthn.name,
+		Algorithms:       coseAlgorithms,
+		UserVerification: m.webauthn.verify,
+		Timeout:          m.webauthn.timeout,
+	}, nil
+}
+
+// webAuthnUserHandle returns the opaque identifier of the user with
+// identifier id in its passkeys.
+func webAuthnUserHandle(id uint) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
+}
+
+// decodeBase64URL decodes the base64url encoding s, with or without padding.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// register verifies the response of an authenticator to a registration with
+// the given challenge and returns the credential it created, named by rawID.
+func (p webAuthnParty) register(
+	challenge string,
+	rawID []byte,
+	clientDataJSON []byte,
+	attestation []byte,
+) (model.WebAuthnCredential, error) {
+	err := p.checkClientData(clientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return model.WebAuthnCredential{}, err
+	}
+	var obj attestationObject
+	if err = cborDecoder.Unmarshal(attestation, &obj); err != nil {
+		return model.WebAuthnCredential{}, err
+	}
+	authData, err := parseAuthenticatorData(obj.AuthData)
+	if err != nil {
+		return model.WebAuthnCredential{}, err
+	}
+	if err = p.checkAuthenticatorData(authData); err != nil {
+		return model.WebAuthnCredential{}, err
+	}
+	if authData.flags&authDataAttested == 0 || len(rawID) == 0 ||
+		!bytes.Equal(authData.credentialID, rawID) {
+		return model.WebAuthnCredential{}, errors.New("credential id mismatch")
+	}
+	key, alg, err := parseCOSEKey(authData.publicKey)
+	if err != nil {
+		return model.WebAuthnCredential{}, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	err = verifyAttestation(obj, authData, key, alg, clientDataHash[:])
+	if err != nil {
+		return model.WebAuthnCredential{}, err
+	}
+	return model.WebAuthnCredential{
+		CredentialID: rawID,
+		PublicKey:    authData.publicKey,
+		Algorithm:    alg,
+		SignCount:    authData.signCount,
+		AAGUID:       authData.aaguid,
+	}, nil
+}
+
+// assert verifies the assertion of cred with the given challenge and returns
+// the new signature counter of its authenticator.
+func (p webAuthnParty) assert(
+	cred model.WebAuthnCredential,
+	challenge string,
+	clientDataJSON []byte,
+	rawAuthData []byte,
+	sig []byte,
+) (uint32, error) {
+	err := p.checkClientData(clientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err = p.checkAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+	key, alg, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(slices.Clone(rawAuthData), clientDataHash[:]...)
+	if alg != cred.Algorithm || !verifySignature(key, alg, signed, sig) {
+		return 0, errors.New("invalid signature")
+	}
+	// Authenticators that do not keep a counter always report zero.
+	if (authData.signCount != 0 || cred.SignCount != 0) &&
+		authData.signCount <= cred.SignCount {
+		return 0, errors.New("signature counter did not grow")
+	}
+	return authData.signCount, nil
+}
+
+// collectedClientData is the data a client passes to an authenticator for it
+// to sign, as described by the WebAuthn specification section 5.8.1.
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// checkClientData checks that the client data raw belongs to a ceremony of
+// the given type with the given challenge on one of p's origins.
+func (p webAuthnParty) checkClientData(raw []byte, t, challenge string) error {
+	var data collectedClientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return err
+	}
+	switch {
+	case data.Type != t:
+		return fmt.Errorf("wrong ceremony '%s'", data.Type)
+	case subtle.ConstantTimeCompare(
+		[]byte(data.Challenge),
+		[]byte(challenge),
+	) != 1:
+		return errors.New("wrong challenge")
+	case data.CrossOrigin || !slices.Contains(p.origins, data.Origin):
+		return fmt.Errorf("origin '%s' not allowed", data.Origin)
+	}
+	return nil
+}
+
+// authenticatorData is the data signed by an authenticator along with the
+// client data, as described by the WebAuthn specification section 6.1. The
+// attested credential is only set on registration.
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// aaguid, credentialID and publicKey, which is COSE encoded, describe
+	// the attested credential.
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData returns the authenticator data encoded in b.
+func parseAuthenticatorData(b []byte) (authenticatorData, error) {
+	errShort := errors.New("authenticator data too short")
+	if len(b) < 37 {
+		return authenticatorData{}, errShort
+	}
+	data := authenticatorData{
+		rpIDHash:  b[:32],
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	rest := b[37:]
+	var err error
+	if data.flags&authDataAttested != 0 {
+		if len(rest) < 18 {
+			return data, errShort
+		}
+		data.aaguid = rest[:16]
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n > 1023 || len(rest) < n {
+			return data, errShort
+		}
+		data.credentialID, rest = rest[:n], rest[n:]
+		var key cbor.RawMessage
+		if rest, err = cborDecoder.UnmarshalFirst(rest, &key); err != nil {
+			return data, err
+		}
+		data.publicKey = key
+	}
+	if data.flags&authDataExtensions != 0 {
+		var extensions cbor.RawMessage
+		rest, err = cborDecoder.UnmarshalFirst(rest, &extensions)
+		if err != nil {
+			return data, err
+		}
+	}
+	if len(rest) > 0 {
+		return data, errors.New("trailing authenticator data")
+	}
+	return data, nil
+}
+
+// checkAuthenticatorData checks that data was produced for p with the user
+// present, and verified if p requires it.
+func (p webAuthnParty) checkAuthenticatorData(data authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(p.id))
+	switch {
+	case !bytes.Equal(data.rpIDHash, rpIDHash[:]):
+		return errors.New("wrong relying party")
+	case data.flags&authDataUserPresent == 0:
+		return errors.New("user not present")
+	case p.verify == "required" && data.flags&authDataUserVerified == 0:
+		return errors.New("user not verified")
+	}
+	return nil
+}
+
+// attestationObject is the response of an authenticator to a registration, as
+// described by the WebAuthn specification section 6.5.
+type attestationObject struct {
+	Format    string          `cbor:"fmt"`
+	Statement cbor.RawMessage `cbor:"attStmt"`
+	AuthData  []byte          `cbor:"authData"`
+}
+
+// packedStatement is the attestation statement of the packed format, as
+// described by the WebAuthn specification section 8.2.
+type packedStatement struct {
+	Alg int      `cbor:"alg"`
+	Sig []byte   `cbor:"sig"`
+	X5C [][]byte `cbor:"x5c"`
+}
+
+// verifyAttestation checks the attestation statement of obj, whose parsed
+// authenticator data attests key with the COSE algorithm alg, for the client
+// data hashed as clientDataHash.
+func verifyAttestation(
+	obj attestationObject,
+	authData authenticatorData,
+	key any,
+	alg int,
+	clientDataHash []byte,
+) error {
+	switch obj.Format {
+	case "none":
+		var stmt map[string]cbor.RawMessage
+		err := cborDecoder.Unmarshal(obj.Statement, &stmt)
+		if err != nil || len(stmt) > 0 {
+			return errors.New("invalid none attestation statement")
+		}
+		return nil
+	case "packed":
+		var stmt packedStatement
+		if err := cborDecoder.Unmarshal(obj.Statement, &stmt); err != nil {
+			return err
+		}
+		signed := append(slices.Clone(obj.AuthData), clientDataHash...)
+		if len(stmt.X5C) == 0 {
+			// Self attestation, signed by the credential itself.
+			if stmt.Alg != alg || !verifySignature(key, alg, signed, stmt.Sig) {
+				return errors.New("invalid self attestation signature")
+			}
+			return nil
+		}
+		cert, err := x509.ParseCertificate(stmt.X5C[0])
+		if err != nil {
+			return err
+		}
+		if err = checkAttestationCertificate(cert, authData.aaguid); err != nil {
+			return err
+		}
+		if !verifySignature(cert.PublicKey, stmt.Alg, signed, stmt.Sig) {
+			return errors.New("invalid attestation signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported attestation format '%s'", obj.Format)
+}
+
+// checkAttestationCertificate checks that cert meets the requirements of
+// packed attestation certificates for the authenticator model aaguid, as
+// described by the WebAuthn specification section 8.2.1.
+func checkAttestationCertificate(
+	cert *x509.Certificate,
+	aaguid []byte,
+) error {
+	subject := cert.Subject
+	if cert.Version != 3 || !cert.BasicConstraintsValid || cert.IsCA ||
+		len(subject.Country) == 0 || len(subject.Organization) == 0 ||
+		subject.CommonName == "" || !slices.Equal(
+		subject.OrganizationalUnit,
+		[]string{"Authenticator Attestation"},
+	) {
+		return errors.New("invalid attestation certificate")
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(aaguidExtension) {
+			continue
+		}
+		var value []byte
+		rest, err := asn1.Unmarshal(ext.Value, &value)
+		if err != nil || len(rest) > 0 || ext.Critical ||
+			!bytes.Equal(value, aaguid) {
+			return errors.New("attestation certificate aaguid mismatch")
+		}
+	}
+	return nil
+}
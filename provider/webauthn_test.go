@@ -0,0 +1,689 @@
+package provider
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"gin-gorm-api/config"
+	"gin-gorm-api/model"
+	"gin-gorm-api/schema"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost"
+)
+
+// Attestation formats of a testAuthenticator. testX5CAttestation is the
+// packed format with an attestation certificate.
+const (
+	testNoneAttestation   = "none"
+	testPackedAttestation = "packed"
+	testX5CAttestation    = "x5c"
+)
+
+// testAuthenticator is a software authenticator holding a single passkey.
+type testAuthenticator struct {
+	key    crypto.Signer
+	alg    int
+	credID []byte
+	// counter is the signature counter, incremented by every assertion
+	// unless static is set.
+	counter uint32
+	static  bool
+	// rpID and origin are those the authenticator and its client claim to
+	// act for.
+	rpID   string
+	origin string
+}
+
+// newTestAuthenticator returns a testAuthenticator whose passkey uses the
+// COSE algorithm alg, either coseES256 or coseEdDSA.
+func newTestAuthenticator(t *testing.T, alg int) *testAuthenticator {
+	t.Helper()
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case coseES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case coseEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	credID := make([]byte, 16)
+	if _, err = rand.Read(credID); err != nil {
+		t.Fatal(err)
+	}
+	return &testAuthenticator{
+		key:    key,
+		alg:    alg,
+		credID: credID,
+		rpID:   testRPID,
+		origin: testOrigin,
+	}
+}
+
+// testSign returns the signature of data by key, as encoded in WebAuthn.
+func testSign(t *testing.T, key crypto.Signer, data []byte) []byte {
+	t.Helper()
+	var opts crypto.SignerOpts = crypto.Hash(0)
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		digest := sha256.Sum256(data)
+		data, opts = digest[:], crypto.SHA256
+	}
+	sig, err := key.Sign(rand.Reader, data, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// testCBOR returns the CBOR encoding of v.
+func testCBOR(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := cbor.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// coseKey returns the COSE encoding of the public key of a's passkey.
+func (a *testAuthenticator) coseKey(t *testing.T) []byte {
+	t.Helper()
+	switch key := a.key.(type) {
+	case *ecdsa.PrivateKey:
+		return testCBOR(t, map[int]any{
+			1:  2,
+			3:  coseES256,
+			-1: 1,
+			-2: key.X.FillBytes(make([]byte, 32)),
+			-3: key.Y.FillBytes(make([]byte, 32)),
+		})
+	case ed25519.PrivateKey:
+		return testCBOR(t, map[int]any{
+			1:  1,
+			3:  coseEdDSA,
+			-1: 6,
+			-2: []byte(key.Public().(ed25519.PublicKey)),
+		})
+	}
+	t.Fatalf("unsupported key %T", a.key)
+	return nil
+}
+
+// authData returns the authenticator data of a with flags, attesting its
+// passkey if the attested flag is set.
+func (a *testAuthenticator) authData(t *testing.T, flags byte) []byte {
+	t.Helper()
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	if flags&authDataAttested != 0 {
+		data = append(data, make([]byte, 16)...) // Zero AAGUID.
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credID)))
+		data = append(data, a.credID...)
+		data = append(data, a.coseKey(t)...)
+	}
+	return data
+}
+
+// clientData returns the client data of a ceremony of type typ for
+// challenge.
+func (a *testAuthenticator) clientData(
+	t *testing.T,
+	typ string,
+	challenge []byte,
+) []byte {
+	t.Helper()
+	b, err := json.Marshal(collectedClientData{
+		Type:      typ,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.origin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// create returns the response of a to the registration ceremony, attested in
+// format.
+func (a *testAuthenticator) create(
+	t *testing.T,
+	ceremony WebAuthnCeremony,
+	format string,
+) schema.WebAuthnRegistrationForm {
+	t.Helper()
+	clientData := a.clientData(t, "webauthn.create", ceremony.Challenge)
+	authData := a.authData(
+		t,
+		authDataUserPresent|authDataUserVerified|authDataAttested,
+	)
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(authData, clientDataHash[:]...)
+	var stmt map[string]any
+	switch format {
+	case testNoneAttestation:
+		stmt = map[string]any{}
+	case testPackedAttestation:
+		stmt = map[string]any{"alg": a.alg, "sig": testSign(t, a.key, signed)}
+	case testX5CAttestation:
+		key, cert := testAttestationCertificate(t)
+		stmt = map[string]any{
+			"alg": coseES256,
+			"sig": testSign(t, key, signed),
+			"x5c": [][]byte{cert},
+		}
+		format = testPackedAttestation
+	default:
+		t.Fatalf("unsupported attestation format %q", format)
+	}
+	attestation := testCBOR(t, map[string]any{
+		"fmt":      format,
+		"attStmt":  stmt,
+		"authData": authData,
+	})
+	return schema.WebAuthnRegistrationForm{
+		Token:             ceremony.Token,
+		Name:              "test key",
+		ID:                base64.RawURLEncoding.EncodeToString(a.credID),
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientData),
+		AttestationObject: base64.RawURLEncoding.EncodeToString(attestation),
+		Transports:        []string{"internal"},
+	}
+}
+
+// get returns the assertion by a of its passkey, registered for the user
+// with identifier id, for the login ceremony.
+func (a *testAuthenticator) get(
+	t *testing.T,
+	ceremony WebAuthnCeremony,
+	id uint,
+) schema.WebAuthnLoginForm {
+	t.Helper()
+	if !a.static {
+		a.counter++
+	}
+	clientData := a.clientData(t, "webauthn.get", ceremony.Challenge)
+	authData := a.authData(t, authDataUserPresent|authDataUserVerified)
+	clientDataHash := sha256.Sum256(clientData)
+	sig := testSign(t, a.key, append(authData, clientDataHash[:]...))
+	return schema.WebAuthnLoginForm{
+		Token:             ceremony.Token,
+		ID:                base64.RawURLEncoding.EncodeToString(a.credID),
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientData),
+		AuthenticatorData: base64.RawURLEncoding.EncodeToString(authData),
+		Signature:         base64.RawURLEncoding.EncodeToString(sig),
+		UserHandle: base64.RawURLEncoding.EncodeToString(
+			webAuthnUserHandle(id),
+		),
+	}
+}
+
+// testAttestationCertificate returns a P-256 key and the DER encoding of the
+// packed attestation certificate of the zero AAGUID it signs.
+func testAttestationCertificate(t *testing.T) (crypto.Signer, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aaguid, err := asn1.Marshal(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Country:            []string{"US"},
+			Organization:       []string{"Test"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "Test Authenticator",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions: []pkix.Extension{
+			{Id: aaguidExtension, Value: aaguid},
+		},
+	}
+	cert, err := x509.CreateCertificate(
+		rand.Reader,
+		template,
+		template,
+		key.Public(),
+		key,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// newWebAuthnTestManager returns a test UserAuthManager with passkeys
+// enabled, configured further by configure if not nil, along with its
+// database and a verified user.
+func newWebAuthnTestManager(
+	t *testing.T,
+	configure func(conf *config.Config),
+) (UserAuthManager, *gorm.DB, model.User) {
+	t.Helper()
+	m, db, _ := newTestManager(t, func(conf *config.Config) {
+		conf.Auth.WebAuthn.RPID = testRPID
+		conf.Auth.WebAuthn.Origins = []string{testOrigin}
+		if configure != nil {
+			configure(conf)
+		}
+	})
+	now := time.Now()
+	user := model.User{
+		Username:        "alice",
+		Email:           "alice@example.com",
+		EmailVerifiedAt: &now,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return m, db, user
+}
+
+// registerPasskey registers the passkey of a for user, attested in format.
+// The ceremony is passed to modify, if not nil, before a responds to it.
+func registerPasskey(
+	t *testing.T,
+	m UserAuthManager,
+	user model.User,
+	a *testAuthenticator,
+	format string,
+	modify func(ceremony *WebAuthnCeremony),
+) error {
+	t.Helper()
+	c, _ := newTestContext(http.MethodPost, "/auth/webauthn/register", nil, nil)
+	ceremony, err := m.BeginWebAuthnRegistration(user, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modify != nil {
+		modify(&ceremony)
+	}
+	c, _ = newTestContext(
+		http.MethodPost,
+		"/auth/webauthn/register/complete",
+		nil,
+		nil,
+	)
+	_, err = m.CompleteWebAuthnRegistration(
+		user,
+		a.create(t, ceremony, format),
+		c,
+	)
+	return err
+}
+
+// beginWebAuthnLogin starts a passkey login.
+func beginWebAuthnLogin(t *testing.T, m UserAuthManager) WebAuthnCeremony {
+	t.Helper()
+	c, _ := newTestContext(http.MethodPost, "/auth/webauthn/login", nil, nil)
+	ceremony, err := m.BeginWebAuthnLogin(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ceremony
+}
+
+// completeWebAuthnLogin completes a passkey login with form.
+func completeWebAuthnLogin(
+	m UserAuthManager,
+	form schema.WebAuthnLoginForm,
+) (model.User, error) {
+	c, _ := newTestContext(
+		http.MethodPost,
+		"/auth/webauthn/login/complete",
+		nil,
+		nil,
+	)
+	return m.CompleteWebAuthnLogin(form, c)
+}
+
+// webAuthnLogin logs in with the passkey of a registered for user.
+func webAuthnLogin(
+	t *testing.T,
+	m UserAuthManager,
+	user model.User,
+	a *testAuthenticator,
+) (model.User, error) {
+	t.Helper()
+	return completeWebAuthnLogin(m, a.get(t, beginWebAuthnLogin(t, m), user.ID))
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	algorithms := map[string]int{"es256": coseES256, "ed25519": coseEdDSA}
+	formats := []string{
+		testNoneAttestation,
+		testPackedAttestation,
+		testX5CAttestation,
+	}
+	for name, alg := range algorithms {
+		for _, format := range formats {
+			t.Run(name+"/"+format, func(t *testing.T) {
+				m, db, user := newWebAuthnTestManager(t, nil)
+				a := newTestAuthenticator(t, alg)
+				err := registerPasskey(t, m, user, a, format, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var cred model.WebAuthnCredential
+				if err = db.First(&cred).Error; err != nil {
+					t.Fatal(err)
+				}
+				if cred.UserID != user.ID || cred.Algorithm != alg {
+					t.Fatalf(
+						"got user %d and algorithm %d, want %d and %d",
+						cred.UserID,
+						cred.Algorithm,
+						user.ID,
+						alg,
+					)
+				}
+				for range 2 {
+					got, err := webAuthnLogin(t, m, user, a)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got.ID != user.ID {
+						t.Fatalf("got user %d, want %d", got.ID, user.ID)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestWebAuthnRegistrationRefused(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(a *testAuthenticator, ceremony *WebAuthnCeremony)
+	}{
+		{
+			name: "wrong origin",
+			modify: func(a *testAuthenticator, _ *WebAuthnCeremony) {
+				a.origin = "https://evil.example"
+			},
+		},
+		{
+			name: "wrong rp id",
+			modify: func(a *testAuthenticator, _ *WebAuthnCeremony) {
+				a.rpID = "example.com"
+			},
+		},
+		{
+			name: "wrong challenge",
+			modify: func(_ *testAuthenticator, ceremony *WebAuthnCeremony) {
+				ceremony.Challenge = make([]byte, 32)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, db, user := newWebAuthnTestManager(t, nil)
+			a := newTestAuthenticator(t, coseES256)
+			err := registerPasskey(
+				t,
+				m,
+				user,
+				a,
+				testPackedAttestation,
+				func(ceremony *WebAuthnCeremony) { tt.modify(a, ceremony) },
+			)
+			if !errors.Is(err, ErrInvalidAttestation) {
+				t.Fatalf("got %v, want %v", err, ErrInvalidAttestation)
+			}
+			var count int64
+			err = db.Model(&model.WebAuthnCredential{}).Count(&count).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 {
+				t.Fatalf("got %d passkeys, want 0", count)
+			}
+		})
+	}
+}
+
+func TestWebAuthnLoginRefused(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(a *testAuthenticator, ceremony *WebAuthnCeremony)
+	}{
+		{
+			name: "wrong origin",
+			modify: func(a *testAuthenticator, _ *WebAuthnCeremony) {
+				a.origin = "https://evil.example"
+			},
+		},
+		{
+			name: "wrong rp id",
+			modify: func(a *testAuthenticator, _ *WebAuthnCeremony) {
+				a.rpID = "example.com"
+			},
+		},
+		{
+			name: "wrong challenge",
+			modify: func(_ *testAuthenticator, ceremony *WebAuthnCeremony) {
+				ceremony.Challenge = make([]byte, 32)
+			},
+		},
+		{
+			name: "counter did not grow",
+			modify: func(a *testAuthenticator, _ *WebAuthnCeremony) {
+				a.counter--
+			},
+		},
+		{
+			name: "counter back to zero",
+			modify: func(a *testAuthenticator, _ *WebAuthnCeremony) {
+				a.counter = 0
+				a.static = true
+			},
+		},
+		{
+			name: "unknown passkey",
+			modify: func(a *testAuthenticator, _ *WebAuthnCeremony) {
+				a.credID = []byte("unknown")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, user := newWebAuthnTestManager(t, nil)
+			a := newTestAuthenticator(t, coseES256)
+			err := registerPasskey(t, m, user, a, testNoneAttestation, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = webAuthnLogin(t, m, user, a); err != nil {
+				t.Fatal(err)
+			}
+			ceremony := beginWebAuthnLogin(t, m)
+			tt.modify(a, &ceremony)
+			_, err = completeWebAuthnLogin(m, a.get(t, ceremony, user.ID))
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("got %v, want %v", err, ErrInvalidCredentials)
+			}
+		})
+	}
+}
+
+func TestWebAuthnLoginZeroCounter(t *testing.T) {
+	m, _, user := newWebAuthnTestManager(t, nil)
+	a := newTestAuthenticator(t, coseEdDSA)
+	a.static = true
+	err := registerPasskey(t, m, user, a, testNoneAttestation, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Authenticators without a counter can log in again and again.
+	for range 3 {
+		if _, err = webAuthnLogin(t, m, user, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWebAuthnLoginReusedToken(t *testing.T) {
+	stores := map[string]bool{"memory": true, "database": false}
+	for name, inMemory := range stores {
+		t.Run(name, func(t *testing.T) {
+			m, db, user := newWebAuthnTestManager(
+				t,
+				func(conf *config.Config) { conf.Testing = inMemory },
+			)
+			a := newTestAuthenticator(t, coseES256)
+			err := registerPasskey(t, m, user, a, testNoneAttestation, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ceremony := beginWebAuthnLogin(t, m)
+			// Starting a login stores nothing.
+			var count int64
+			err = db.Model(&model.OneTimeToken{}).Where(
+				"purpose = ?",
+				tokenTypeNames[webAuthnGetToken],
+			).Count(&count).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 {
+				t.Fatalf("got %d stored login tokens, want 0", count)
+			}
+			// A failed assertion leaves the token usable.
+			origin := a.origin
+			a.origin = "https://evil.example"
+			_, err = completeWebAuthnLogin(m, a.get(t, ceremony, user.ID))
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("got %v, want %v", err, ErrInvalidCredentials)
+			}
+			a.origin = origin
+			_, err = completeWebAuthnLogin(m, a.get(t, ceremony, user.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = completeWebAuthnLogin(m, a.get(t, ceremony, user.ID))
+			if !errors.Is(err, ErrTokenReused) {
+				t.Fatalf("got %v, want %v", err, ErrTokenReused)
+			}
+		})
+	}
+}
+
+func TestWebAuthnLoginDeletedUser(t *testing.T) {
+	m, db, user := newWebAuthnTestManager(t, nil)
+	a := newTestAuthenticator(t, coseES256)
+	err := registerPasskey(t, m, user, a, testNoneAttestation, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Delete(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, err = webAuthnLogin(t, m, user, a)
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidCredentials)
+	}
+}
+
+// checkSignCount fails t unless the only passkey stored in db has the given
+// signature counter.
+func checkSignCount(t *testing.T, db *gorm.DB, count uint32) {
+	t.Helper()
+	var cred model.WebAuthnCredential
+	if err := db.First(&cred).Error; err != nil {
+		t.Fatal(err)
+	}
+	if cred.SignCount != count {
+		t.Fatalf("got signature counter %d, want %d", cred.SignCount, count)
+	}
+}
+
+func TestWebAuthnLoginLockedOut(t *testing.T) {
+	m, db, user := newWebAuthnTestManager(t, nil)
+	a := newTestAuthenticator(t, coseES256)
+	err := registerPasskey(t, m, user, a, testNoneAttestation, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := newTestContext(http.MethodPost, "/auth", nil, nil)
+	for range m.throttle.UserLockoutThreshold {
+		if err = m.failAttempt(c, m.userKey(user.Username)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ceremony := beginWebAuthnLogin(t, m)
+	_, err = completeWebAuthnLogin(m, a.get(t, ceremony, user.ID))
+	var throttleErr ThrottleError
+	if !errors.As(err, &throttleErr) {
+		t.Fatalf("got %v, want a ThrottleError", err)
+	}
+	// The refused login neither used the ceremony nor moved the counter.
+	checkSignCount(t, db, 0)
+	if err = m.UnlockUser(user, c); err != nil {
+		t.Fatal(err)
+	}
+	_, err = completeWebAuthnLogin(m, a.get(t, ceremony, user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSignCount(t, db, a.counter)
+}
+
+func TestWebAuthnLoginUnverifiedUser(t *testing.T) {
+	m, db, user := newWebAuthnTestManager(t, func(conf *config.Config) {
+		conf.Auth.RequireVerifiedEmail = true
+	})
+	a := newTestAuthenticator(t, coseES256)
+	err := registerPasskey(t, m, user, a, testNoneAttestation, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&user).Update("email_verified_at", nil).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	ceremony := beginWebAuthnLogin(t, m)
+	_, err = completeWebAuthnLogin(m, a.get(t, ceremony, user.ID))
+	if !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("got %v, want %v", err, ErrEmailNotVerified)
+	}
+	checkSignCount(t, db, 0)
+	err = db.Model(&user).Update("email_verified_at", time.Now()).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = completeWebAuthnLogin(m, a.get(t, ceremony, user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSignCount(t, db, a.counter)
+}
@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"gin-gorm-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+// ============================================== //
+//                    INPUT                       //
+// ============================================== //
+
+// RoleForm contains the necessary information to create a new role.
+type RoleForm struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// Validate f's schema.
+func (f RoleForm) Validate() (Errors, error) {
+	perms := make([]interface{}, len(model.AllPermissions()))
+	for i, perm := range model.AllPermissions() {
+		perms[i] = perm
+	}
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Name,
+			validation.Required,
+			validation.Length(1, 64),
+			is.Alphanumeric,
+		),
+		validation.Field(
+			&f.Permissions,
+			validation.Each(validation.In(perms...)),
+		),
+	)
+	return errToErrors(err)
+}
+
+// RoleAssignmentForm contains the role to be assigned to a user.
+type RoleAssignmentForm struct {
+	Role string `json:"role"`
+}
+
+// Validate f's schema.
+func (f RoleAssignmentForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Role,
+			validation.Required,
+		),
+	)
+	return errToErrors(err)
+}
+
+// ============================================== //
+//                    OUTPUT                      //
+// ============================================== //
+
+// RoleOut contains information about a role.
+type RoleOut struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
@@ -0,0 +1,177 @@
+package schema
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// ============================================== //
+//                    INPUT                       //
+// ============================================== //
+
+// OAuthClientForm contains the information required to register an OAuth
+// client. Confidential clients are given a secret to authenticate with.
+type OAuthClientForm struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+// Validate f's schema.
+func (f OAuthClientForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Name,
+			validation.Required,
+			validation.Length(1, 64),
+		),
+		validation.Field(
+			&f.RedirectURIs,
+			validation.Required,
+			validation.Length(1, 8),
+			validation.Each(validation.Required, validation.Length(1, 255)),
+		),
+		validation.Field(
+			&f.Scopes,
+			validation.Required,
+		),
+	)
+	return errToErrors(err)
+}
+
+// OAuthAuthorizeForm contains the parameters of an authorization request as
+// described by RFC 6749 section 4.1.1 and RFC 7636 section 4.3.
+type OAuthAuthorizeForm struct {
+	ResponseType        string `json:"response_type" form:"response_type"`
+	ClientID            string `json:"client_id" form:"client_id"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"` //nolint:lll // annotaions dont allow new lines.
+}
+
+// Validate f's schema.
+func (f OAuthAuthorizeForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.ResponseType,
+			validation.Required,
+		),
+		validation.Field(
+			&f.ClientID,
+			validation.Required,
+			validation.Length(1, 64),
+		),
+		validation.Field(
+			&f.State,
+			validation.Length(0, 512),
+		),
+	)
+	return errToErrors(err)
+}
+
+// OAuthConsentForm contains the decision of a user on an authorization
+// request.
+type OAuthConsentForm struct {
+	OAuthAuthorizeForm
+	Approve bool `json:"approve"`
+}
+
+// Validate f's schema.
+func (f OAuthConsentForm) Validate() (Errors, error) {
+	return f.OAuthAuthorizeForm.Validate()
+}
+
+// OAuthTokenForm contains the parameters of a token request as described by
+// RFC 6749 sections 4.1.3, 4.4.2 and 6. Client credentials are sent
+// separately.
+type OAuthTokenForm struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+}
+
+// OAuthTokenHintForm contains the token of an introspection or revocation
+// request as described by RFC 7662 and RFC 7009.
+type OAuthTokenHintForm struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+}
+
+// ============================================== //
+//                    OUTPUT                      //
+// ============================================== //
+
+// OAuthClientOut contains information about an OAuth client.
+type OAuthClientOut struct {
+	ClientID     string     `json:"client_id"`
+	Name         string     `json:"name"`
+	RedirectURIs []string   `json:"redirect_uris"`
+	Scopes       []string   `json:"scopes"`
+	Confidential bool       `json:"confidential"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+}
+
+// NewOAuthClientOut contains information about a newly registered OAuth
+// client including its secret, which is only ever shown once.
+type NewOAuthClientOut struct {
+	OAuthClientOut
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// OAuthConsentOut contains what a user is asked to consent to by an
+// authorization request.
+type OAuthConsentOut struct {
+	ClientID    string   `json:"client_id"`
+	ClientName  string   `json:"client_name"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+}
+
+// OAuthRedirectOut contains where to send the user back to once an
+// authorization request is decided.
+type OAuthRedirectOut struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// OAuthErrorOut contains an error as described by RFC 6749 section 5.2. If
+// the user can be sent back to the client RedirectTo holds where.
+type OAuthErrorOut struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	RedirectTo       string `json:"redirect_to,omitempty"`
+}
+
+// OAuthTokenOut contains the tokens issued to an OAuth client as described
+// by RFC 6749 section 5.1.
+type OAuthTokenOut struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthIntrospectionOut contains the state of a token as described by RFC
+// 7662 section 2.2. Inactive tokens only have Active set.
+type OAuthIntrospectionOut struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+}
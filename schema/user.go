@@ -1,6 +1,9 @@
 package schema
 
 import (
+	"regexp"
+	"time"
+
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
 )
@@ -60,7 +63,9 @@ func (f LoginForm) Validate() (Errors, error) {
 		validation.Field(
 			&f.Username,
 			validation.Required,
-			is.Alphanumeric,
+			validation.Length(1, 256),
+			// Directory usernames are not limited to alphanumeric ones.
+			validation.Match(loginUsernameRegexp),
 		),
 		validation.Field(
 			&f.Password,
@@ -71,6 +76,119 @@ func (f LoginForm) Validate() (Errors, error) {
 	return errToErrors(err)
 }
 
+// loginUsernameRegexp matches the usernames users can log in with.
+var loginUsernameRegexp = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+// MFAForm contains the information required to complete a login that
+// requires a second factor.
+type MFAForm struct {
+	Token string `json:"mfa_token"`
+	Code  string `json:"code"`
+}
+
+// Validate f's schema.
+func (f MFAForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Token,
+			validation.Required,
+		),
+		validation.Field(
+			&f.Code,
+			validation.Required,
+			validation.Length(6, 16),
+		),
+	)
+	return errToErrors(err)
+}
+
+// TOTPCodeForm contains a TOTP code or, where accepted, a recovery code.
+type TOTPCodeForm struct {
+	Code string `json:"code"`
+}
+
+// Validate f's schema.
+func (f TOTPCodeForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Code,
+			validation.Required,
+			validation.Length(6, 16),
+		),
+	)
+	return errToErrors(err)
+}
+
+// RefreshForm contains the refresh token of a session.
+type RefreshForm struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Validate f's schema.
+func (f RefreshForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.RefreshToken,
+			validation.Required,
+		),
+	)
+	return errToErrors(err)
+}
+
+// APIKeyForm contains the information required to create an API key.
+type APIKeyForm struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Validate f's schema.
+func (f APIKeyForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Name,
+			validation.Required,
+			validation.Length(1, 64),
+		),
+		validation.Field(
+			&f.Scopes,
+			validation.Required,
+		),
+		validation.Field(
+			&f.ExpiresAt,
+			validation.Min(time.Now()),
+		),
+	)
+	return errToErrors(err)
+}
+
+// APIKeyUpdateForm contains the information that can be changed of an API
+// key. Empty fields are left untouched.
+type APIKeyUpdateForm struct {
+	Name      string     `json:"name"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Validate f's schema.
+func (f APIKeyUpdateForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Name,
+			validation.Length(1, 64),
+		),
+		validation.Field(
+			&f.ExpiresAt,
+			validation.Min(time.Now()),
+		),
+	)
+	return errToErrors(err)
+}
+
 // PasswordResetRequestForm contains the information required to send a
 // password reset token.
 type PasswordResetRequestForm struct {
@@ -121,17 +239,163 @@ func (f PasswordResetForm) Validate() (Errors, error) {
 	return errToErrors(err)
 }
 
+// EmailVerificationRequestForm contains the information required to send
+// an email verification token.
+type EmailVerificationRequestForm struct {
+	Email string `json:"email"`
+}
+
+// Validate f's schema.
+func (f EmailVerificationRequestForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Email,
+			validation.Required,
+			is.Email,
+		),
+	)
+	return errToErrors(err)
+}
+
+// EmailVerificationForm contains the token that verifies an email address.
+type EmailVerificationForm struct {
+	Token string `json:"token"`
+}
+
+// Validate f's schema.
+func (f EmailVerificationForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Token,
+			validation.Required,
+		),
+	)
+	return errToErrors(err)
+}
+
+// MagicLinkRequestForm contains the information required to send a magic
+// login link.
+type MagicLinkRequestForm struct {
+	Email string `json:"email"`
+}
+
+// Validate f's schema.
+func (f MagicLinkRequestForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Email,
+			validation.Required,
+			is.Email,
+		),
+	)
+	return errToErrors(err)
+}
+
+// MagicLinkForm contains the token of a magic login link.
+type MagicLinkForm struct {
+	Token string `json:"token"`
+}
+
+// Validate f's schema.
+func (f MagicLinkForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Token,
+			validation.Required,
+		),
+	)
+	return errToErrors(err)
+}
+
+// ReauthenticationForm contains the information required to prove the
+// identity of the user of a session again. The code is only required from
+// users with a second factor.
+type ReauthenticationForm struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// Validate f's schema.
+func (f ReauthenticationForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Password,
+			validation.Required,
+			validation.Length(8, 256),
+		),
+		validation.Field(
+			&f.Code,
+			validation.Length(6, 16),
+		),
+	)
+	return errToErrors(err)
+}
+
+// EmailChangeForm contains the information required to change the email
+// address of an authenticated user.
+type EmailChangeForm struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Validate f's schema.
+func (f EmailChangeForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Email,
+			validation.Required,
+			is.Email,
+		),
+		validation.Field(
+			&f.Password,
+			validation.Required,
+			validation.Length(8, 256),
+		),
+	)
+	return errToErrors(err)
+}
+
+// EmailChangeTokenForm contains the token that confirms or reverts an email
+// address change.
+type EmailChangeTokenForm struct {
+	Token string `json:"token"`
+}
+
+// Validate f's schema.
+func (f EmailChangeTokenForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Token,
+			validation.Required,
+		),
+	)
+	return errToErrors(err)
+}
+
 // PasswordChangeForm contains the information required to change the
 // password of an authenticated user.
 type PasswordChangeForm struct {
-	Password      string `json:"password"`
-	PasswordAgain string `json:"passwordAgain"`
+	CurrentPassword string `json:"currentPassword"`
+	Password        string `json:"password"`
+	PasswordAgain   string `json:"passwordAgain"`
 }
 
 // Validate f's schema.
 func (f PasswordChangeForm) Validate() (Errors, error) {
 	err := validation.ValidateStruct(
 		&f,
+		validation.Field(
+			&f.CurrentPassword,
+			validation.Required,
+			validation.Length(8, 256),
+		),
 		validation.Field(
 			&f.Password,
 			validation.Required,
@@ -157,3 +421,87 @@ type UserOut struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 }
+
+// OIDCProvidersOut contains the names of the identity providers users can log
+// in with.
+type OIDCProvidersOut struct {
+	Providers []string `json:"providers"`
+}
+
+// CSRFTokenOut contains the CSRF token of a session.
+type CSRFTokenOut struct {
+	CSRFToken string `json:"csrf_token"`
+}
+
+// MFARequiredOut contains the token needed to complete a login with a
+// second factor.
+type MFARequiredOut struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+// TOTPEnrollmentOut contains the information needed to add a TOTP secret to
+// an authenticator app.
+type TOTPEnrollmentOut struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodesOut contains single use codes that can replace a TOTP code.
+type RecoveryCodesOut struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// JWKOut contains a public key as described by RFC 7517.
+type JWKOut struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSOut contains a set of public keys as described by RFC 7517.
+type JWKSOut struct {
+	Keys []JWKOut `json:"keys"`
+}
+
+// TokenOut contains the tokens of a session.
+type TokenOut struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// APIKeyOut contains information about an API key.
+type APIKeyOut struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// NewAPIKeyOut contains information about a newly created API key including
+// its secret, which is only ever shown once.
+type NewAPIKeyOut struct {
+	APIKeyOut
+	Key string `json:"key"`
+}
+
+// SessionOut contains information about a session.
+type SessionOut struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	ClientID   string    `json:"client_id,omitempty"`
+	Current    bool      `json:"current"`
+}
@@ -0,0 +1,203 @@
+package schema
+
+import (
+	"regexp"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// ============================================== //
+//                    INPUT                       //
+// ============================================== //
+
+// base64URLRegexp matches the base64url encoding of binary WebAuthn fields.
+var base64URLRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+={0,2}$`)
+
+// WebAuthnRegistrationForm contains the response of an authenticator to the
+// registration of a passkey. Binary fields are base64url encoded, as by
+// PublicKeyCredential.toJSON, and Token is the one issued with the options.
+type WebAuthnRegistrationForm struct {
+	Token             string   `json:"token"`
+	Name              string   `json:"name"`
+	ID                string   `json:"id"`
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject"`
+	Transports        []string `json:"transports"`
+}
+
+// Validate f's schema.
+func (f WebAuthnRegistrationForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Token,
+			validation.Required,
+		),
+		validation.Field(
+			&f.Name,
+			validation.Required,
+			validation.Length(1, 64),
+		),
+		validation.Field(
+			&f.ID,
+			validation.Required,
+			validation.Match(base64URLRegexp),
+		),
+		validation.Field(
+			&f.ClientDataJSON,
+			validation.Required,
+			validation.Match(base64URLRegexp),
+		),
+		validation.Field(
+			&f.AttestationObject,
+			validation.Required,
+			validation.Match(base64URLRegexp),
+		),
+		validation.Field(
+			&f.Transports,
+			validation.Length(0, 8),
+			validation.Each(validation.Required, validation.Length(1, 16)),
+		),
+	)
+	return errToErrors(err)
+}
+
+// WebAuthnLoginForm contains the assertion of a passkey by an authenticator.
+// Binary fields are base64url encoded, as by PublicKeyCredential.toJSON, and
+// Token is the one issued with the options.
+type WebAuthnLoginForm struct {
+	Token             string `json:"token"`
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle"`
+}
+
+// Validate f's schema.
+func (f WebAuthnLoginForm) Validate() (Errors, error) {
+	err := validation.ValidateStruct(
+		&f,
+		validation.Field(
+			&f.Token,
+			validation.Required,
+		),
+		validation.Field(
+			&f.ID,
+			validation.Required,
+			validation.Match(base64URLRegexp),
+		),
+		validation.Field(
+			&f.ClientDataJSON,
+			validation.Required,
+			validation.Match(base64URLRegexp),
+		),
+		validation.Field(
+			&f.AuthenticatorData,
+			validation.Required,
+			validation.Match(base64URLRegexp),
+		),
+		validation.Field(
+			&f.Signature,
+			validation.Required,
+			validation.Match(base64URLRegexp),
+		),
+		validation.Field(
+			&f.UserHandle,
+			validation.Required,
+			validation.Match(base64URLRegexp),
+		),
+	)
+	return errToErrors(err)
+}
+
+// ============================================== //
+//                    OUTPUT                      //
+// ============================================== //
+
+// WebAuthnCredentialOut contains information about a passkey.
+type WebAuthnCredentialOut struct {
+	ID           uint       `json:"id"`
+	Name         string     `json:"name"`
+	CredentialID string     `json:"credential_id"`
+	AAGUID       string     `json:"aaguid"`
+	Transports   []string   `json:"transports"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+// WebAuthnCreationOptionsOut contains the options of the registration of a
+// passkey, to be passed to navigator.credentials.create once parsed by
+// PublicKeyCredential.parseCreationOptionsFromJSON, and the token to send
+// back along with its result.
+type WebAuthnCreationOptionsOut struct {
+	Token     string                  `json:"token"`
+	PublicKey WebAuthnCreationOptions `json:"publicKey"`
+}
+
+// WebAuthnCreationOptions are the options of the registration of a passkey.
+// Binary fields are base64url encoded.
+type WebAuthnCreationOptions struct {
+	RP                     WebAuthnRelyingParty      `json:"rp"`
+	User                   WebAuthnUser              `json:"user"`
+	Challenge              string                    `json:"challenge"`
+	PubKeyCredParams       []WebAuthnCredentialParam `json:"pubKeyCredParams"`
+	Timeout                int64                     `json:"timeout"`
+	ExcludeCredentials     []WebAuthnDescriptor      `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnSelection         `json:"authenticatorSelection"` //nolint:lll // annotaions dont allow new lines.
+	Attestation            string                    `json:"attestation"`
+}
+
+// WebAuthnRequestOptionsOut contains the options of a login with a passkey,
+// to be passed to navigator.credentials.get once parsed by
+// PublicKeyCredential.parseRequestOptionsFromJSON, and the token to send back
+// along with its result.
+type WebAuthnRequestOptionsOut struct {
+	Token     string                 `json:"token"`
+	PublicKey WebAuthnRequestOptions `json:"publicKey"`
+}
+
+// WebAuthnRequestOptions are the options of a login with a passkey. Binary
+// fields are base64url encoded.
+type WebAuthnRequestOptions struct {
+	Challenge        string               `json:"challenge"`
+	Timeout          int64                `json:"timeout"`
+	RPID             string               `json:"rpId"`
+	AllowCredentials []WebAuthnDescriptor `json:"allowCredentials"`
+	UserVerification string               `json:"userVerification"`
+}
+
+// WebAuthnRelyingParty identifies this service to authenticators.
+type WebAuthnRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// WebAuthnUser identifies the owner of a passkey to authenticators.
+type WebAuthnUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// WebAuthnCredentialParam names a signature algorithm by its COSE identifier.
+type WebAuthnCredentialParam struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// WebAuthnDescriptor identifies a passkey.
+type WebAuthnDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// WebAuthnSelection restricts the authenticators that can register a
+// passkey.
+type WebAuthnSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}